@@ -2,4 +2,4 @@ module circuit-breaker
 
 go 1.23.0
 
-require github.com/sony/gobreaker/v2 v2.3.0 // indirect
+require github.com/sony/gobreaker/v2 v2.3.0
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kongctl/kong"
+	"kongctl/kong/kongtest"
+)
+
+const baseConfig = `
+_format_version: "3.0"
+services:
+  - name: grpc-hello-service
+    protocol: grpc
+    host: grpc-server
+    port: 50051
+    routes:
+      - name: grpc-hello-route
+        protocols: [grpc]
+        paths: [/hello.HelloService]
+        plugins:
+          - name: rate-limiting
+            config:
+              minute: 100
+              policy: local
+    plugins:
+      - name: correlation-id
+        config:
+          header_name: Kong-Request-ID
+upstreams:
+  - name: grpc-upstream
+    targets:
+      - target: grpc-server:50051
+        weight: 100
+plugins:
+  - name: prometheus
+`
+
+func writeConfig(t *testing.T, content string) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "kong.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	return cfg
+}
+
+func apply(t *testing.T, fake *kongtest.Server, cfg *Config) *Plan {
+	t.Helper()
+	ctx := context.Background()
+	client := kong.NewClient(fake.URL)
+	plan, err := buildPlan(ctx, client, cfg, true)
+	if err != nil {
+		t.Fatalf("buildPlan: %v", err)
+	}
+	if err := plan.Apply(ctx, client, &bytes.Buffer{}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	return plan
+}
+
+func planSummary(p *Plan) []string {
+	var out []string
+	for _, ch := range p.Changes {
+		out = append(out, string(ch.Action)+" "+ch.Kind+" "+ch.Name)
+	}
+	return out
+}
+
+func TestApplyCreatesEverything(t *testing.T) {
+	fake := kongtest.NewServer()
+	defer fake.Close()
+
+	plan := apply(t, fake, writeConfig(t, baseConfig))
+
+	want := []string{
+		"+ upstream grpc-upstream",
+		"+ target grpc-server:50051 (upstream grpc-upstream)",
+		"+ service grpc-hello-service",
+		"+ route grpc-hello-route",
+		"+ plugin prometheus (global)",
+		"+ plugin correlation-id (service grpc-hello-service)",
+		"+ plugin rate-limiting (route grpc-hello-route)",
+	}
+	if got := planSummary(plan); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("plan =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	routes := fake.Entities("routes")
+	services := fake.Entities("services")
+	if len(routes) != 1 || len(services) != 1 {
+		t.Fatalf("got %d routes and %d services, want 1 each", len(routes), len(services))
+	}
+	if ref := routes[0]["service"].(map[string]interface{}); ref["id"] != services[0]["id"] {
+		t.Errorf("route is attached to %v, want %v", ref["id"], services[0]["id"])
+	}
+	if got := len(fake.Entities("plugins")); got != 3 {
+		t.Errorf("got %d plugins, want 3", got)
+	}
+}
+
+func TestApplyIsIdempotent(t *testing.T) {
+	fake := kongtest.NewServer()
+	defer fake.Close()
+	cfg := writeConfig(t, baseConfig)
+
+	apply(t, fake, cfg)
+	writesAfterFirst := len(fake.Writes())
+
+	plan := apply(t, fake, cfg)
+	if !plan.Empty() {
+		t.Errorf("second apply planned changes:\n%s", strings.Join(planSummary(plan), "\n"))
+	}
+	if got := len(fake.Writes()); got != writesAfterFirst {
+		t.Errorf("second apply made %d writes: %v", got-writesAfterFirst, fake.Writes()[writesAfterFirst:])
+	}
+}
+
+func TestApplyUpdatesChangedFields(t *testing.T) {
+	fake := kongtest.NewServer()
+	defer fake.Close()
+	apply(t, fake, writeConfig(t, baseConfig))
+
+	changed := strings.NewReplacer(
+		"port: 50051", "port: 50052",
+		"minute: 100", "minute: 10",
+		"weight: 100", "weight: 50",
+	).Replace(baseConfig)
+	plan := apply(t, fake, writeConfig(t, changed))
+
+	want := []string{
+		"~ target grpc-server:50051 (upstream grpc-upstream)",
+		"~ service grpc-hello-service",
+		"~ plugin rate-limiting (route grpc-hello-route)",
+	}
+	if got := planSummary(plan); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("plan =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if d := plan.Changes[2].Diffs; len(d) != 1 || d[0].Path != "config.minute" {
+		t.Errorf("rate-limiting diffs = %+v, want only config.minute", d)
+	}
+
+	if port := fake.Entities("services")[0]["port"]; port != float64(50052) {
+		t.Errorf("service port = %v, want 50052", port)
+	}
+	if next := apply(t, fake, writeConfig(t, changed)); !next.Empty() {
+		t.Errorf("apply after update is not idempotent:\n%s", strings.Join(planSummary(next), "\n"))
+	}
+}
+
+func TestApplyDeletesUndeclared(t *testing.T) {
+	fake := kongtest.NewServer()
+	defer fake.Close()
+	apply(t, fake, writeConfig(t, baseConfig))
+
+	// Entities created by setup-kong.sh or by hand are pruned too.
+	legacy := fake.Seed("services", kongtest.Entity{"name": "legacy", "host": "old"})
+	fake.Seed("routes", kongtest.Entity{"name": "legacy-route", "service": map[string]interface{}{"id": legacy["id"]}})
+
+	plan := apply(t, fake, writeConfig(t, `
+_format_version: "3.0"
+services:
+  - name: grpc-hello-service
+    protocol: grpc
+    host: grpc-server
+    port: 50051
+`))
+
+	want := []string{
+		"- plugin correlation-id (service grpc-hello-service)",
+		"- plugin prometheus (global)",
+		"- plugin rate-limiting (route grpc-hello-route)",
+		"- route grpc-hello-route",
+		"- route legacy-route",
+		"- service legacy",
+		"- upstream grpc-upstream",
+	}
+	if got := planSummary(plan); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("plan =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for _, collection := range []string{"routes", "plugins", "upstreams", "targets"} {
+		if got := len(fake.Entities(collection)); got != 0 {
+			t.Errorf("%d %s left after prune", got, collection)
+		}
+	}
+	if got := len(fake.Entities("services")); got != 1 {
+		t.Errorf("got %d services, want 1", got)
+	}
+}
+
+func TestApplyKeepsUndeclaredWithoutPrune(t *testing.T) {
+	fake := kongtest.NewServer()
+	defer fake.Close()
+	apply(t, fake, writeConfig(t, baseConfig))
+	fake.Seed("services", kongtest.Entity{"name": "legacy", "host": "old"})
+
+	ctx := context.Background()
+	plan, err := buildPlan(ctx, kong.NewClient(fake.URL), writeConfig(t, `
+_format_version: "3.0"
+services:
+  - name: grpc-hello-service
+    protocol: grpc
+    host: grpc-server
+    port: 50051
+`), false)
+	if err != nil {
+		t.Fatalf("buildPlan: %v", err)
+	}
+	if !plan.Empty() {
+		t.Errorf("plan without prune =\n%s\nwant no changes", strings.Join(planSummary(plan), "\n"))
+	}
+}
+
+func TestDryRunPrintsDiffWithoutWriting(t *testing.T) {
+	fake := kongtest.NewServer()
+	defer fake.Close()
+	apply(t, fake, writeConfig(t, baseConfig))
+	writes := len(fake.Writes())
+
+	ctx := context.Background()
+	changed := strings.Replace(baseConfig, "paths: [/hello.HelloService]", "paths: [/hello.HelloService, /hello.v2.HelloService]", 1)
+	plan, err := buildPlan(ctx, kong.NewClient(fake.URL), writeConfig(t, changed), true)
+	if err != nil {
+		t.Fatalf("buildPlan: %v", err)
+	}
+	var out bytes.Buffer
+	plan.Print(&out)
+
+	wantLines := []string{
+		"~ route grpc-hello-route",
+		`    paths: ["/hello.HelloService"] => ["/hello.HelloService","/hello.v2.HelloService"]`,
+		"Plan: 0 to create, 1 to update, 0 to delete.",
+	}
+	for _, line := range wantLines {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("diff output missing %q:\n%s", line, out.String())
+		}
+	}
+	if got := len(fake.Writes()); got != writes {
+		t.Errorf("dry run made %d writes", got-writes)
+	}
+}
+
+func TestLoadConfigRejectsDuplicates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kong.yaml")
+	os.WriteFile(path, []byte(`
+_format_version: "3.0"
+services:
+  - name: a
+    routes:
+      - name: r
+  - name: b
+    routes:
+      - name: r
+`), 0o644)
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), `duplicate route "r"`) {
+		t.Errorf("loadConfig err = %v, want duplicate route", err)
+	}
+}
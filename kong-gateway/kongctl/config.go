@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"kongctl/kong"
+)
+
+// Config is a declarative Kong configuration in the decK / DB-less format:
+// routes and plugins are nested under their service, targets under their upstream.
+type Config struct {
+	FormatVersion string          `yaml:"_format_version"`
+	Services      []kong.Service  `yaml:"services,omitempty"`
+	Upstreams     []kong.Upstream `yaml:"upstreams,omitempty"`
+	// Plugins holds global plugins.
+	Plugins []kong.Plugin `yaml:"plugins,omitempty"`
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// validate checks the names kongctl uses to match file entities with live ones.
+func (c *Config) validate() error {
+	if c.FormatVersion == "" {
+		return fmt.Errorf("_format_version is required")
+	}
+
+	services := make(map[string]bool)
+	routes := make(map[string]bool)
+	for _, s := range c.Services {
+		if s.Name == "" {
+			return fmt.Errorf("every service needs a name")
+		}
+		if services[s.Name] {
+			return fmt.Errorf("duplicate service %q", s.Name)
+		}
+		services[s.Name] = true
+		for _, r := range s.Routes {
+			if r.Name == "" {
+				return fmt.Errorf("every route of service %q needs a name", s.Name)
+			}
+			if routes[r.Name] {
+				return fmt.Errorf("duplicate route %q", r.Name)
+			}
+			routes[r.Name] = true
+		}
+	}
+
+	upstreams := make(map[string]bool)
+	for _, u := range c.Upstreams {
+		if u.Name == "" {
+			return fmt.Errorf("every upstream needs a name")
+		}
+		if upstreams[u.Name] {
+			return fmt.Errorf("duplicate upstream %q", u.Name)
+		}
+		upstreams[u.Name] = true
+		targets := make(map[string]bool)
+		for _, t := range u.Targets {
+			if t.Target == "" {
+				return fmt.Errorf("every target of upstream %q needs a target", u.Name)
+			}
+			if targets[t.Target] {
+				return fmt.Errorf("duplicate target %q in upstream %q", t.Target, u.Name)
+			}
+			targets[t.Target] = true
+		}
+	}
+
+	plugins := make(map[string]bool)
+	for _, p := range c.plugins() {
+		if p.Name == "" {
+			return fmt.Errorf("every plugin needs a name")
+		}
+		key := pluginKey(p)
+		if plugins[key] {
+			return fmt.Errorf("duplicate plugin %s", key)
+		}
+		plugins[key] = true
+	}
+	return nil
+}
+
+// plugins flattens global, service and route plugins, setting their scope.
+func (c *Config) plugins() []kong.Plugin {
+	var all []kong.Plugin
+	all = append(all, c.Plugins...)
+	for _, s := range c.Services {
+		for _, p := range s.Plugins {
+			p.Service = &kong.Ref{Name: s.Name}
+			all = append(all, p)
+		}
+		for _, r := range s.Routes {
+			for _, p := range r.Plugins {
+				p.Route = &kong.Ref{Name: r.Name}
+				all = append(all, p)
+			}
+		}
+	}
+	return all
+}
+
+// pluginKey identifies a plugin by name and scope, e.g. "rate-limiting (route grpc-hello-route)".
+func pluginKey(p kong.Plugin) string {
+	switch {
+	case p.Route != nil:
+		return fmt.Sprintf("%s (route %s)", p.Name, p.Route.Name)
+	case p.Service != nil:
+		return fmt.Sprintf("%s (service %s)", p.Name, p.Service.Name)
+	default:
+		return fmt.Sprintf("%s (global)", p.Name)
+	}
+}
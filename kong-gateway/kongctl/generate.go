@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"kongctl/kong"
+)
+
+// Route modes for generated gRPC routes.
+const (
+	routePerMethod  = "method"
+	routePerService = "service"
+	routePerPackage = "package"
+)
+
+type generateOptions struct {
+	ImportPaths []string
+	// Defaults for services without (kong.service) host/port/protocol.
+	Host     string
+	Port     int
+	Protocol string
+	// RouteMode is one of "method", "service" or "package".
+	RouteMode string
+	// ProtoDir is where the .proto files are mounted inside Kong, for grpc-gateway.
+	ProtoDir string
+}
+
+// serviceOption mirrors kong.Service in proto/kong/options.proto.
+type serviceOption struct {
+	Name     string        `json:"name"`
+	Host     string        `json:"host"`
+	Port     int           `json:"port"`
+	Protocol string        `json:"protocol"`
+	Plugins  pluginOptions `json:"plugins"`
+}
+
+// methodOption mirrors kong.Method in proto/kong/options.proto.
+type methodOption struct {
+	Plugins pluginOptions `json:"plugins"`
+}
+
+// pluginOptions maps plugin fields (rate_limiting) to their config.
+type pluginOptions map[string]map[string]interface{}
+
+// httpRule mirrors google.api.HttpRule.
+type httpRule struct {
+	Get                string     `json:"get"`
+	Put                string     `json:"put"`
+	Post               string     `json:"post"`
+	Delete             string     `json:"delete"`
+	Patch              string     `json:"patch"`
+	AdditionalBindings []httpRule `json:"additional_bindings"`
+}
+
+const grpcGatewayPlugin = "grpc-gateway"
+
+// kongPlugins converts plugin options to Kong plugins, sorted by field name.
+// grpc-gateway is handled separately since it belongs on REST routes.
+func (p pluginOptions) kongPlugins() []kong.Plugin {
+	var plugins []kong.Plugin
+	for _, field := range sortedKeys(p) {
+		name := strings.ReplaceAll(field, "_", "-")
+		if name == grpcGatewayPlugin {
+			continue
+		}
+		plugins = append(plugins, kong.Plugin{Name: name, Config: p[field]})
+	}
+	return plugins
+}
+
+// readOption decodes the extension named fullName from opts into out,
+// using proto field names so keys match Kong's config schema.
+func readOption(opts proto.Message, fullName protoreflect.FullName, out interface{}) (bool, error) {
+	if opts == nil {
+		return false, nil
+	}
+	var value protoreflect.Message
+	opts.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsExtension() && fd.FullName() == fullName {
+			value = v.Message()
+			return false
+		}
+		return true
+	})
+	if value == nil {
+		return false, nil
+	}
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(value.Interface())
+	if err != nil {
+		return false, fmt.Errorf("failed to encode %s: %w", fullName, err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", fullName, err)
+	}
+	return true, nil
+}
+
+// kebab converts "SayHelloServerStream" to "say-hello-server-stream".
+func kebab(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// restPaths returns the static prefixes and HTTP methods of an HttpRule and
+// its additional bindings, e.g. "/v1/hello/{name}" becomes "/v1/hello/".
+func restPaths(rule httpRule) ([]string, []string) {
+	paths := make(map[string]bool)
+	methods := make(map[string]bool)
+	var walk func(r httpRule)
+	walk = func(r httpRule) {
+		for method, p := range map[string]string{"GET": r.Get, "PUT": r.Put, "POST": r.Post, "DELETE": r.Delete, "PATCH": r.Patch} {
+			if p == "" {
+				continue
+			}
+			if i := strings.Index(p, "{"); i >= 0 {
+				p = p[:i]
+			}
+			paths[p] = true
+			methods[method] = true
+		}
+		for _, b := range r.AdditionalBindings {
+			walk(b)
+		}
+	}
+	walk(rule)
+	return sortedKeys(paths), sortedKeys(methods)
+}
+
+// generateConfig compiles the given .proto files and builds a declarative
+// config with one Kong service per gRPC service.
+func generateConfig(ctx context.Context, files []string, opts generateOptions) (*Config, error) {
+	switch opts.RouteMode {
+	case routePerMethod, routePerService, routePerPackage:
+	default:
+		return nil, fmt.Errorf("unknown route mode %q (want method, service or package)", opts.RouteMode)
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: opts.ImportPaths}),
+	}
+	compiled, err := compiler.Compile(ctx, files...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile protos: %w", err)
+	}
+
+	cfg := &Config{FormatVersion: "3.0"}
+	packageServices := make(map[string]int)
+	for _, fd := range compiled {
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			sd := services.Get(i)
+			svc, err := generateService(fd, sd, opts)
+			if err != nil {
+				return nil, err
+			}
+
+			if opts.RouteMode == routePerPackage {
+				pkg := string(fd.Package())
+				idx, ok := packageServices[pkg]
+				if !ok {
+					// The first service of a package gets the package-wide route.
+					cfg.Services = append(cfg.Services, packageService(pkg, svc))
+					idx = len(cfg.Services) - 1
+					packageServices[pkg] = idx
+				}
+				if cfg.Services[idx].Host != svc.Host || cfg.Services[idx].Port != svc.Port {
+					return nil, fmt.Errorf("package %s spans upstreams %s:%d and %s:%d; use -routes service or method",
+						pkg, cfg.Services[idx].Host, cfg.Services[idx].Port, svc.Host, svc.Port)
+				}
+				// Service plugins move to the routes of this gRPC service: its
+				// method routes, which win over shorter paths, and a route
+				// matching the rest of its methods.
+				for _, route := range svc.Routes {
+					route.Plugins = withPlugins(route.Plugins, svc.Plugins)
+					cfg.Services[idx].Routes = append(cfg.Services[idx].Routes, route)
+				}
+				if len(svc.Plugins) > 0 {
+					cfg.Services[idx].Routes = append(cfg.Services[idx].Routes, kong.Route{
+						Name:      svc.Name + "-route",
+						Protocols: []string{"grpc", "grpcs"},
+						Paths:     []string{"/" + string(sd.FullName()) + "/"},
+						Plugins:   svc.Plugins,
+					})
+				}
+				continue
+			}
+			cfg.Services = append(cfg.Services, svc)
+		}
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("generated config is invalid: %w", err)
+	}
+	return cfg, nil
+}
+
+// withPlugins returns the route plugins plus the service plugins the route
+// does not override with its own plugin of the same name.
+func withPlugins(route, service []kong.Plugin) []kong.Plugin {
+	plugins := append([]kong.Plugin(nil), route...)
+	for _, p := range service {
+		if !slices.ContainsFunc(route, func(r kong.Plugin) bool { return r.Name == p.Name }) {
+			plugins = append(plugins, p)
+		}
+	}
+	return plugins
+}
+
+func packageService(pkg string, first kong.Service) kong.Service {
+	name := strings.ReplaceAll(pkg, ".", "-") + "-package"
+	return kong.Service{
+		Name:     name,
+		Protocol: first.Protocol,
+		Host:     first.Host,
+		Port:     first.Port,
+		Routes: []kong.Route{{
+			Name:      name + "-route",
+			Protocols: []string{"grpc", "grpcs"},
+			Paths:     []string{"/" + pkg + "."},
+		}},
+	}
+}
+
+// generateService builds the Kong service for sd. In package mode the
+// returned routes only cover methods that need their own route.
+func generateService(fd protoreflect.FileDescriptor, sd protoreflect.ServiceDescriptor, opts generateOptions) (kong.Service, error) {
+	var so serviceOption
+	if _, err := readOption(sd.Options(), "kong.service", &so); err != nil {
+		return kong.Service{}, fmt.Errorf("%s: %w", sd.FullName(), err)
+	}
+
+	svc := kong.Service{
+		Name:     so.Name,
+		Protocol: so.Protocol,
+		Host:     so.Host,
+		Port:     so.Port,
+		Plugins:  so.Plugins.kongPlugins(),
+	}
+	if svc.Name == "" {
+		svc.Name = string(sd.FullName())
+	}
+	if svc.Protocol == "" {
+		svc.Protocol = opts.Protocol
+	}
+	if svc.Host == "" {
+		svc.Host = opts.Host
+	}
+	if svc.Port == 0 {
+		svc.Port = opts.Port
+	}
+
+	if opts.RouteMode == routePerService {
+		svc.Routes = append(svc.Routes, kong.Route{
+			Name:      svc.Name + "-route",
+			Protocols: []string{"grpc", "grpcs"},
+			Paths:     []string{"/" + string(sd.FullName()) + "/"},
+		})
+	}
+
+	_, serviceGateway := so.Plugins["grpc_gateway"]
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		var mo methodOption
+		if _, err := readOption(md.Options(), "kong.method", &mo); err != nil {
+			return kong.Service{}, fmt.Errorf("%s: %w", md.FullName(), err)
+		}
+
+		// Methods with their own plugins always get a route, since Kong
+		// attaches plugins to routes rather than to paths.
+		plugins := mo.Plugins.kongPlugins()
+		if opts.RouteMode == routePerMethod || len(plugins) > 0 {
+			svc.Routes = append(svc.Routes, kong.Route{
+				Name:      svc.Name + "-" + kebab(string(md.Name())),
+				Protocols: []string{"grpc", "grpcs"},
+				Paths:     []string{"/" + string(sd.FullName()) + "/" + string(md.Name())},
+				Plugins:   plugins,
+			})
+		}
+
+		gateway, methodGateway := mo.Plugins["grpc_gateway"]
+		if !serviceGateway && !methodGateway {
+			continue
+		}
+		if !methodGateway {
+			gateway = so.Plugins["grpc_gateway"]
+		}
+		route, ok, err := restRoute(fd, svc.Name, md, gateway, opts)
+		if err != nil {
+			return kong.Service{}, err
+		}
+		if ok {
+			route.Plugins = append(route.Plugins, plugins...)
+			svc.Routes = append(svc.Routes, route)
+		}
+	}
+	return svc, nil
+}
+
+// restRoute builds an HTTP route with the grpc-gateway plugin for a method
+// annotated with google.api.http. Streaming methods are skipped.
+func restRoute(fd protoreflect.FileDescriptor, serviceName string, md protoreflect.MethodDescriptor, gateway map[string]interface{}, opts generateOptions) (kong.Route, bool, error) {
+	var rule httpRule
+	found, err := readOption(md.Options(), "google.api.http", &rule)
+	if err != nil {
+		return kong.Route{}, false, fmt.Errorf("%s: %w", md.FullName(), err)
+	}
+	if !found || md.IsStreamingClient() || md.IsStreamingServer() {
+		return kong.Route{}, false, nil
+	}
+
+	config := make(map[string]interface{})
+	for k, v := range gateway {
+		config[k] = v
+	}
+	if config["proto"] == nil || config["proto"] == "" {
+		config["proto"] = path.Join(opts.ProtoDir, fd.Path())
+	}
+
+	paths, methods := restPaths(rule)
+	stripPath := false
+	return kong.Route{
+		Name:      serviceName + "-" + kebab(string(md.Name())) + "-rest",
+		Protocols: []string{"http", "https"},
+		Paths:     paths,
+		Methods:   methods,
+		StripPath: &stripPath,
+		Plugins:   []kong.Plugin{{Name: grpcGatewayPlugin, Config: config}},
+	}, true, nil
+}
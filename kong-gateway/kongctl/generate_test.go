@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kongctl/kong"
+	"kongctl/kong/kongtest"
+)
+
+const shopProto = `
+syntax = "proto3";
+
+package shop.v1;
+
+import "google/api/annotations.proto";
+import "kong/options.proto";
+
+service CartService {
+  option (kong.service) = {
+    name: "cart"
+    plugins: { correlation_id: { header_name: "X-Request-ID" } }
+  };
+
+  rpc GetCart(GetCartRequest) returns (Cart) {
+    option (google.api.http) = { get: "/v1/carts/{id}" };
+    option (kong.method) = {
+      plugins: {
+        rate_limiting: { second: 5 policy: "local" }
+        grpc_gateway: {}
+      }
+    };
+  }
+  rpc WatchCart(GetCartRequest) returns (stream Cart) {
+    option (google.api.http) = { get: "/v1/carts/{id}/watch" };
+    option (kong.method) = { plugins: { grpc_gateway: {} } };
+  }
+}
+
+service OrderService {
+  option (kong.service) = { host: "orders" port: 9000 protocol: "grpcs" };
+
+  rpc PlaceOrder(Cart) returns (Cart);
+}
+
+message GetCartRequest { string id = 1; }
+message Cart { string id = 1; }
+`
+
+func generateShop(t *testing.T, mode string) *Config {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "shop.proto"), []byte(shopProto), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := generateConfig(context.Background(), []string{"shop.proto"}, generateOptions{
+		ImportPaths: []string{dir, "../proto"},
+		Host:        "grpc-server",
+		Port:        50051,
+		Protocol:    "grpc",
+		RouteMode:   mode,
+		ProtoDir:    "/kong/proto",
+	})
+	if err != nil {
+		t.Fatalf("generateConfig(%s): %v", mode, err)
+	}
+	return cfg
+}
+
+func routeNames(s kong.Service) []string {
+	var names []string
+	for _, r := range s.Routes {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func findRoute(t *testing.T, s kong.Service, name string) kong.Route {
+	t.Helper()
+	for _, r := range s.Routes {
+		if r.Name == name {
+			return r
+		}
+	}
+	t.Fatalf("service %s has no route %s (routes: %v)", s.Name, name, routeNames(s))
+	return kong.Route{}
+}
+
+func TestGeneratePerMethod(t *testing.T) {
+	cfg := generateShop(t, routePerMethod)
+	if len(cfg.Services) != 2 {
+		t.Fatalf("got %d services, want 2", len(cfg.Services))
+	}
+
+	cart := cfg.Services[0]
+	if cart.Name != "cart" || cart.Host != "grpc-server" || cart.Port != 50051 || cart.Protocol != "grpc" {
+		t.Errorf("cart service = %+v, want flag defaults", cart)
+	}
+	if len(cart.Plugins) != 1 || cart.Plugins[0].Name != "correlation-id" || cart.Plugins[0].Config["header_name"] != "X-Request-ID" {
+		t.Errorf("cart plugins = %+v, want correlation-id", cart.Plugins)
+	}
+	want := "cart-get-cart,cart-get-cart-rest,cart-watch-cart"
+	if got := strings.Join(routeNames(cart), ","); got != want {
+		t.Errorf("cart routes = %s, want %s", got, want)
+	}
+
+	get := findRoute(t, cart, "cart-get-cart")
+	if get.Paths[0] != "/shop.v1.CartService/GetCart" {
+		t.Errorf("GetCart path = %v", get.Paths)
+	}
+	if len(get.Plugins) != 1 || get.Plugins[0].Name != "rate-limiting" || get.Plugins[0].Config["second"] != float64(5) {
+		t.Errorf("GetCart plugins = %+v, want rate-limiting second=5", get.Plugins)
+	}
+
+	orders := cfg.Services[1]
+	if orders.Name != "shop.v1.OrderService" || orders.Host != "orders" || orders.Port != 9000 || orders.Protocol != "grpcs" {
+		t.Errorf("order service = %+v, want values from (kong.service)", orders)
+	}
+}
+
+func TestGenerateRESTRoutes(t *testing.T) {
+	cfg := generateShop(t, routePerMethod)
+	rest := findRoute(t, cfg.Services[0], "cart-get-cart-rest")
+
+	if strings.Join(rest.Paths, ",") != "/v1/carts/" || strings.Join(rest.Methods, ",") != "GET" {
+		t.Errorf("REST route paths=%v methods=%v", rest.Paths, rest.Methods)
+	}
+	if rest.StripPath == nil || *rest.StripPath {
+		t.Error("REST route must not strip the path")
+	}
+	if len(rest.Plugins) != 2 || rest.Plugins[0].Name != "grpc-gateway" || rest.Plugins[1].Name != "rate-limiting" {
+		t.Fatalf("REST route plugins = %+v, want grpc-gateway and rate-limiting", rest.Plugins)
+	}
+	if got := rest.Plugins[0].Config["proto"]; got != "/kong/proto/shop.proto" {
+		t.Errorf("grpc-gateway proto = %v", got)
+	}
+}
+
+func TestGenerateRouteModes(t *testing.T) {
+	cfg := generateShop(t, routePerService)
+	want := "cart-route,cart-get-cart,cart-get-cart-rest"
+	if got := strings.Join(routeNames(cfg.Services[0]), ","); got != want {
+		t.Errorf("service mode routes = %s, want %s", got, want)
+	}
+
+	// OrderService has a different upstream, so it cannot share a package service.
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "shop.proto"), []byte(shopProto), 0o644)
+	_, err := generateConfig(context.Background(), []string{"shop.proto"}, generateOptions{
+		ImportPaths: []string{dir, "../proto"},
+		RouteMode:   routePerPackage,
+	})
+	if err == nil || !strings.Contains(err.Error(), "spans upstreams") {
+		t.Errorf("package mode err = %v, want spans upstreams", err)
+	}
+}
+
+func TestGenerateHelloProto(t *testing.T) {
+	cfg, err := generateConfig(context.Background(), []string{"hello.proto"}, generateOptions{
+		ImportPaths: []string{"../proto"},
+		Host:        "grpc-server",
+		Port:        50051,
+		Protocol:    "grpc",
+		RouteMode:   routePerPackage,
+	})
+	if err != nil {
+		t.Fatalf("generateConfig: %v", err)
+	}
+
+	// The generated config must apply cleanly.
+	fake := kongtest.NewServer()
+	defer fake.Close()
+	apply(t, fake, cfg)
+	if got := len(fake.Entities("routes")); got != 3 {
+		t.Errorf("got %d routes, want 3", got)
+	}
+}
+
+// TestGeneratePackagePlugins checks that service plugins reach the method
+// routes in package mode, since Kong matches the longest path only.
+func TestGeneratePackagePlugins(t *testing.T) {
+	cfg, err := generateConfig(context.Background(), []string{"hello.proto", "echostore.proto"}, generateOptions{
+		ImportPaths: []string{"../proto"},
+		Host:        "grpc-server",
+		Port:        50051,
+		Protocol:    "grpc",
+		RouteMode:   routePerPackage,
+		ProtoDir:    "/kong/proto",
+	})
+	if err != nil {
+		t.Fatalf("generateConfig: %v", err)
+	}
+
+	pluginNames := func(r kong.Route) string {
+		var names []string
+		for _, p := range r.Plugins {
+			names = append(names, p.Name)
+		}
+		return strings.Join(names, ",")
+	}
+	tests := []struct {
+		service int
+		route   string
+		want    string
+	}{
+		{0, "hello-package-route", ""},
+		{0, "grpc-hello-service-say-hello", "rate-limiting,correlation-id"},
+		{0, "grpc-hello-service-route", "correlation-id"},
+		{1, "grpc-echostore-service-put", "rate-limiting,correlation-id"},
+		{1, "grpc-echostore-service-route", "correlation-id"},
+	}
+	for _, tt := range tests {
+		if got := pluginNames(findRoute(t, cfg.Services[tt.service], tt.route)); got != tt.want {
+			t.Errorf("%s plugins = %s, want %s", tt.route, got, tt.want)
+		}
+	}
+
+	fake := kongtest.NewServer()
+	defer fake.Close()
+	apply(t, fake, cfg)
+}
+
+func TestGeneratePackagePluginOverride(t *testing.T) {
+	dir := t.TempDir()
+	proto := `
+syntax = "proto3";
+package shop.v1;
+import "kong/options.proto";
+
+service CartService {
+  option (kong.service) = { plugins: { correlation_id: { header_name: "X-Request-ID" } } };
+  rpc GetCart(Cart) returns (Cart) {
+    option (kong.method) = { plugins: { correlation_id: { header_name: "X-Cart-ID" } } };
+  }
+}
+
+message Cart { string id = 1; }
+`
+	if err := os.WriteFile(filepath.Join(dir, "shop.proto"), []byte(proto), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := generateConfig(context.Background(), []string{"shop.proto"}, generateOptions{
+		ImportPaths: []string{dir, "../proto"},
+		RouteMode:   routePerPackage,
+	})
+	if err != nil {
+		t.Fatalf("generateConfig: %v", err)
+	}
+	get := findRoute(t, cfg.Services[0], "shop.v1.CartService-get-cart")
+	if len(get.Plugins) != 1 || get.Plugins[0].Config["header_name"] != "X-Cart-ID" {
+		t.Errorf("GetCart plugins = %+v, want only the method's correlation-id", get.Plugins)
+	}
+}
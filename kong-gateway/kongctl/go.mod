@@ -0,0 +1,11 @@
+module kongctl
+
+go 1.23
+
+require (
+	github.com/bufbuild/protocompile v0.14.1
+	google.golang.org/protobuf v1.35.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sync v0.8.0 // indirect
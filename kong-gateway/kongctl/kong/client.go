@@ -0,0 +1,234 @@
+package kong
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client talks to the Kong Admin API.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// APIError is a non-2xx response from the Admin API.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s failed with status %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the Admin API.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(jsonBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{Method: method, Path: path, StatusCode: resp.StatusCode, Message: string(respBody)}
+		var kongErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(respBody, &kongErr) == nil && kongErr.Message != "" {
+			apiErr.Message = kongErr.Message
+		}
+		return apiErr
+	}
+
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+type page[T any] struct {
+	Data []T    `json:"data"`
+	Next string `json:"next"`
+}
+
+// list follows the Admin API's offset pagination and returns every entity.
+func list[T any](ctx context.Context, c *Client, path string) ([]T, error) {
+	var all []T
+	for path != "" {
+		var p page[T]
+		if err := c.do(ctx, http.MethodGet, path, nil, &p); err != nil {
+			return nil, err
+		}
+		all = append(all, p.Data...)
+		path = p.Next
+		// Kong returns an absolute path (or URL) for the next page.
+		if u, err := url.Parse(path); err == nil && u.IsAbs() {
+			path = u.RequestURI()
+		}
+	}
+	return all, nil
+}
+
+func escape(idOrName string) string {
+	return url.PathEscape(idOrName)
+}
+
+// Status checks that the Admin API is reachable.
+func (c *Client) Status(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/status", nil, nil)
+}
+
+func (c *Client) ListServices(ctx context.Context) ([]Service, error) {
+	return list[Service](ctx, c, "/services")
+}
+
+// UpsertService creates or replaces the service with the given name.
+func (c *Client) UpsertService(ctx context.Context, s Service) (*Service, error) {
+	var out Service
+	s.ID = ""
+	if err := c.do(ctx, http.MethodPut, "/services/"+escape(s.Name), s, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteService(ctx context.Context, idOrName string) error {
+	return c.do(ctx, http.MethodDelete, "/services/"+escape(idOrName), nil, nil)
+}
+
+func (c *Client) ListRoutes(ctx context.Context) ([]Route, error) {
+	return list[Route](ctx, c, "/routes")
+}
+
+// UpsertRoute creates or replaces the route with the given name. r.Service
+// may reference the service by name.
+func (c *Client) UpsertRoute(ctx context.Context, r Route) (*Route, error) {
+	var out Route
+	r.ID = ""
+	if err := c.do(ctx, http.MethodPut, "/routes/"+escape(r.Name), r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteRoute(ctx context.Context, idOrName string) error {
+	return c.do(ctx, http.MethodDelete, "/routes/"+escape(idOrName), nil, nil)
+}
+
+func (c *Client) ListUpstreams(ctx context.Context) ([]Upstream, error) {
+	return list[Upstream](ctx, c, "/upstreams")
+}
+
+// UpsertUpstream creates or replaces the upstream with the given name.
+func (c *Client) UpsertUpstream(ctx context.Context, u Upstream) (*Upstream, error) {
+	var out Upstream
+	u.ID = ""
+	if err := c.do(ctx, http.MethodPut, "/upstreams/"+escape(u.Name), u, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteUpstream(ctx context.Context, idOrName string) error {
+	return c.do(ctx, http.MethodDelete, "/upstreams/"+escape(idOrName), nil, nil)
+}
+
+func (c *Client) ListTargets(ctx context.Context, upstream string) ([]Target, error) {
+	return list[Target](ctx, c, "/upstreams/"+escape(upstream)+"/targets")
+}
+
+func (c *Client) CreateTarget(ctx context.Context, upstream string, t Target) (*Target, error) {
+	var out Target
+	t.ID, t.Upstream = "", nil
+	if err := c.do(ctx, http.MethodPost, "/upstreams/"+escape(upstream)+"/targets", t, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateTarget(ctx context.Context, upstream, id string, t Target) (*Target, error) {
+	var out Target
+	t.ID, t.Upstream = "", nil
+	if err := c.do(ctx, http.MethodPatch, "/upstreams/"+escape(upstream)+"/targets/"+escape(id), t, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteTarget(ctx context.Context, upstream, id string) error {
+	return c.do(ctx, http.MethodDelete, "/upstreams/"+escape(upstream)+"/targets/"+escape(id), nil, nil)
+}
+
+func (c *Client) ListPlugins(ctx context.Context) ([]Plugin, error) {
+	return list[Plugin](ctx, c, "/plugins")
+}
+
+// CreatePlugin creates a plugin instance. p.Service and p.Route may
+// reference their entities by name.
+func (c *Client) CreatePlugin(ctx context.Context, p Plugin) (*Plugin, error) {
+	var out Plugin
+	p.ID = ""
+	if err := c.do(ctx, http.MethodPost, "/plugins", p, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ReplacePlugin replaces the plugin instance with the given ID.
+func (c *Client) ReplacePlugin(ctx context.Context, id string, p Plugin) (*Plugin, error) {
+	var out Plugin
+	p.ID = ""
+	if err := c.do(ctx, http.MethodPut, "/plugins/"+escape(id), p, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeletePlugin(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/plugins/"+escape(id), nil, nil)
+}
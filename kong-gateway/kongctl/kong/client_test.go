@@ -0,0 +1,130 @@
+package kong_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"kongctl/kong"
+	"kongctl/kong/kongtest"
+)
+
+func TestListFollowsPagination(t *testing.T) {
+	fake := kongtest.NewServer()
+	defer fake.Close()
+	fake.PageSize = 2
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		fake.Seed("services", kongtest.Entity{"name": name, "host": name + ".internal"})
+	}
+
+	services, err := kong.NewClient(fake.URL).ListServices(context.Background())
+	if err != nil {
+		t.Fatalf("ListServices: %v", err)
+	}
+	if len(services) != 5 {
+		t.Fatalf("got %d services, want 5", len(services))
+	}
+	if services[4].Name != "e" || services[4].Host != "e.internal" {
+		t.Errorf("last service = %+v", services[4])
+	}
+}
+
+func TestUpsertServiceIsIdempotent(t *testing.T) {
+	fake := kongtest.NewServer()
+	defer fake.Close()
+	client := kong.NewClient(fake.URL)
+	ctx := context.Background()
+
+	svc := kong.Service{Name: "grpc-hello-service", Protocol: "grpc", Host: "grpc-server", Port: 50051}
+	first, err := client.UpsertService(ctx, svc)
+	if err != nil {
+		t.Fatalf("first upsert: %v", err)
+	}
+	second, err := client.UpsertService(ctx, svc)
+	if err != nil {
+		t.Fatalf("second upsert: %v", err)
+	}
+	if first.ID != second.ID {
+		t.Errorf("upsert created a new service: %s != %s", first.ID, second.ID)
+	}
+	if got := len(fake.Entities("services")); got != 1 {
+		t.Errorf("got %d services, want 1", got)
+	}
+}
+
+func TestUpsertRouteByServiceName(t *testing.T) {
+	fake := kongtest.NewServer()
+	defer fake.Close()
+	client := kong.NewClient(fake.URL)
+	ctx := context.Background()
+
+	svc, err := client.UpsertService(ctx, kong.Service{Name: "svc", Host: "example"})
+	if err != nil {
+		t.Fatalf("upsert service: %v", err)
+	}
+	route, err := client.UpsertRoute(ctx, kong.Route{
+		Name:    "route",
+		Paths:   []string{"/hello.HelloService"},
+		Service: &kong.Ref{Name: "svc"},
+	})
+	if err != nil {
+		t.Fatalf("upsert route: %v", err)
+	}
+	if route.Service == nil || route.Service.ID != svc.ID {
+		t.Errorf("route service = %+v, want id %s", route.Service, svc.ID)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	fake := kongtest.NewServer()
+	defer fake.Close()
+	client := kong.NewClient(fake.URL)
+
+	_, err := client.UpsertRoute(context.Background(), kong.Route{Name: "orphan", Service: &kong.Ref{Name: "missing"}})
+	if err == nil {
+		t.Fatal("expected an error for a missing service")
+	}
+	var apiErr *kong.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 {
+		t.Fatalf("err = %v, want 400 APIError", err)
+	}
+
+	_, err = client.ListTargets(context.Background(), "missing")
+	if !kong.IsNotFound(err) {
+		t.Errorf("ListTargets on missing upstream: err = %v, want not found", err)
+	}
+}
+
+func TestTargets(t *testing.T) {
+	fake := kongtest.NewServer()
+	defer fake.Close()
+	client := kong.NewClient(fake.URL)
+	ctx := context.Background()
+
+	if _, err := client.UpsertUpstream(ctx, kong.Upstream{Name: "grpc-upstream"}); err != nil {
+		t.Fatalf("upsert upstream: %v", err)
+	}
+	weight := 50
+	target, err := client.CreateTarget(ctx, "grpc-upstream", kong.Target{Target: "grpc-server:50051"})
+	if err != nil {
+		t.Fatalf("create target: %v", err)
+	}
+	if _, err := client.UpdateTarget(ctx, "grpc-upstream", target.ID, kong.Target{Target: target.Target, Weight: &weight}); err != nil {
+		t.Fatalf("update target: %v", err)
+	}
+
+	targets, err := client.ListTargets(ctx, "grpc-upstream")
+	if err != nil {
+		t.Fatalf("list targets: %v", err)
+	}
+	if len(targets) != 1 || targets[0].Weight == nil || *targets[0].Weight != 50 {
+		t.Fatalf("targets = %+v, want one with weight 50", targets)
+	}
+
+	if err := client.DeleteTarget(ctx, "grpc-upstream", target.ID); err != nil {
+		t.Fatalf("delete target: %v", err)
+	}
+	if got := len(fake.Entities("targets")); got != 0 {
+		t.Errorf("got %d targets after delete, want 0", got)
+	}
+}
@@ -0,0 +1,78 @@
+package kong
+
+// Ref points at another entity. Kong returns references by ID, but accepts
+// either the ID or the name when creating or updating.
+type Ref struct {
+	ID   string `json:"id,omitempty" yaml:"-"`
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+// Service is an upstream API that Kong proxies to.
+// Routes and Plugins are only used in declarative files.
+type Service struct {
+	ID             string   `json:"id,omitempty" yaml:"-"`
+	Name           string   `json:"name,omitempty" yaml:"name"`
+	Protocol       string   `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	Host           string   `json:"host,omitempty" yaml:"host,omitempty"`
+	Port           int      `json:"port,omitempty" yaml:"port,omitempty"`
+	Path           string   `json:"path,omitempty" yaml:"path,omitempty"`
+	Retries        *int     `json:"retries,omitempty" yaml:"retries,omitempty"`
+	ConnectTimeout *int     `json:"connect_timeout,omitempty" yaml:"connect_timeout,omitempty"`
+	ReadTimeout    *int     `json:"read_timeout,omitempty" yaml:"read_timeout,omitempty"`
+	WriteTimeout   *int     `json:"write_timeout,omitempty" yaml:"write_timeout,omitempty"`
+	Tags           []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+
+	Routes  []Route  `json:"-" yaml:"routes,omitempty"`
+	Plugins []Plugin `json:"-" yaml:"plugins,omitempty"`
+}
+
+// Route matches incoming requests and forwards them to a Service.
+type Route struct {
+	ID           string              `json:"id,omitempty" yaml:"-"`
+	Name         string              `json:"name,omitempty" yaml:"name"`
+	Protocols    []string            `json:"protocols,omitempty" yaml:"protocols,omitempty"`
+	Paths        []string            `json:"paths,omitempty" yaml:"paths,omitempty"`
+	Hosts        []string            `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	Methods      []string            `json:"methods,omitempty" yaml:"methods,omitempty"`
+	Headers      map[string][]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	StripPath    *bool               `json:"strip_path,omitempty" yaml:"strip_path,omitempty"`
+	PreserveHost *bool               `json:"preserve_host,omitempty" yaml:"preserve_host,omitempty"`
+	Tags         []string            `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Service      *Ref                `json:"service,omitempty" yaml:"-"`
+
+	Plugins []Plugin `json:"-" yaml:"plugins,omitempty"`
+}
+
+// Upstream is a virtual hostname load balanced across Targets.
+// Targets are only used in declarative files.
+type Upstream struct {
+	ID        string   `json:"id,omitempty" yaml:"-"`
+	Name      string   `json:"name,omitempty" yaml:"name"`
+	Algorithm string   `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	Slots     *int     `json:"slots,omitempty" yaml:"slots,omitempty"`
+	Tags      []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+
+	Targets []Target `json:"-" yaml:"targets,omitempty"`
+}
+
+// Target is a host:port backend of an Upstream.
+type Target struct {
+	ID       string   `json:"id,omitempty" yaml:"-"`
+	Target   string   `json:"target,omitempty" yaml:"target"`
+	Weight   *int     `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Tags     []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Upstream *Ref     `json:"upstream,omitempty" yaml:"-"`
+}
+
+// Plugin is a plugin instance, either global or scoped to a Service or Route.
+type Plugin struct {
+	ID        string                 `json:"id,omitempty" yaml:"-"`
+	Name      string                 `json:"name,omitempty" yaml:"name"`
+	Config    map[string]interface{} `json:"config,omitempty" yaml:"config,omitempty"`
+	Enabled   *bool                  `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Protocols []string               `json:"protocols,omitempty" yaml:"protocols,omitempty"`
+	Tags      []string               `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Service   *Ref                   `json:"service,omitempty" yaml:"-"`
+	Route     *Ref                   `json:"route,omitempty" yaml:"-"`
+	Consumer  *Ref                   `json:"consumer,omitempty" yaml:"-"`
+}
@@ -0,0 +1,339 @@
+// Package kongtest provides an in-memory fake of the Kong Admin API for tests.
+package kongtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Entity is a Kong entity as stored by the fake, in its JSON form.
+type Entity map[string]interface{}
+
+// defaults mirror the values Kong fills in for fields a client leaves unset.
+var defaults = map[string]Entity{
+	"services":  {"protocol": "http", "port": 80, "retries": 5, "connect_timeout": 60000, "read_timeout": 60000, "write_timeout": 60000},
+	"routes":    {"protocols": []interface{}{"http", "https"}, "strip_path": true, "preserve_host": false},
+	"upstreams": {"algorithm": "round-robin", "slots": 10000},
+	"targets":   {"weight": 100},
+	"plugins":   {"enabled": true, "protocols": []interface{}{"grpc", "grpcs", "http", "https"}, "config": map[string]interface{}{}},
+}
+
+// Server is a fake Admin API backed by in-memory collections.
+type Server struct {
+	*httptest.Server
+
+	// PageSize limits list responses so pagination gets exercised.
+	PageSize int
+
+	mu       sync.Mutex
+	nextID   int
+	entities map[string]map[string]Entity
+	requests []string
+}
+
+func NewServer() *Server {
+	s := &Server{
+		PageSize: 100,
+		entities: map[string]map[string]Entity{
+			"services": {}, "routes": {}, "upstreams": {}, "targets": {}, "plugins": {},
+		},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Requests returns the "METHOD /path" of every request received so far.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Writes returns the non-GET requests received so far.
+func (s *Server) Writes() []string {
+	var writes []string
+	for _, r := range s.Requests() {
+		if !strings.HasPrefix(r, http.MethodGet+" ") {
+			writes = append(writes, r)
+		}
+	}
+	return writes
+}
+
+// Entities returns a copy of the named collection, sorted by name (or target).
+func (s *Server) Entities(collection string) []Entity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sorted(collection)
+}
+
+// Seed inserts an entity directly, bypassing the API.
+func (s *Server) Seed(collection string, e Entity) Entity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, _ := s.store(collection, "", e, nil)
+	return stored
+}
+
+func (s *Server) sorted(collection string) []Entity {
+	var out []Entity
+	for _, e := range s.entities[collection] {
+		out = append(out, copyEntity(e))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return sortKey(out[i]) < sortKey(out[j])
+	})
+	return out
+}
+
+func sortKey(e Entity) string {
+	for _, k := range []string{"name", "target"} {
+		if v, ok := e[k].(string); ok {
+			return v + "/" + e["id"].(string)
+		}
+	}
+	return e["id"].(string)
+}
+
+func copyEntity(e Entity) Entity {
+	b, _ := json.Marshal(e)
+	var out Entity
+	json.Unmarshal(b, &out)
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, map[string]string{"message": fmt.Sprintf(format, args...)})
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 && parts[0] == "status" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"database": map[string]bool{"reachable": true}})
+		return
+	}
+
+	var body Entity
+	if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: %v", err)
+			return
+		}
+	}
+
+	switch {
+	case len(parts) == 3 && parts[0] == "upstreams" && parts[2] == "targets":
+		upstream := s.find("upstreams", parts[1])
+		if upstream == nil {
+			writeError(w, http.StatusNotFound, "upstream not found")
+			return
+		}
+		ref := Entity{"id": upstream["id"]}
+		switch r.Method {
+		case http.MethodGet:
+			s.list(w, r, "targets", func(e Entity) bool { return sameRef(e["upstream"], upstream["id"]) })
+		case http.MethodPost:
+			body["upstream"] = ref
+			s.create(w, "targets", body)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case len(parts) == 4 && parts[0] == "upstreams" && parts[2] == "targets":
+		s.entity(w, r, "targets", parts[3], body)
+	case len(parts) == 1 && s.entities[parts[0]] != nil:
+		switch r.Method {
+		case http.MethodGet:
+			s.list(w, r, parts[0], nil)
+		case http.MethodPost:
+			s.create(w, parts[0], body)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case len(parts) == 2 && s.entities[parts[0]] != nil:
+		s.entity(w, r, parts[0], parts[1], body)
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func sameRef(ref interface{}, id interface{}) bool {
+	m, ok := ref.(map[string]interface{})
+	return ok && m["id"] == id
+}
+
+// find looks an entity up by ID, or by name (targets: by host:port).
+func (s *Server) find(collection, idOrName string) Entity {
+	if e, ok := s.entities[collection][idOrName]; ok {
+		return e
+	}
+	for _, e := range s.entities[collection] {
+		if e["name"] == idOrName || e["target"] == idOrName {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, collection string, filter func(Entity) bool) {
+	var all []Entity
+	for _, e := range s.sorted(collection) {
+		if filter == nil || filter(e) {
+			all = append(all, e)
+		}
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	end := offset + s.PageSize
+	var next interface{}
+	if end < len(all) {
+		next = fmt.Sprintf("%s?offset=%d", r.URL.Path, end)
+	} else {
+		end = len(all)
+	}
+	data := []Entity{}
+	if offset < len(all) {
+		data = all[offset:end]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data, "next": next})
+}
+
+func (s *Server) create(w http.ResponseWriter, collection string, body Entity) {
+	if name, ok := body["name"].(string); ok && collection != "plugins" && s.find(collection, name) != nil {
+		writeError(w, http.StatusConflict, "UNIQUE violation detected on '{name=\"%s\"}'", name)
+		return
+	}
+	stored, err := s.store(collection, "", body, nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, stored)
+}
+
+func (s *Server) entity(w http.ResponseWriter, r *http.Request, collection, idOrName string, body Entity) {
+	existing := s.find(collection, idOrName)
+	switch r.Method {
+	case http.MethodGet:
+		if existing == nil {
+			writeError(w, http.StatusNotFound, "Not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, existing)
+	case http.MethodPut:
+		id := ""
+		if existing != nil {
+			id = existing["id"].(string)
+		} else if collection == "plugins" || collection == "targets" {
+			id = idOrName
+		} else if _, ok := body["name"]; !ok {
+			body["name"] = idOrName
+		}
+		if collection == "targets" && existing != nil {
+			body["upstream"] = existing["upstream"]
+		}
+		stored, err := s.store(collection, id, body, nil)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, stored)
+	case http.MethodPatch:
+		if existing == nil {
+			writeError(w, http.StatusNotFound, "Not found")
+			return
+		}
+		stored, err := s.store(collection, existing["id"].(string), body, existing)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, stored)
+	case http.MethodDelete:
+		if existing != nil {
+			if err := s.delete(collection, existing["id"].(string)); err != nil {
+				writeError(w, http.StatusBadRequest, "%v", err)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// store validates body, resolves references by name, applies defaults (or
+// merges onto base for PATCH) and saves the entity under id.
+func (s *Server) store(collection, id string, body, base Entity) (Entity, error) {
+	e := Entity{}
+	if base != nil {
+		e = copyEntity(base)
+	} else {
+		for k, v := range copyEntity(defaults[collection]) {
+			e[k] = v
+		}
+	}
+	for k, v := range copyEntity(body) {
+		e[k] = v
+	}
+
+	for field, target := range map[string]string{"service": "services", "route": "routes", "upstream": "upstreams"} {
+		ref, ok := e[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		key, _ := ref["id"].(string)
+		if key == "" {
+			key, _ = ref["name"].(string)
+		}
+		referenced := s.find(target, key)
+		if referenced == nil {
+			return nil, fmt.Errorf("the foreign key '{%s}' does not reference an existing '%s' entity", key, target)
+		}
+		e[field] = map[string]interface{}{"id": referenced["id"]}
+	}
+
+	if id == "" {
+		s.nextID++
+		id = fmt.Sprintf("00000000-0000-0000-0000-%012d", s.nextID)
+	}
+	e["id"] = id
+	s.entities[collection][id] = e
+	return copyEntity(e), nil
+}
+
+func (s *Server) delete(collection, id string) error {
+	for _, e := range s.entities["routes"] {
+		if collection == "services" && sameRef(e["service"], id) {
+			return fmt.Errorf("an existing 'routes' entity references this 'services' entity")
+		}
+	}
+	delete(s.entities[collection], id)
+
+	// Kong cascades deletes to plugins and targets.
+	for pid, p := range s.entities["plugins"] {
+		if sameRef(p["service"], id) || sameRef(p["route"], id) {
+			delete(s.entities["plugins"], pid)
+		}
+	}
+	for tid, t := range s.entities["targets"] {
+		if sameRef(t["upstream"], id) {
+			delete(s.entities["targets"], tid)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"kongctl/kong"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "apply":
+		runApply(os.Args[2:], false)
+	case "diff":
+		runApply(os.Args[2:], true)
+	case "generate":
+		runGenerate(os.Args[2:])
+	default:
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Println("Usage: kongctl <command> [flags]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  apply    - Apply a declarative config to the Kong Admin API")
+	fmt.Println("  diff     - Show the changes apply would make (same as apply -dry-run)")
+	fmt.Println("  generate - Generate a declarative config from annotated .proto files")
+	fmt.Println()
+	fmt.Println("Entities missing from the file are kept unless -prune is given.")
+	fmt.Println("Run 'kongctl <command> -h' for flags.")
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func runApply(args []string, diffOnly bool) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	file := fs.String("f", "kong.yaml", "declarative config file")
+	adminURL := fs.String("admin-url", getEnv("KONG_ADMIN_URL", "http://localhost:18001"), "Kong Admin API URL")
+	dryRun := fs.Bool("dry-run", diffOnly, "print the diff without changing Kong")
+	prune := fs.Bool("prune", false, "also delete services, routes, upstreams, targets and plugins not in the file (off by default)")
+	wait := fs.Duration("wait", 0, "wait up to this long for the Admin API to become ready")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*file)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	ctx := context.Background()
+	client := kong.NewClient(*adminURL)
+	if err := waitForKong(ctx, client, *wait); err != nil {
+		log.Fatalf("Kong Admin API not ready at %s: %v", *adminURL, err)
+	}
+
+	plan, err := buildPlan(ctx, client, cfg, *prune)
+	if err != nil {
+		log.Fatalf("Failed to compute diff: %v", err)
+	}
+
+	plan.Print(os.Stdout)
+	if *dryRun || plan.Empty() {
+		return
+	}
+
+	fmt.Println()
+	if err := plan.Apply(ctx, client, os.Stdout); err != nil {
+		log.Fatalf("Apply failed: %v", err)
+	}
+	fmt.Println("Kong configuration applied!")
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func runGenerate(args []string) {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	var importPaths stringList
+	fs.Var(&importPaths, "I", "import path for .proto files (repeatable, default ../proto)")
+	output := fs.String("o", "", "output file (default stdout)")
+	host := fs.String("host", "grpc-server", "upstream host for services without (kong.service).host")
+	port := fs.Int("port", 50051, "upstream port for services without (kong.service).port")
+	protocol := fs.String("protocol", "grpc", "upstream protocol for services without (kong.service).protocol")
+	routes := fs.String("routes", routePerMethod, "route per gRPC method, service or package")
+	protoDir := fs.String("proto-dir", "/kong/proto", "directory holding the .proto files inside Kong, for grpc-gateway")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: kongctl generate [flags] file.proto...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if len(importPaths) == 0 {
+		importPaths = stringList{"../proto"}
+	}
+
+	cfg, err := generateConfig(context.Background(), fs.Args(), generateOptions{
+		ImportPaths: importPaths,
+		Host:        *host,
+		Port:        *port,
+		Protocol:    *protocol,
+		RouteMode:   *routes,
+		ProtoDir:    *protoDir,
+	})
+	if err != nil {
+		log.Fatalf("Failed to generate config: %v", err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Generated by kongctl generate from %s. DO NOT EDIT.\n", strings.Join(fs.Args(), ", "))
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		log.Fatalf("Failed to encode config: %v", err)
+	}
+	out := buf.Bytes()
+
+	if *output == "" {
+		os.Stdout.Write(out)
+		return
+	}
+	if err := os.WriteFile(*output, out, 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *output, err)
+	}
+	fmt.Printf("Wrote %s\n", *output)
+}
+
+func waitForKong(ctx context.Context, client *kong.Client, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := client.Status(ctx)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		log.Println("Waiting for Kong to be ready...")
+		time.Sleep(2 * time.Second)
+	}
+}
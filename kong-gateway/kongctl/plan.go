@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"kongctl/kong"
+)
+
+type action string
+
+const (
+	actionCreate action = "+"
+	actionUpdate action = "~"
+	actionDelete action = "-"
+)
+
+// fieldDiff is a changed field; Old is nil for creates.
+type fieldDiff struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+// change is a single Admin API write needed to reach the declared state.
+type change struct {
+	Action action
+	Kind   string
+	Name   string
+	Diffs  []fieldDiff
+	apply  func(ctx context.Context, c *kong.Client) error
+}
+
+// Plan is the ordered list of changes between a Config and the live Admin API.
+type Plan struct {
+	Changes []change
+}
+
+// liveState is the current Admin API configuration keyed the way Config is.
+type liveState struct {
+	services  map[string]kong.Service
+	routes    map[string]kong.Route
+	upstreams map[string]kong.Upstream
+	targets   map[string]map[string]kong.Target
+	plugins   map[string]kong.Plugin
+
+	serviceNames map[string]string
+	routeNames   map[string]string
+}
+
+// nameOrID keys unnamed entities (created outside kongctl) by ID.
+func nameOrID(name, id string) string {
+	if name != "" {
+		return name
+	}
+	return id
+}
+
+func fetchState(ctx context.Context, c *kong.Client) (*liveState, error) {
+	st := &liveState{
+		services:     make(map[string]kong.Service),
+		routes:       make(map[string]kong.Route),
+		upstreams:    make(map[string]kong.Upstream),
+		targets:      make(map[string]map[string]kong.Target),
+		plugins:      make(map[string]kong.Plugin),
+		serviceNames: make(map[string]string),
+		routeNames:   make(map[string]string),
+	}
+
+	services, err := c.ListServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, s := range services {
+		key := nameOrID(s.Name, s.ID)
+		st.services[key] = s
+		st.serviceNames[s.ID] = key
+	}
+
+	routes, err := c.ListRoutes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %w", err)
+	}
+	for _, r := range routes {
+		key := nameOrID(r.Name, r.ID)
+		st.routes[key] = r
+		st.routeNames[r.ID] = key
+	}
+
+	upstreams, err := c.ListUpstreams(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upstreams: %w", err)
+	}
+	for _, u := range upstreams {
+		key := nameOrID(u.Name, u.ID)
+		st.upstreams[key] = u
+		targets, err := c.ListTargets(ctx, u.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list targets of %s: %w", key, err)
+		}
+		st.targets[key] = make(map[string]kong.Target)
+		for _, t := range targets {
+			st.targets[key][t.Target] = t
+		}
+	}
+
+	plugins, err := c.ListPlugins(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plugins: %w", err)
+	}
+	for _, p := range plugins {
+		if p.Consumer != nil {
+			// Consumer-scoped plugins are not managed by kongctl.
+			continue
+		}
+		if p.Service != nil {
+			p.Service.Name = st.serviceNames[p.Service.ID]
+		}
+		if p.Route != nil {
+			p.Route.Name = st.routeNames[p.Route.ID]
+		}
+		st.plugins[pluginKey(p)] = p
+	}
+	return st, nil
+}
+
+// buildPlan compares cfg with the live Admin API. With prune, entities that
+// are not declared in cfg are deleted.
+func buildPlan(ctx context.Context, c *kong.Client, cfg *Config, prune bool) (*Plan, error) {
+	st, err := fetchState(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plan{}
+	p.planUpstreams(cfg, st)
+	p.planServices(cfg, st)
+	p.planPlugins(cfg, st)
+	if prune {
+		p.planDeletes(cfg, st)
+	}
+	return p, nil
+}
+
+func (p *Plan) add(a action, kind, name string, diffs []fieldDiff, apply func(context.Context, *kong.Client) error) {
+	p.Changes = append(p.Changes, change{Action: a, Kind: kind, Name: name, Diffs: diffs, apply: apply})
+}
+
+func (p *Plan) planUpstreams(cfg *Config, st *liveState) {
+	for _, u := range cfg.Upstreams {
+		upsert := func(ctx context.Context, c *kong.Client) error {
+			_, err := c.UpsertUpstream(ctx, u)
+			return err
+		}
+		if live, ok := st.upstreams[u.Name]; !ok {
+			p.add(actionCreate, "upstream", u.Name, diffEntity(u, nil), upsert)
+		} else if diffs := diffEntity(u, live); len(diffs) > 0 {
+			p.add(actionUpdate, "upstream", u.Name, diffs, upsert)
+		}
+
+		liveTargets := st.targets[u.Name]
+		for _, t := range u.Targets {
+			name := fmt.Sprintf("%s (upstream %s)", t.Target, u.Name)
+			live, ok := liveTargets[t.Target]
+			if !ok {
+				p.add(actionCreate, "target", name, diffEntity(t, nil), func(ctx context.Context, c *kong.Client) error {
+					_, err := c.CreateTarget(ctx, u.Name, t)
+					return err
+				})
+			} else if diffs := diffEntity(t, live, "upstream"); len(diffs) > 0 {
+				p.add(actionUpdate, "target", name, diffs, func(ctx context.Context, c *kong.Client) error {
+					_, err := c.UpdateTarget(ctx, u.Name, live.ID, t)
+					return err
+				})
+			}
+		}
+	}
+}
+
+func (p *Plan) planServices(cfg *Config, st *liveState) {
+	for _, s := range cfg.Services {
+		upsert := func(ctx context.Context, c *kong.Client) error {
+			_, err := c.UpsertService(ctx, s)
+			return err
+		}
+		if live, ok := st.services[s.Name]; !ok {
+			p.add(actionCreate, "service", s.Name, diffEntity(s, nil), upsert)
+		} else if diffs := diffEntity(s, live); len(diffs) > 0 {
+			p.add(actionUpdate, "service", s.Name, diffs, upsert)
+		}
+	}
+
+	// Routes go after all services so they can move between services.
+	for _, s := range cfg.Services {
+		for _, r := range s.Routes {
+			r.Service = &kong.Ref{Name: s.Name}
+			upsert := func(ctx context.Context, c *kong.Client) error {
+				_, err := c.UpsertRoute(ctx, r)
+				return err
+			}
+			live, ok := st.routes[r.Name]
+			if !ok {
+				p.add(actionCreate, "route", r.Name, diffEntity(r, nil, "service"), upsert)
+				continue
+			}
+			diffs := diffEntity(r, live, "service")
+			if live.Service == nil || st.serviceNames[live.Service.ID] != s.Name {
+				var old interface{}
+				if live.Service != nil {
+					old = st.serviceNames[live.Service.ID]
+				}
+				diffs = append(diffs, fieldDiff{Path: "service", Old: old, New: s.Name})
+			}
+			if len(diffs) > 0 {
+				p.add(actionUpdate, "route", r.Name, diffs, upsert)
+			}
+		}
+	}
+}
+
+func (p *Plan) planPlugins(cfg *Config, st *liveState) {
+	for _, pl := range cfg.plugins() {
+		key := pluginKey(pl)
+		live, ok := st.plugins[key]
+		if !ok {
+			p.add(actionCreate, "plugin", key, diffEntity(pl, nil, "service", "route"), func(ctx context.Context, c *kong.Client) error {
+				_, err := c.CreatePlugin(ctx, pl)
+				return err
+			})
+		} else if diffs := diffEntity(pl, live, "service", "route"); len(diffs) > 0 {
+			p.add(actionUpdate, "plugin", key, diffs, func(ctx context.Context, c *kong.Client) error {
+				_, err := c.ReplacePlugin(ctx, live.ID, pl)
+				return err
+			})
+		}
+	}
+}
+
+// planDeletes removes undeclared entities, dependents first.
+func (p *Plan) planDeletes(cfg *Config, st *liveState) {
+	declaredPlugins := make(map[string]bool)
+	for _, pl := range cfg.plugins() {
+		declaredPlugins[pluginKey(pl)] = true
+	}
+	declaredServices := make(map[string]bool)
+	declaredRoutes := make(map[string]bool)
+	for _, s := range cfg.Services {
+		declaredServices[s.Name] = true
+		for _, r := range s.Routes {
+			declaredRoutes[r.Name] = true
+		}
+	}
+	declaredTargets := make(map[string]map[string]bool)
+	for _, u := range cfg.Upstreams {
+		declaredTargets[u.Name] = make(map[string]bool)
+		for _, t := range u.Targets {
+			declaredTargets[u.Name][t.Target] = true
+		}
+	}
+
+	for _, key := range sortedKeys(st.plugins) {
+		if declaredPlugins[key] {
+			continue
+		}
+		id := st.plugins[key].ID
+		p.add(actionDelete, "plugin", key, nil, func(ctx context.Context, c *kong.Client) error {
+			return ignoreNotFound(c.DeletePlugin(ctx, id))
+		})
+	}
+	for _, name := range sortedKeys(st.routes) {
+		if declaredRoutes[name] {
+			continue
+		}
+		id := st.routes[name].ID
+		p.add(actionDelete, "route", name, nil, func(ctx context.Context, c *kong.Client) error {
+			return ignoreNotFound(c.DeleteRoute(ctx, id))
+		})
+	}
+	for _, name := range sortedKeys(st.services) {
+		if declaredServices[name] {
+			continue
+		}
+		id := st.services[name].ID
+		p.add(actionDelete, "service", name, nil, func(ctx context.Context, c *kong.Client) error {
+			return ignoreNotFound(c.DeleteService(ctx, id))
+		})
+	}
+	for _, upstream := range sortedKeys(st.upstreams) {
+		declared, ok := declaredTargets[upstream]
+		if !ok {
+			// Deleting the upstream removes its targets.
+			id := st.upstreams[upstream].ID
+			p.add(actionDelete, "upstream", upstream, nil, func(ctx context.Context, c *kong.Client) error {
+				return ignoreNotFound(c.DeleteUpstream(ctx, id))
+			})
+			continue
+		}
+		for _, target := range sortedKeys(st.targets[upstream]) {
+			if declared[target] {
+				continue
+			}
+			upstreamID, id := st.upstreams[upstream].ID, st.targets[upstream][target].ID
+			p.add(actionDelete, "target", fmt.Sprintf("%s (upstream %s)", target, upstream), nil, func(ctx context.Context, c *kong.Client) error {
+				return ignoreNotFound(c.DeleteTarget(ctx, upstreamID, id))
+			})
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ignoreNotFound treats already-deleted entities (e.g. cascaded plugins) as success.
+func ignoreNotFound(err error) error {
+	if kong.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// toMap converts an entity to its Admin API JSON form.
+func toMap(v interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	if v == nil || reflect.ValueOf(v).IsZero() {
+		return m
+	}
+	b, _ := json.Marshal(v)
+	json.Unmarshal(b, &m)
+	return m
+}
+
+// diffEntity compares the fields set in desired with live. Fields the file
+// leaves out are not compared, since Kong fills them with defaults.
+func diffEntity(desired, live interface{}, ignore ...string) []fieldDiff {
+	d := toMap(desired)
+	for _, k := range append(ignore, "id", "created_at", "updated_at") {
+		delete(d, k)
+	}
+	if live == nil {
+		return diffMaps("", d, map[string]interface{}{})
+	}
+	return diffMaps("", d, toMap(live))
+}
+
+func diffMaps(prefix string, desired, live map[string]interface{}) []fieldDiff {
+	var diffs []fieldDiff
+	for _, k := range sortedKeys(desired) {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		dv, lv := desired[k], live[k]
+		dm, dIsMap := dv.(map[string]interface{})
+		lm, lIsMap := lv.(map[string]interface{})
+		if dIsMap && (lIsMap || lv == nil) {
+			diffs = append(diffs, diffMaps(path, dm, lm)...)
+			continue
+		}
+		if !reflect.DeepEqual(dv, lv) {
+			diffs = append(diffs, fieldDiff{Path: path, Old: lv, New: dv})
+		}
+	}
+	return diffs
+}
+
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+func formatValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// Print writes a human-readable diff of the plan.
+func (p *Plan) Print(w io.Writer) {
+	counts := make(map[action]int)
+	for _, ch := range p.Changes {
+		counts[ch.Action]++
+		fmt.Fprintf(w, "%s %s %s\n", ch.Action, ch.Kind, ch.Name)
+		for _, d := range ch.Diffs {
+			if ch.Action == actionCreate {
+				fmt.Fprintf(w, "    %s: %s\n", d.Path, formatValue(d.New))
+			} else {
+				fmt.Fprintf(w, "    %s: %s => %s\n", d.Path, formatValue(d.Old), formatValue(d.New))
+			}
+		}
+	}
+	if p.Empty() {
+		fmt.Fprintln(w, "No changes. Kong matches the declared configuration.")
+		return
+	}
+	fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to delete.\n",
+		counts[actionCreate], counts[actionUpdate], counts[actionDelete])
+}
+
+// Apply performs the changes in order and stops at the first failure.
+func (p *Plan) Apply(ctx context.Context, c *kong.Client, log io.Writer) error {
+	for i, ch := range p.Changes {
+		if err := ch.apply(ctx, c); err != nil {
+			return fmt.Errorf("%s %s %s (change %d of %d): %w", ch.Action, ch.Kind, ch.Name, i+1, len(p.Changes), err)
+		}
+		fmt.Fprintf(log, "%s %s %s\n", ch.Action, ch.Kind, ch.Name)
+	}
+	return nil
+}
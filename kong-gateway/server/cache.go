@@ -0,0 +1,225 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"grpc-server/pb/cachepb"
+)
+
+// cacheHeader reports hit, miss or bypass on responses of cacheable methods.
+const cacheHeader = "x-response-cache"
+
+// responseCacheConfig bounds the in-memory cache for methods marked with the
+// (cache.policy) method option.
+type responseCacheConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	MaxEntries int  `yaml:"max_entries"`
+	// MaxBytes bounds the serialized size of cached keys and responses.
+	MaxBytes int `yaml:"max_bytes"`
+	// DefaultTTL applies to methods whose policy sets no ttl_seconds.
+	DefaultTTL time.Duration `yaml:"default_ttl"`
+}
+
+func (c responseCacheConfig) validate() error {
+	var errs []error
+	if c.MaxEntries <= 0 {
+		errs = append(errs, errors.New("max_entries must be positive"))
+	}
+	if c.MaxBytes <= 0 {
+		errs = append(errs, errors.New("max_bytes must be positive"))
+	}
+	if c.DefaultTTL <= 0 {
+		errs = append(errs, errors.New("default_ttl must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+type cacheEntry struct {
+	key     string
+	resp    proto.Message
+	size    int
+	expires time.Time
+}
+
+// responseCache is an LRU cache of unary responses keyed by full method and
+// deterministically serialized request. It is also a Prometheus collector.
+type responseCache struct {
+	cfg      responseCacheConfig
+	policies sync.Map // full method -> *cachepb.CachePolicy, nil if not cacheable
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // of *cacheEntry, most recently used first
+	bytes   int
+
+	requests    *prometheus.CounterVec
+	evictions   *prometheus.CounterVec
+	entriesDesc *prometheus.Desc
+	bytesDesc   *prometheus.Desc
+}
+
+func newResponseCache(cfg responseCacheConfig, reg prometheus.Registerer) *responseCache {
+	c := &responseCache{
+		cfg:     cfg,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_response_cache_requests_total",
+			Help: "Total number of RPCs to cacheable methods, by result (hit, miss or bypass).",
+		}, []string{"grpc_service", "grpc_method", "result"}),
+		evictions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_response_cache_evictions_total",
+			Help: "Total number of cached responses removed, by reason (expired or capacity).",
+		}, []string{"reason"}),
+		entriesDesc: prometheus.NewDesc("grpc_server_response_cache_entries",
+			"Number of cached responses.", nil, nil),
+		bytesDesc: prometheus.NewDesc("grpc_server_response_cache_bytes",
+			"Serialized size of cached keys and responses.", nil, nil),
+	}
+	reg.MustRegister(c)
+	return c
+}
+
+func (c *responseCache) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.evictions.Describe(ch)
+	ch <- c.entriesDesc
+	ch <- c.bytesDesc
+}
+
+func (c *responseCache) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.evictions.Collect(ch)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(c.entriesDesc, prometheus.GaugeValue, float64(c.lru.Len()))
+	ch <- prometheus.MustNewConstMetric(c.bytesDesc, prometheus.GaugeValue, float64(c.bytes))
+}
+
+// policy returns the (cache.policy) option of a unary method, or nil.
+func (c *responseCache) policy(fullMethod string) *cachepb.CachePolicy {
+	if p, ok := c.policies.Load(fullMethod); ok {
+		return p.(*cachepb.CachePolicy)
+	}
+	var policy *cachepb.CachePolicy
+	service, method := splitMethodName(fullMethod)
+	if d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service)); err == nil {
+		if sd, ok := d.(protoreflect.ServiceDescriptor); ok {
+			md := sd.Methods().ByName(protoreflect.Name(method))
+			if md != nil && !md.IsStreamingClient() && !md.IsStreamingServer() && proto.HasExtension(md.Options(), cachepb.E_Policy) {
+				policy = proto.GetExtension(md.Options(), cachepb.E_Policy).(*cachepb.CachePolicy)
+			}
+		}
+	}
+	c.policies.Store(fullMethod, policy)
+	return policy
+}
+
+func (c *responseCache) get(key string) proto.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(el, "expired")
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return entry.resp
+}
+
+func (c *responseCache) put(key string, resp proto.Message, ttl time.Duration) {
+	size := len(key) + proto.Size(resp)
+	if size > c.cfg.MaxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el, "")
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, resp: resp, size: size, expires: time.Now().Add(ttl)})
+	c.bytes += size
+	for c.lru.Len() > c.cfg.MaxEntries || c.bytes > c.cfg.MaxBytes {
+		c.remove(c.lru.Back(), "capacity")
+	}
+}
+
+// remove deletes el and counts the eviction unless reason is empty. c.mu must be held.
+func (c *responseCache) remove(el *list.Element, reason string) {
+	entry := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+	if reason != "" {
+		c.evictions.WithLabelValues(reason).Inc()
+	}
+}
+
+// noCache reports whether the client sent "cache-control: no-cache", which
+// skips the lookup but still refreshes the cached response.
+func noCache(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("cache-control") {
+		if strings.Contains(strings.ToLower(v), "no-cache") {
+			return true
+		}
+	}
+	return false
+}
+
+// unaryInterceptor serves cacheable methods from the cache and stores their
+// OK responses. Cached responses are shared between RPCs and only read when
+// they are serialized, so the handler's response is cloned once on store.
+func (c *responseCache) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	policy := c.policy(info.FullMethod)
+	msg, ok := req.(proto.Message)
+	if policy == nil || !ok {
+		return handler(ctx, req)
+	}
+	reqBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return handler(ctx, req)
+	}
+	key := info.FullMethod + "\x00" + string(reqBytes)
+	service, method := splitMethodName(info.FullMethod)
+
+	result := "bypass"
+	if !noCache(ctx) {
+		if resp := c.get(key); resp != nil {
+			c.requests.WithLabelValues(service, method, "hit").Inc()
+			grpc.SetHeader(ctx, metadata.Pairs(cacheHeader, "hit"))
+			return resp, nil
+		}
+		result = "miss"
+	}
+	c.requests.WithLabelValues(service, method, result).Inc()
+	grpc.SetHeader(ctx, metadata.Pairs(cacheHeader, result))
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	if m, ok := resp.(proto.Message); ok {
+		ttl := c.cfg.DefaultTTL
+		if s := policy.GetTtlSeconds(); s > 0 {
+			ttl = time.Duration(s) * time.Second
+		}
+		c.put(key, proto.Clone(m), ttl)
+	}
+	return resp, nil
+}
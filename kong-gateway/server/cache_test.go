@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"grpc-server/encoding/zstd"
+	pb "grpc-server/pb"
+)
+
+func TestResponseCache(t *testing.T) {
+	s := newTestServer(t, func(c *serverConfig) { c.ResponseCache.Enabled = true })
+	ctx := context.Background()
+
+	sayHello := func(ctx context.Context, name string) string {
+		t.Helper()
+		var header metadata.MD
+		if _, err := s.client.SayHello(ctx, &pb.HelloRequest{Name: name}, grpc.Header(&header)); err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+		return strings.Join(header.Get(cacheHeader), ",")
+	}
+
+	if got := sayHello(ctx, "Cache"); got != "miss" {
+		t.Errorf("first call: %s = %q, want miss", cacheHeader, got)
+	}
+	if got := sayHello(ctx, "Cache"); got != "hit" {
+		t.Errorf("second call: %s = %q, want hit", cacheHeader, got)
+	}
+	if got := sayHello(ctx, "Other"); got != "miss" {
+		t.Errorf("different request: %s = %q, want miss", cacheHeader, got)
+	}
+	noCache := metadata.AppendToOutgoingContext(ctx, "cache-control", "no-cache")
+	if got := sayHello(noCache, "Cache"); got != "bypass" {
+		t.Errorf("cache-control: no-cache: %s = %q, want bypass", cacheHeader, got)
+	}
+
+	// Hits skip the handler but are still counted as handled RPCs.
+	hits := s.counter(t, "grpc_server_response_cache_requests_total", map[string]string{"grpc_method": "SayHello", "result": "hit"})
+	handled := s.counter(t, "grpc_server_handled_total", map[string]string{"grpc_method": "SayHello", "grpc_code": "OK"})
+	if hits != 1 || handled != 4 {
+		t.Errorf("hits = %v, handled = %v; want 1 and 4", hits, handled)
+	}
+
+	// Streams and methods without (cache.policy) are not cached.
+	var header metadata.MD
+	stream, err := s.client.SayHelloServerStream(ctx, &pb.HelloRequest{Name: "Cache", Count: proto.Uint32(1)}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("SayHelloServerStream: %v", err)
+	}
+	if _, err := recvAll(stream); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if got := header.Get(cacheHeader); len(got) != 0 {
+		t.Errorf("stream %s = %q, want none", cacheHeader, got)
+	}
+}
+
+func TestResponseCacheBounds(t *testing.T) {
+	c := newResponseCache(responseCacheConfig{MaxEntries: 2, MaxBytes: 1 << 10, DefaultTTL: time.Minute}, prometheus.NewRegistry())
+	resp := func(msg string) proto.Message { return &pb.HelloResponse{Message: msg} }
+
+	c.put("a", resp("a"), time.Minute)
+	c.put("b", resp("b"), time.Minute)
+	c.get("a") // a is now more recently used than b
+	c.put("c", resp("c"), time.Minute)
+	if c.get("b") != nil {
+		t.Error("least recently used entry was not evicted")
+	}
+	if c.get("a") == nil || c.get("c") == nil {
+		t.Error("recently used entries were evicted")
+	}
+
+	c.put("short", resp("short"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if c.get("short") != nil {
+		t.Error("expired entry was returned")
+	}
+
+	c.put("big", resp(strings.Repeat("x", 2<<10)), time.Minute)
+	if c.get("big") != nil {
+		t.Error("entry larger than max_bytes was cached")
+	}
+	if c.bytes > c.cfg.MaxBytes || c.lru.Len() > c.cfg.MaxEntries {
+		t.Errorf("cache holds %d entries, %d bytes; over its bounds", c.lru.Len(), c.bytes)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	if _, err := parseCompression("zstd,brotli"); err == nil {
+		t.Error("parseCompression accepted an unregistered compressor")
+	}
+
+	s := newTestServer(t, func(c *serverConfig) {
+		c.Compression = "zstd,gzip"
+		c.CompressionMinSize = 0
+		c.ResponseCache.Enabled = true
+	})
+	for _, name := range []string{zstd.Name, "gzip"} {
+		for i := 0; i < 2; i++ { // the second call is a cache hit
+			resp, err := s.client.SayHello(context.Background(), &pb.HelloRequest{Name: "Zip"}, grpc.UseCompressor(name))
+			if err != nil {
+				t.Fatalf("SayHello with %s: %v", name, err)
+			}
+			if !strings.Contains(resp.GetMessage(), "Hello, Zip!") {
+				t.Errorf("SayHello with %s = %q", name, resp.GetMessage())
+			}
+		}
+	}
+	stream, err := s.client.SayHelloServerStream(context.Background(), &pb.HelloRequest{Name: "Zip", Count: proto.Uint32(3), IntervalMs: proto.Uint32(0)})
+	if err != nil {
+		t.Fatalf("SayHelloServerStream: %v", err)
+	}
+	if messages, err := recvAll(stream); err != nil || len(messages) != 3 {
+		t.Errorf("stream got %d messages, err %v", len(messages), err)
+	}
+}
@@ -0,0 +1,318 @@
+// Package client is a Go SDK for HelloService. It wraps the generated
+// pb.HelloServiceClient with connection settings suitable for calling the
+// server directly or through the Kong gRPC proxy.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // registers the gzip compressor
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+
+	_ "grpc-server/encoding/zstd" // registers the zstd compressor
+	pb "grpc-server/pb"
+)
+
+// InstanceIDHeader is the header and trailer naming the server replica that
+// handled a call.
+const InstanceIDHeader = "x-instance-id"
+
+// Client calls HelloService over a single gRPC connection, which may be
+// balanced across several targets.
+type Client struct {
+	conn  *grpc.ClientConn
+	hello pb.HelloServiceClient
+}
+
+// RetryPolicy configures transparent retries through the gRPC service config.
+type RetryPolicy struct {
+	MaxAttempts       int
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	RetryableCodes    []codes.Code
+}
+
+// DefaultRetryPolicy retries calls rejected by an unavailable server or by
+// rate limiting in Kong or the server.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:       4,
+	InitialBackoff:    100 * time.Millisecond,
+	MaxBackoff:        2 * time.Second,
+	BackoffMultiplier: 2,
+	RetryableCodes:    []codes.Code{codes.Unavailable, codes.ResourceExhausted},
+}
+
+type options struct {
+	tlsConfig   *tls.Config
+	token       string
+	retry       *RetryPolicy
+	keepalive   *keepalive.ClientParameters
+	userAgent   string
+	compressor  string
+	dialOptions []grpc.DialOption
+}
+
+// Option configures a Client.
+type Option func(*options) error
+
+// WithTLS enables TLS. caFile verifies the server (system roots if empty);
+// certFile and keyFile present a client certificate for mTLS.
+func WithTLS(caFile, certFile, keyFile string) Option {
+	return func(o *options) error {
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return fmt.Errorf("failed to read CA %s: %w", caFile, err)
+			}
+			cfg.RootCAs = x509.NewCertPool()
+			if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificates found in %s", caFile)
+			}
+		}
+		if certFile != "" || keyFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+		o.tlsConfig = cfg
+		return nil
+	}
+}
+
+// WithTLSConfig enables TLS with a custom configuration.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) error {
+		o.tlsConfig = cfg
+		return nil
+	}
+}
+
+// WithAuthToken sends "authorization: Bearer <token>" with every call, e.g.
+// for Kong's jwt or key-auth plugins.
+func WithAuthToken(token string) Option {
+	return func(o *options) error {
+		o.token = token
+		return nil
+	}
+}
+
+// WithRetry enables retries with the given policy.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *options) error {
+		if p.MaxAttempts < 2 {
+			return fmt.Errorf("retry policy needs at least 2 attempts, got %d", p.MaxAttempts)
+		}
+		o.retry = &p
+		return nil
+	}
+}
+
+// WithKeepalive pings the server after time without activity. The server
+// rejects pings more frequent than its keepalive min_time (10s by default).
+func WithKeepalive(time, timeout time.Duration) Option {
+	return func(o *options) error {
+		o.keepalive = &keepalive.ClientParameters{Time: time, Timeout: timeout, PermitWithoutStream: true}
+		return nil
+	}
+}
+
+// WithUserAgent sets the user-agent prefix sent to the server.
+func WithUserAgent(ua string) Option {
+	return func(o *options) error {
+		o.userAgent = ua
+		return nil
+	}
+}
+
+// WithCompression compresses requests with "gzip" or "zstd". Responses are
+// decompressed either way; the client accepts both, and the server picks one
+// according to its -compression setting.
+func WithCompression(name string) Option {
+	return func(o *options) error {
+		if encoding.GetCompressor(name) == nil {
+			return fmt.Errorf("unknown compressor %q", name)
+		}
+		o.compressor = name
+		return nil
+	}
+}
+
+// WithDialOptions appends raw gRPC dial options.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) error {
+		o.dialOptions = append(o.dialOptions, opts...)
+		return nil
+	}
+}
+
+// New connects to targets ("host:port" or any gRPC target URI). Several
+// targets are balanced round robin on one connection, as are the addresses
+// of a single "dns:///host:port" target or an endpoint file target
+// ("file:///path", see FileScheme). Several targets must be "host:port";
+// with TLS each is verified against its own host.
+func New(targets []string, opts ...Option) (*Client, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("at least one target is required")
+	}
+	var o options
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithDefaultServiceConfig(serviceConfig(o.retry)),
+		grpc.WithResolvers(fileResolverBuilder{}),
+	}
+	if o.tlsConfig != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(o.tlsConfig)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if o.token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(bearerToken{token: o.token, secure: o.tlsConfig != nil}))
+	}
+	if o.keepalive != nil {
+		dialOpts = append(dialOpts, grpc.WithKeepaliveParams(*o.keepalive))
+	}
+	if o.userAgent != "" {
+		dialOpts = append(dialOpts, grpc.WithUserAgent(o.userAgent))
+	}
+	if o.compressor != "" {
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(o.compressor)))
+	}
+
+	target := targets[0]
+	if len(targets) > 1 {
+		r := manual.NewBuilderWithScheme("hello-lb")
+		// The joined target is no host name, so each address carries its own
+		// for TLS verification unless the TLS config sets ServerName.
+		addrs := make([]resolver.Address, len(targets))
+		for i, t := range targets {
+			host, _, err := net.SplitHostPort(t)
+			if err != nil {
+				return nil, fmt.Errorf("target %q: %w", t, err)
+			}
+			addrs[i] = resolver.Address{Addr: t, ServerName: host}
+		}
+		r.InitialState(resolver.State{Addresses: addrs})
+		dialOpts = append(dialOpts, grpc.WithResolvers(r))
+		target = r.Scheme() + ":///" + strings.Join(targets, ",")
+	}
+	dialOpts = append(dialOpts, o.dialOptions...)
+
+	conn, err := grpc.NewClient(target, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for %s: %w", target, err)
+	}
+	return &Client{conn: conn, hello: pb.NewHelloServiceClient(conn)}, nil
+}
+
+// serviceConfig returns the default service config: round robin across
+// resolved addresses and, if enabled, retries for HelloService.
+func serviceConfig(retry *RetryPolicy) string {
+	cfg := map[string]interface{}{
+		"loadBalancingConfig": []interface{}{map[string]interface{}{"round_robin": map[string]interface{}{}}},
+	}
+	if retry != nil {
+		cfg["methodConfig"] = []interface{}{map[string]interface{}{
+			"name": []interface{}{map[string]interface{}{"service": "hello.HelloService"}},
+			"retryPolicy": map[string]interface{}{
+				"maxAttempts":          retry.MaxAttempts,
+				"initialBackoff":       seconds(retry.InitialBackoff),
+				"maxBackoff":           seconds(retry.MaxBackoff),
+				"backoffMultiplier":    retry.BackoffMultiplier,
+				"retryableStatusCodes": retry.RetryableCodes,
+			},
+		}}
+	}
+	out, _ := json.Marshal(cfg)
+	return string(out)
+}
+
+// seconds formats d as a service config duration, e.g. "0.1s".
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%gs", d.Seconds())
+}
+
+// Close closes the underlying connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Conn returns the underlying connection, e.g. for health checks.
+func (c *Client) Conn() *grpc.ClientConn {
+	return c.conn
+}
+
+// SayHello calls HelloService.SayHello.
+func (c *Client) SayHello(ctx context.Context, req *pb.HelloRequest, opts ...grpc.CallOption) (*pb.HelloResponse, error) {
+	return c.hello.SayHello(ctx, req, opts...)
+}
+
+// SayHelloStream calls HelloService.SayHelloServerStream and yields each
+// response. Breaking out of the loop cancels the stream.
+func (c *Client) SayHelloStream(ctx context.Context, req *pb.HelloRequest, opts ...grpc.CallOption) iter.Seq2[*pb.HelloResponse, error] {
+	return func(yield func(*pb.HelloResponse, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		stream, err := c.hello.SayHelloServerStream(ctx, req, opts...)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(resp, nil) {
+				return
+			}
+		}
+	}
+}
+
+// bearerToken implements credentials.PerRPCCredentials.
+type bearerToken struct {
+	token  string
+	secure bool
+}
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+// RequireTransportSecurity is false for plaintext connections, since the
+// demo Kong gRPC proxy (19080) listens without TLS.
+func (t bearerToken) RequireTransportSecurity() bool {
+	return t.secure
+}
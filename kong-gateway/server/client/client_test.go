@@ -0,0 +1,229 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	pb "grpc-server/pb"
+)
+
+// greeter echoes the authorization metadata and streams count greetings.
+type greeter struct {
+	pb.UnimplementedHelloServiceServer
+}
+
+func (greeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return &pb.HelloResponse{Message: fmt.Sprint(md.Get("authorization"))}, nil
+}
+
+func (greeter) SayHelloServerStream(req *pb.HelloRequest, stream grpc.ServerStreamingServer[pb.HelloResponse]) error {
+	for i := 0; ; i++ {
+		if err := stream.Send(&pb.HelloResponse{Message: fmt.Sprintf("Hello, %s! (%d)", req.GetName(), i)}); err != nil {
+			return err
+		}
+		if i == 9 {
+			return nil
+		}
+	}
+}
+
+func startGreeter(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterHelloServiceServer(s, greeter{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+// localhostCert returns a self-signed certificate for "localhost" and a pool
+// trusting it.
+func localhostCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func startTLSReplica(t *testing.T, id string, cert tls.Certificate) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
+	pb.RegisterHelloServiceServer(s, replica{id: id})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		opts    []Option
+	}{
+		{"no targets", nil, nil},
+		{"one retry attempt", []string{"localhost:50051"}, []Option{WithRetry(RetryPolicy{MaxAttempts: 1})}},
+		{"unknown compressor", []string{"localhost:50051"}, []Option{WithCompression("br")}},
+		{"missing CA file", []string{"localhost:50051"}, []Option{WithTLS("/nonexistent/ca.pem", "", "")}},
+		{"target without port", []string{"localhost:50051", "localhost"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.targets, tt.opts...)
+			if err == nil {
+				c.Close()
+				t.Fatal("New succeeded, want error")
+			}
+		})
+	}
+}
+
+// TestMultiTargetTLS checks that each target is verified against its own
+// host rather than the joined "hello-lb:///a,b" target.
+func TestMultiTargetTLS(t *testing.T) {
+	cert, pool := localhostCert(t)
+	var targets []string
+	for _, id := range []string{"a", "b"} {
+		_, port, _ := net.SplitHostPort(startTLSReplica(t, id, cert))
+		targets = append(targets, net.JoinHostPort("localhost", port))
+	}
+
+	c, err := New(targets, WithTLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close()
+	if seen := instances(t, c, 10); seen["a"] == 0 || seen["b"] == 0 {
+		t.Errorf("calls per instance = %v, want both a and b", seen)
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	c, err := New([]string{startGreeter(t)}, WithAuthToken("secret"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := c.SayHello(ctx, &pb.HelloRequest{Name: "SDK"})
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if want := "[Bearer secret]"; resp.GetMessage() != want {
+		t.Errorf("authorization = %s, want %s", resp.GetMessage(), want)
+	}
+}
+
+func TestSayHelloStream(t *testing.T) {
+	c, err := New([]string{startGreeter(t)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var n int
+	for _, err := range c.SayHelloStream(ctx, &pb.HelloRequest{Name: "SDK"}) {
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		n++
+	}
+	if n != 10 {
+		t.Errorf("received %d messages, want 10", n)
+	}
+
+	n = 0
+	for _, err := range c.SayHelloStream(ctx, &pb.HelloRequest{Name: "SDK"}) {
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		if n++; n == 3 {
+			break
+		}
+	}
+	if n != 3 {
+		t.Errorf("received %d messages before break, want 3", n)
+	}
+}
+
+func TestErrorDetails(t *testing.T) {
+	st, err := status.New(codes.ResourceExhausted, "slow down").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(250 * time.Millisecond),
+	})
+	if err != nil {
+		t.Fatalf("WithDetails: %v", err)
+	}
+	if d, ok := RetryDelay(st.Err()); !ok || d != 250*time.Millisecond {
+		t.Errorf("RetryDelay = %v, %v; want 250ms, true", d, ok)
+	}
+	if _, ok := RetryDelay(status.Error(codes.Unavailable, "down")); ok {
+		t.Error("RetryDelay found a delay without RetryInfo")
+	}
+
+	st, err = status.New(codes.InvalidArgument, "invalid").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "name", Description: "must not be empty"},
+			{Field: "name", Description: "too long"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("WithDetails: %v", err)
+	}
+	if got := FieldViolations(st.Err())["name"]; len(got) != 2 || got[0] != "must not be empty" {
+		t.Errorf("FieldViolations[name] = %v", got)
+	}
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// RetryDelay returns the delay suggested by a google.rpc.RetryInfo detail,
+// as sent by the server's rate limiter with RESOURCE_EXHAUSTED.
+func RetryDelay(err error) (time.Duration, bool) {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+// FieldViolations returns the google.rpc.BadRequest field violations of an
+// INVALID_ARGUMENT error, keyed by field path.
+func FieldViolations(err error) map[string][]string {
+	var out map[string][]string
+	for _, d := range status.Convert(err).Details() {
+		br, ok := d.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = make(map[string][]string)
+		}
+		for _, v := range br.GetFieldViolations() {
+			out[v.GetField()] = append(out[v.GetField()], v.GetDescription())
+		}
+	}
+	return out
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	"gopkg.in/yaml.v3"
+)
+
+// FileScheme is the target scheme of endpoint files, e.g.
+// "file:///etc/hello/endpoints.yaml". Like an xDS EDS response, the file lists
+// the endpoints of the service and their health; it is re-read when it
+// changes, so endpoints can be added or drained without restarting clients.
+//
+//	endpoints:
+//	  - address: localhost:50061
+//	  - address: localhost:50062
+//	    status: draining
+const FileScheme = "file"
+
+// filePollInterval is how often endpoint files are checked for changes.
+var filePollInterval = 2 * time.Second
+
+// EndpointFile is the format of an endpoint file (YAML or JSON).
+type EndpointFile struct {
+	Endpoints []Endpoint `yaml:"endpoints" json:"endpoints"`
+}
+
+// Endpoint is a server address. Endpoints with status "draining" or
+// "unhealthy" receive no new calls; an empty status means healthy.
+type Endpoint struct {
+	Address string `yaml:"address" json:"address"`
+	Status  string `yaml:"status,omitempty" json:"status,omitempty"`
+}
+
+func readEndpointFile(path string) ([]resolver.Address, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f EndpointFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	var addrs []resolver.Address
+	for i, ep := range f.Endpoints {
+		if ep.Address == "" {
+			return nil, fmt.Errorf("%s: endpoint %d has no address", path, i)
+		}
+		switch ep.Status {
+		case "", "healthy":
+			addrs = append(addrs, resolver.Address{Addr: ep.Address})
+		case "draining", "unhealthy":
+		default:
+			return nil, fmt.Errorf("%s: endpoint %s has unknown status %q", path, ep.Address, ep.Status)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%s: no healthy endpoints", path)
+	}
+	return addrs, nil
+}
+
+type fileResolverBuilder struct{}
+
+func (fileResolverBuilder) Scheme() string {
+	return FileScheme
+}
+
+func (fileResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	// file:///abs/path has a path; file:rel/path is opaque.
+	path := target.URL.Path
+	if path == "" {
+		path = target.URL.Opaque
+	}
+	if path == "" {
+		return nil, errors.New("endpoint file target needs a path, e.g. file:///etc/hello/endpoints.yaml")
+	}
+	r := &fileResolver{path: path, cc: cc, resolveNow: make(chan struct{}, 1), done: make(chan struct{})}
+	if err := r.update(); err != nil {
+		return nil, err
+	}
+	r.wg.Add(1)
+	go r.watch()
+	return r, nil
+}
+
+// fileResolver pushes the healthy endpoints of a file to the ClientConn
+// whenever the file's modification time or size changes.
+type fileResolver struct {
+	path       string
+	cc         resolver.ClientConn
+	resolveNow chan struct{}
+	done       chan struct{}
+	wg         sync.WaitGroup
+
+	modTime time.Time
+	size    int64
+}
+
+// update re-reads the file if it changed. On errors the last good endpoints
+// stay in use.
+func (r *fileResolver) update() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return nil
+	}
+	// Recorded before parsing so a broken file is reported once, not on every poll.
+	r.modTime, r.size = info.ModTime(), info.Size()
+	addrs, err := readEndpointFile(r.path)
+	if err != nil {
+		return err
+	}
+	return r.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+func (r *fileResolver) watch() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(filePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		case <-r.resolveNow:
+		}
+		if err := r.update(); err != nil {
+			r.cc.ReportError(err)
+		}
+	}
+}
+
+func (r *fileResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (r *fileResolver) Close() {
+	close(r.done)
+	r.wg.Wait()
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	pb "grpc-server/pb"
+)
+
+// replica is a HelloService that only reports its instance ID.
+type replica struct {
+	pb.UnimplementedHelloServiceServer
+	id string
+}
+
+func (r replica) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloResponse, error) {
+	grpc.SetHeader(ctx, metadata.Pairs(InstanceIDHeader, r.id))
+	return &pb.HelloResponse{Message: "Hello, " + req.GetName() + "!"}, nil
+}
+
+func startReplica(t *testing.T, id string) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterHelloServiceServer(s, replica{id: id})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func writeEndpoints(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write endpoints: %v", err)
+	}
+}
+
+// instances calls SayHello n times and counts the answering instances.
+func instances(t *testing.T, c *Client, n int) map[string]int {
+	t.Helper()
+	seen := make(map[string]int)
+	for i := 0; i < n; i++ {
+		var header metadata.MD
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := c.SayHello(ctx, &pb.HelloRequest{Name: "LB"}, grpc.Header(&header))
+		cancel()
+		if err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+		for _, id := range header.Get(InstanceIDHeader) {
+			seen[id]++
+		}
+	}
+	return seen
+}
+
+func TestFileResolver(t *testing.T) {
+	defer func(d time.Duration) { filePollInterval = d }(filePollInterval)
+	filePollInterval = 10 * time.Millisecond
+
+	a, b := startReplica(t, "a"), startReplica(t, "b")
+	path := filepath.Join(t.TempDir(), "endpoints.yaml")
+	writeEndpoints(t, path, "endpoints:\n  - address: "+a+"\n  - address: "+b+"\n")
+
+	c, err := New([]string{"file://" + path})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close()
+
+	// round_robin connects to both endpoints before spreading calls evenly.
+	deadline := time.Now().Add(5 * time.Second)
+	for seen := instances(t, c, 4); seen["a"] == 0 || seen["b"] == 0; seen = instances(t, c, 4) {
+		if time.Now().After(deadline) {
+			t.Fatalf("calls reached %v, want both a and b", seen)
+		}
+	}
+
+	// Draining b moves new calls to a once the file is re-read. The size
+	// changes too, so the update is noticed even with a coarse mtime.
+	writeEndpoints(t, path, "endpoints:\n  - address: "+a+"\n  - address: "+b+"\n    status: draining\n")
+	deadline = time.Now().Add(5 * time.Second)
+	for seen := instances(t, c, 4); seen["b"] != 0; seen = instances(t, c, 4) {
+		if time.Now().After(deadline) {
+			t.Fatalf("calls reached %v after draining b", seen)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestReadEndpointFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, content string
+		want          int
+	}{
+		{"yaml", "endpoints:\n  - address: a:1\n  - address: b:1\n    status: healthy\n", 2},
+		{"json", `{"endpoints": [{"address": "a:1"}, {"address": "b:1", "status": "unhealthy"}]}`, 1},
+		{"none healthy", "endpoints:\n  - address: a:1\n    status: draining\n", 0},
+		{"unknown status", "endpoints:\n  - address: a:1\n    status: sick\n", 0},
+		{"missing address", "endpoints:\n  - status: healthy\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			writeEndpoints(t, path, tt.content)
+			addrs, err := readEndpointFile(path)
+			if tt.want == 0 {
+				if err == nil {
+					t.Errorf("readEndpointFile = %v, want an error", addrs)
+				}
+				return
+			}
+			if err != nil || len(addrs) != tt.want {
+				t.Errorf("readEndpointFile = %v, %v; want %d addresses", addrs, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,432 @@
+// Command hello-bench measures Kong's overhead on HelloService by driving
+// the same load against the server directly and through the Kong gRPC proxy.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"grpc-server/client"
+	pb "grpc-server/pb"
+)
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// benchConfig is the load applied to every target and method.
+type benchConfig struct {
+	Targets        map[string]string `json:"targets"`
+	Methods        []string          `json:"methods"`
+	QPS            float64           `json:"qps"`
+	Concurrency    int               `json:"concurrency"`
+	Duration       string            `json:"duration"`
+	Warmup         string            `json:"warmup"`
+	Timeout        string            `json:"timeout"`
+	StreamCount    uint32            `json:"stream_count"`
+	StreamInterval string            `json:"stream_interval"`
+
+	duration, warmup, timeout, interval time.Duration
+	targetOrder                         []string
+}
+
+// result is the outcome of one target and method. Latency covers successful
+// calls only; for streams it is the time until the stream ends.
+type result struct {
+	Target       string         `json:"target"`
+	Addr         string         `json:"addr"`
+	Method       string         `json:"method"`
+	Elapsed      float64        `json:"elapsed_s"`
+	Requests     int            `json:"requests"`
+	Errors       int            `json:"errors"`
+	Throughput   float64        `json:"throughput_rps"`
+	MessageRate  float64        `json:"messages_per_second,omitempty"`
+	Latency      *latencyStats  `json:"latency"`
+	FirstMessage *latencyStats  `json:"first_message,omitempty"`
+	Codes        map[string]int `json:"codes"`
+	Histogram    []bucket       `json:"histogram"`
+}
+
+// overhead is the latency Kong adds to a method, i.e. kong minus direct.
+type overhead struct {
+	Method string  `json:"method"`
+	P50    float64 `json:"p50_ms"`
+	P95    float64 `json:"p95_ms"`
+	P99    float64 `json:"p99_ms"`
+}
+
+type report struct {
+	Config   benchConfig `json:"config"`
+	Results  []result    `json:"results"`
+	Overhead []overhead  `json:"kong_overhead,omitempty"`
+}
+
+func main() {
+	log.SetFlags(0)
+	fs := flag.NewFlagSet("hello-bench", flag.ExitOnError)
+	directAddr := fs.String("direct-addr", getEnv("HELLO_ADDR", "localhost:50051"), "gRPC server address")
+	kongAddr := fs.String("kong-addr", getEnv("KONG_GRPC_ADDR", "localhost:19080"), "Kong gRPC proxy address")
+	targets := fs.String("targets", "direct,kong", "comma-separated targets to benchmark: direct, kong")
+	methods := fs.String("methods", "say,stream", "comma-separated methods: say (SayHello), stream (SayHelloServerStream)")
+	qps := fs.Float64("qps", 100, "calls per second per target and method (0 = as fast as the workers go)")
+	concurrency := fs.Int("concurrency", 10, "concurrent workers sharing one connection")
+	duration := fs.Duration("duration", 10*time.Second, "measured duration per target and method")
+	warmup := fs.Duration("warmup", time.Second, "unmeasured warm-up before each run")
+	timeout := fs.Duration("timeout", 5*time.Second, "deadline per call")
+	name := fs.String("name", "bench", "name sent in each request")
+	count := fs.Uint("count", 5, "stream: messages per stream")
+	interval := fs.Duration("interval", 0, "stream: delay between messages")
+	useTLS := fs.Bool("tls", false, "connect with TLS")
+	caFile := fs.String("ca", "", "CA certificate for verifying the server (implies -tls)")
+	token := fs.String("token", getEnv("HELLO_TOKEN", ""), "bearer token sent as the authorization header")
+	jsonOut := fs.String("json", "", `write the report as JSON to this file ("-" for stdout instead of the table)`)
+	fs.Parse(os.Args[1:])
+
+	cfg := benchConfig{
+		Targets:        make(map[string]string),
+		QPS:            *qps,
+		Concurrency:    *concurrency,
+		Duration:       duration.String(),
+		Warmup:         warmup.String(),
+		Timeout:        timeout.String(),
+		StreamCount:    uint32(*count),
+		StreamInterval: interval.String(),
+		duration:       *duration,
+		warmup:         *warmup,
+		timeout:        *timeout,
+		interval:       *interval,
+	}
+	addrs := map[string]string{"direct": *directAddr, "kong": *kongAddr}
+	for _, t := range splitList(*targets) {
+		addr, ok := addrs[t]
+		if !ok {
+			log.Fatalf("Unknown target %q (want direct or kong)", t)
+		}
+		cfg.Targets[t] = addr
+		cfg.targetOrder = append(cfg.targetOrder, t)
+	}
+	for _, m := range splitList(*methods) {
+		if m != "say" && m != "stream" {
+			log.Fatalf("Unknown method %q (want say or stream)", m)
+		}
+		cfg.Methods = append(cfg.Methods, m)
+	}
+	switch {
+	case len(cfg.targetOrder) == 0 || len(cfg.Methods) == 0:
+		log.Fatal("At least one target and one method are required")
+	case cfg.QPS < 0 || cfg.Concurrency < 1 || cfg.duration <= 0 || cfg.StreamCount < 1:
+		log.Fatal("-qps must not be negative; -concurrency, -duration and -count must be positive")
+	}
+
+	// Retries would hide the errors we want to count, so none are configured.
+	opts := []client.Option{client.WithUserAgent("hello-bench")}
+	if *useTLS || *caFile != "" {
+		opts = append(opts, client.WithTLS(*caFile, "", ""))
+	}
+	if *token != "" {
+		opts = append(opts, client.WithAuthToken(*token))
+	}
+
+	// Ctrl-C stops the current run and reports what was measured so far.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	rep := report{Config: cfg}
+	for _, method := range cfg.Methods {
+		for _, target := range cfg.targetOrder {
+			if ctx.Err() != nil {
+				break
+			}
+			c, err := client.New([]string{cfg.Targets[target]}, opts...)
+			if err != nil {
+				log.Fatalf("Failed to create client for %s: %v", target, err)
+			}
+			log.Printf("Running %s against %s (%s) for %s...", method, target, cfg.Targets[target], cfg.duration)
+			rep.Results = append(rep.Results, run(ctx, c, target, method, *name, cfg))
+			c.Close()
+		}
+	}
+	rep.Overhead = kongOverhead(rep.Results)
+
+	if *jsonOut != "-" {
+		printReport(os.Stdout, rep)
+	}
+	if *jsonOut != "" {
+		if err := writeJSON(*jsonOut, rep); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+	}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// run drives one method against one target with cfg.Concurrency workers,
+// paced by a shared limiter when cfg.QPS is set.
+func run(ctx context.Context, c *client.Client, target, method, name string, cfg benchConfig) result {
+	var limiter *rate.Limiter
+	if cfg.QPS > 0 {
+		limiter = rate.NewLimiter(rate.Limit(cfg.QPS), 1)
+	}
+	runCtx, cancel := context.WithTimeout(ctx, cfg.warmup+cfg.duration)
+	defer cancel()
+	measureFrom := time.Now().Add(cfg.warmup)
+
+	recorders := make([]*recorder, cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i := range recorders {
+		rec := newRecorder()
+		recorders[i] = rec
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if limiter != nil {
+					if err := limiter.Wait(runCtx); err != nil {
+						return
+					}
+				} else if runCtx.Err() != nil {
+					return
+				}
+				// Calls in flight when the run ends are allowed to finish,
+				// so they are not counted as cancelled.
+				callCtx, cancel := context.WithTimeout(ctx, cfg.timeout)
+				start := time.Now()
+				first, messages, err := call(callCtx, c, method, name, cfg)
+				latency := time.Since(start)
+				cancel()
+				if start.Before(measureFrom) {
+					continue
+				}
+				code := status.Code(err)
+				rec.codes[code.String()]++
+				if code != codes.OK {
+					continue
+				}
+				rec.latencies = append(rec.latencies, latency)
+				if method == "stream" {
+					rec.firstMessage = append(rec.firstMessage, first)
+					rec.messages += messages
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(measureFrom)
+
+	total := newRecorder()
+	for _, rec := range recorders {
+		total.merge(rec)
+	}
+	res := result{
+		Target:       target,
+		Addr:         cfg.Targets[target],
+		Method:       method,
+		Codes:        total.codes,
+		Histogram:    histogram(total.latencies),
+		Latency:      summarize(total.latencies),
+		FirstMessage: summarize(total.firstMessage),
+	}
+	for code, n := range total.codes {
+		res.Requests += n
+		if code != codes.OK.String() {
+			res.Errors += n
+		}
+	}
+	if elapsed > 0 {
+		res.Elapsed = elapsed.Seconds()
+		res.Throughput = float64(res.Requests) / res.Elapsed
+		res.MessageRate = float64(total.messages) / res.Elapsed
+	}
+	return res
+}
+
+// call makes one call and returns the time to the first stream message and
+// the number of messages received.
+func call(ctx context.Context, c *client.Client, method, name string, cfg benchConfig) (time.Duration, int, error) {
+	req := &pb.HelloRequest{Name: name}
+	if method == "say" {
+		_, err := c.SayHello(ctx, req)
+		return 0, 0, err
+	}
+
+	req.Count = proto.Uint32(cfg.StreamCount)
+	req.IntervalMs = proto.Uint32(uint32(cfg.interval.Milliseconds()))
+	start := time.Now()
+	var first time.Duration
+	var messages int
+	for _, err := range c.SayHelloStream(ctx, req) {
+		if err != nil {
+			return first, messages, err
+		}
+		if messages == 0 {
+			first = time.Since(start)
+		}
+		messages++
+	}
+	return first, messages, nil
+}
+
+// kongOverhead compares the kong and direct results of each method.
+func kongOverhead(results []result) []overhead {
+	var out []overhead
+	for _, kong := range results {
+		if kong.Target != "kong" || kong.Latency == nil {
+			continue
+		}
+		for _, direct := range results {
+			if direct.Target != "direct" || direct.Method != kong.Method || direct.Latency == nil {
+				continue
+			}
+			out = append(out, overhead{
+				Method: kong.Method,
+				P50:    kong.Latency.P50 - direct.Latency.P50,
+				P95:    kong.Latency.P95 - direct.Latency.P95,
+				P99:    kong.Latency.P99 - direct.Latency.P99,
+			})
+		}
+	}
+	return out
+}
+
+// printReport prints the results side by side, one column per target and method.
+func printReport(f *os.File, rep report) {
+	w := tabwriter.NewWriter(f, 0, 0, 2, ' ', 0)
+	row := func(label string, value func(result) string) {
+		fmt.Fprint(w, label, "\t")
+		for _, r := range rep.Results {
+			fmt.Fprint(w, value(r), "\t")
+		}
+		fmt.Fprintln(w)
+	}
+	ms := func(stats func(result) *latencyStats, pick func(*latencyStats) float64) func(result) string {
+		return func(r result) string {
+			if s := stats(r); s != nil {
+				return fmt.Sprintf("%.2f", pick(s))
+			}
+			return "-"
+		}
+	}
+	latency := func(r result) *latencyStats { return r.Latency }
+	first := func(r result) *latencyStats { return r.FirstMessage }
+
+	row("", func(r result) string { return r.Target + "/" + r.Method })
+	row("requests", func(r result) string { return fmt.Sprint(r.Requests) })
+	row("errors", func(r result) string { return fmt.Sprint(r.Errors) })
+	row("throughput (rps)", func(r result) string { return fmt.Sprintf("%.1f", r.Throughput) })
+	row("latency p50 (ms)", ms(latency, func(s *latencyStats) float64 { return s.P50 }))
+	row("latency p95 (ms)", ms(latency, func(s *latencyStats) float64 { return s.P95 }))
+	row("latency p99 (ms)", ms(latency, func(s *latencyStats) float64 { return s.P99 }))
+	row("latency max (ms)", ms(latency, func(s *latencyStats) float64 { return s.Max }))
+	if hasStream(rep.Results) {
+		row("messages/s", func(r result) string {
+			if r.Method != "stream" {
+				return "-"
+			}
+			return fmt.Sprintf("%.1f", r.MessageRate)
+		})
+		row("first msg p50 (ms)", ms(first, func(s *latencyStats) float64 { return s.P50 }))
+		row("first msg p99 (ms)", ms(first, func(s *latencyStats) float64 { return s.P99 }))
+	}
+
+	row("codes", func(result) string { return "" })
+	for _, code := range resultCodes(rep.Results) {
+		row("  "+code, func(r result) string { return fmt.Sprint(r.Codes[code]) })
+	}
+
+	// Buckets above the slowest sample of every result are left out.
+	row("histogram (ms)", func(result) string { return "" })
+	for i := 0; i <= lastBucket(rep.Results); i++ {
+		label := fmt.Sprintf("  > %g", histogramBounds[len(histogramBounds)-1])
+		if i < len(histogramBounds) {
+			label = fmt.Sprintf("  <= %g", histogramBounds[i])
+		}
+		row(label, func(r result) string { return fmt.Sprint(r.Histogram[i].Count) })
+	}
+	w.Flush()
+
+	if len(rep.Overhead) > 0 {
+		fmt.Fprintln(f)
+		fmt.Fprintln(f, "Kong overhead (kong - direct):")
+		for _, o := range rep.Overhead {
+			fmt.Fprintf(f, "  %-7s p50 %+.2fms  p95 %+.2fms  p99 %+.2fms\n", o.Method, o.P50, o.P95, o.P99)
+		}
+	}
+}
+
+func hasStream(results []result) bool {
+	for _, r := range results {
+		if r.Method == "stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// lastBucket returns the index of the highest non-empty histogram bucket.
+func lastBucket(results []result) int {
+	last := 0
+	for _, r := range results {
+		for i, b := range r.Histogram {
+			if b.Count > 0 && i > last {
+				last = i
+			}
+		}
+	}
+	return last
+}
+
+// resultCodes returns every status code seen, OK first and the rest in code order.
+func resultCodes(results []result) []string {
+	var out []string
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		for _, r := range results {
+			if r.Codes[c.String()] > 0 {
+				out = append(out, c.String())
+				break
+			}
+		}
+	}
+	return out
+}
+
+func writeJSON(path string, rep report) error {
+	out, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append(out, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		return err
+	}
+	log.Printf("Wrote %s", path)
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// histogramBounds are the upper bounds of the latency histogram buckets in
+// milliseconds. Samples above the last bound fall into an overflow bucket.
+var histogramBounds = []float64{0.25, 0.5, 1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// recorder collects the samples of one worker, so workers never share state
+// while the benchmark runs.
+type recorder struct {
+	latencies []time.Duration
+	// firstMessage is the time to the first stream message (streams only).
+	firstMessage []time.Duration
+	messages     int
+	codes        map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{codes: make(map[string]int)}
+}
+
+func (r *recorder) merge(other *recorder) {
+	r.latencies = append(r.latencies, other.latencies...)
+	r.firstMessage = append(r.firstMessage, other.firstMessage...)
+	r.messages += other.messages
+	for code, n := range other.codes {
+		r.codes[code] += n
+	}
+}
+
+// latencyStats summarizes samples in milliseconds.
+type latencyStats struct {
+	Min  float64 `json:"min_ms"`
+	Mean float64 `json:"mean_ms"`
+	P50  float64 `json:"p50_ms"`
+	P95  float64 `json:"p95_ms"`
+	P99  float64 `json:"p99_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+type bucket struct {
+	// LE is the bucket's upper bound in milliseconds; null for the overflow bucket.
+	LE    *float64 `json:"le_ms"`
+	Count int      `json:"count"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// summarize sorts samples in place and returns nil if there are none.
+func summarize(samples []time.Duration) *latencyStats {
+	if len(samples) == 0 {
+		return nil
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	var total time.Duration
+	for _, s := range samples {
+		total += s
+	}
+	return &latencyStats{
+		Min:  milliseconds(samples[0]),
+		Mean: milliseconds(total) / float64(len(samples)),
+		P50:  milliseconds(percentile(samples, 50)),
+		P95:  milliseconds(percentile(samples, 95)),
+		P99:  milliseconds(percentile(samples, 99)),
+		Max:  milliseconds(samples[len(samples)-1]),
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func histogram(samples []time.Duration) []bucket {
+	buckets := make([]bucket, len(histogramBounds)+1)
+	for i := range histogramBounds {
+		buckets[i].LE = &histogramBounds[i]
+	}
+	for _, s := range samples {
+		ms := milliseconds(s)
+		i := sort.SearchFloat64s(histogramBounds, ms)
+		buckets[i].Count++
+	}
+	return buckets
+}
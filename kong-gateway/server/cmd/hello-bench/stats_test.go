@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func ms(n float64) time.Duration { return time.Duration(n * float64(time.Millisecond)) }
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		p       float64
+		want    time.Duration
+	}{
+		{"one sample p50", []time.Duration{ms(3)}, 50, ms(3)},
+		{"one sample p99", []time.Duration{ms(3)}, 99, ms(3)},
+		{"p0 is the minimum", []time.Duration{ms(1), ms(2), ms(3)}, 0, ms(1)},
+		{"p100 is the maximum", []time.Duration{ms(1), ms(2), ms(3)}, 100, ms(3)},
+		{"nearest rank", []time.Duration{ms(1), ms(2), ms(3), ms(4)}, 50, ms(2)},
+		{"rank rounds up", []time.Duration{ms(1), ms(2), ms(3), ms(4)}, 51, ms(3)},
+		{"ties", []time.Duration{ms(1), ms(5), ms(5), ms(5), ms(9)}, 50, ms(5)},
+		{"ties at the top", []time.Duration{ms(1), ms(9), ms(9), ms(9)}, 95, ms(9)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentile(tt.samples, tt.p); got != tt.want {
+				t.Errorf("percentile(p%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	last := histogramBounds[len(histogramBounds)-1]
+	buckets := histogram([]time.Duration{
+		ms(0.1),      // first bucket
+		ms(1),        // exactly on a bound: its own le bucket
+		ms(1.5),      // le 2
+		ms(5000),     // exactly on the last bound
+		ms(last + 1), // overflow
+		time.Minute,  // overflow
+	})
+	if len(buckets) != len(histogramBounds)+1 {
+		t.Fatalf("got %d buckets, want %d", len(buckets), len(histogramBounds)+1)
+	}
+	want := map[float64]int{0.25: 1, 1: 1, 2: 1, 5000: 1}
+	for i, b := range buckets[:len(histogramBounds)] {
+		if b.LE == nil || *b.LE != histogramBounds[i] {
+			t.Fatalf("bucket %d le = %v, want %v", i, b.LE, histogramBounds[i])
+		}
+		if b.Count != want[*b.LE] {
+			t.Errorf("bucket le %v count = %d, want %d", *b.LE, b.Count, want[*b.LE])
+		}
+	}
+	overflow := buckets[len(buckets)-1]
+	if overflow.LE != nil || overflow.Count != 2 {
+		t.Errorf("overflow bucket = {le %v, count %d}, want {nil, 2}", overflow.LE, overflow.Count)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	if got := summarize(nil); got != nil {
+		t.Errorf("summarize(nil) = %+v, want nil", got)
+	}
+
+	got := summarize([]time.Duration{ms(4), ms(1), ms(3), ms(2)})
+	want := latencyStats{Min: 1, Mean: 2.5, P50: 2, P95: 4, P99: 4, Max: 4}
+	if got == nil || *got != want {
+		t.Errorf("summarize = %+v, want %+v", got, want)
+	}
+}
+
+func TestRecorderMerge(t *testing.T) {
+	a, b := newRecorder(), newRecorder()
+	a.latencies = []time.Duration{ms(1), ms(2)}
+	a.firstMessage = []time.Duration{ms(1)}
+	a.messages = 10
+	a.codes["OK"] = 2
+	b.latencies = []time.Duration{ms(3)}
+	b.messages = 5
+	b.codes["OK"] = 1
+	b.codes["Unavailable"] = 1
+
+	total := newRecorder()
+	total.merge(a)
+	total.merge(b)
+	if len(total.latencies) != 3 || len(total.firstMessage) != 1 || total.messages != 15 {
+		t.Errorf("merged %d latencies, %d first messages, %d messages; want 3, 1, 15",
+			len(total.latencies), len(total.firstMessage), total.messages)
+	}
+	if total.codes["OK"] != 3 || total.codes["Unavailable"] != 1 || len(total.codes) != 2 {
+		t.Errorf("merged codes = %v, want OK:3 Unavailable:1", total.codes)
+	}
+}
@@ -0,0 +1,193 @@
+// Command hello-cli calls HelloService directly or through the Kong gRPC proxy.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"grpc-server/client"
+	pb "grpc-server/pb"
+)
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func printUsage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintln(out, "Usage: hello-cli [flags] <command> <name>")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Commands:")
+	fmt.Fprintln(out, "  say     - Call SayHello")
+	fmt.Fprintln(out, "  stream  - Call SayHelloServerStream")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Flags:")
+	fs.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	fs := flag.NewFlagSet("hello-cli", flag.ExitOnError)
+	addr := fs.String("addr", getEnv("HELLO_ADDR", "localhost:50051"), "comma-separated server addresses, dns:///host:port or file:///endpoints.yaml (balanced round robin)")
+	viaKong := fs.Bool("via-kong", false, "call through the Kong gRPC proxy at -kong-addr instead of -addr")
+	kongAddr := fs.String("kong-addr", getEnv("KONG_GRPC_ADDR", "localhost:19080"), "Kong gRPC proxy address")
+	useTLS := fs.Bool("tls", false, "connect with TLS")
+	caFile := fs.String("ca", "", "CA certificate for verifying the server (implies -tls)")
+	certFile := fs.String("cert", "", "client certificate for mTLS (implies -tls)")
+	keyFile := fs.String("key", "", "client private key for mTLS")
+	token := fs.String("token", getEnv("HELLO_TOKEN", ""), "bearer token sent as the authorization header")
+	compression := fs.String("compression", "", "compress requests with gzip or zstd")
+	retries := fs.Int("retries", 3, "retries on UNAVAILABLE and RESOURCE_EXHAUSTED (0 disables)")
+	timeout := fs.Duration("timeout", 10*time.Second, "deadline for the whole call")
+	jsonOut := fs.Bool("json", false, "print responses as JSON, one per line")
+	repeat := fs.Int("repeat", 1, "say: number of calls; with more than one, calls per instance are summarized")
+	count := fs.Uint("count", 0, "stream: number of messages (0 = server default)")
+	interval := fs.Duration("interval", 0, "stream: delay between messages (0 = server default)")
+	fs.Usage = func() { printUsage(fs) }
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	command, name := fs.Arg(0), fs.Arg(1)
+
+	targets := strings.Split(*addr, ",")
+	if *viaKong {
+		targets = []string{*kongAddr}
+	}
+
+	opts := []client.Option{
+		client.WithUserAgent("hello-cli"),
+		client.WithKeepalive(30*time.Second, 10*time.Second),
+	}
+	if *useTLS || *caFile != "" || *certFile != "" {
+		opts = append(opts, client.WithTLS(*caFile, *certFile, *keyFile))
+	}
+	if *token != "" {
+		opts = append(opts, client.WithAuthToken(*token))
+	}
+	if *compression != "" {
+		opts = append(opts, client.WithCompression(*compression))
+	}
+	if *retries > 0 {
+		policy := client.DefaultRetryPolicy
+		policy.MaxAttempts = *retries + 1
+		opts = append(opts, client.WithRetry(policy))
+	}
+
+	c, err := client.New(targets, opts...)
+	if err != nil {
+		log.Fatalf("Failed to create client: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	req := &pb.HelloRequest{Name: name}
+	switch command {
+	case "say":
+		instances := make(map[string]int)
+		for i := 0; i < *repeat; i++ {
+			var header metadata.MD
+			resp, err := c.SayHello(ctx, req, grpc.Header(&header))
+			if err != nil {
+				exitWithError(err, *jsonOut)
+			}
+			printResponse(resp, *jsonOut)
+			instances[strings.Join(header.Get(client.InstanceIDHeader), ",")]++
+		}
+		if *repeat > 1 {
+			printInstances(instances)
+		}
+	case "stream":
+		if *count > 0 {
+			req.Count = proto.Uint32(uint32(*count))
+		}
+		if *interval > 0 {
+			req.IntervalMs = proto.Uint32(uint32(interval.Milliseconds()))
+		}
+		for resp, err := range c.SayHelloStream(ctx, req) {
+			if err != nil {
+				exitWithError(err, *jsonOut)
+			}
+			printResponse(resp, *jsonOut)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func printResponse(resp *pb.HelloResponse, asJSON bool) {
+	if !asJSON {
+		fmt.Println(resp.GetMessage())
+		return
+	}
+	out, err := protojson.Marshal(resp)
+	if err != nil {
+		log.Fatalf("Failed to encode response: %v", err)
+	}
+	fmt.Println(string(out))
+}
+
+// printInstances prints how many calls each server instance answered to
+// stderr, to compare Kong's load balancing with the client's.
+func printInstances(instances map[string]int) {
+	ids := make([]string, 0, len(instances))
+	for id := range instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	fmt.Fprintln(os.Stderr, "Calls per instance:")
+	for _, id := range ids {
+		name := id
+		if name == "" {
+			name = "(no x-instance-id)"
+		}
+		fmt.Fprintf(os.Stderr, "  %s: %d\n", name, instances[id])
+	}
+}
+
+// exitWithError prints the gRPC status (as JSON with its details when
+// -json is set) and exits with a non-zero code.
+func exitWithError(err error, asJSON bool) {
+	st := status.Convert(err)
+	if asJSON {
+		out, merr := protojson.Marshal(st.Proto())
+		if merr != nil {
+			log.Fatalf("Failed to encode error: %v", errors.Join(err, merr))
+		}
+		fmt.Fprintln(os.Stderr, string(out))
+		os.Exit(1)
+	}
+
+	msg := fmt.Sprintf("Error: %s: %s", st.Code(), st.Message())
+	if delay, ok := client.RetryDelay(err); ok {
+		msg += fmt.Sprintf(" (retry after %s)", delay)
+	}
+	for field, descs := range client.FieldViolations(err) {
+		for _, d := range descs {
+			msg += fmt.Sprintf("\n  %s: %s", field, d)
+		}
+	}
+	fmt.Fprintln(os.Stderr, msg)
+	os.Exit(1)
+}
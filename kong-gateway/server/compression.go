@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // registers the gzip compressor
+	"google.golang.org/protobuf/proto"
+
+	_ "grpc-server/encoding/zstd" // registers the zstd compressor
+)
+
+// compressor compresses responses with the first of names the client
+// advertised in grpc-accept-encoding. Requests are decompressed by any
+// registered compressor regardless of this setting.
+type compressor struct {
+	names []string
+	// minSize skips compression of smaller unary responses, where the
+	// framing overhead outweighs the savings. Streams are always compressed.
+	minSize int
+}
+
+// parseCompression splits a comma-separated preference list such as
+// "zstd,gzip". It returns nil for "" and "none".
+func parseCompression(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "none" {
+			continue
+		}
+		if encoding.GetCompressor(name) == nil {
+			return nil, fmt.Errorf("unknown compression %q (want none, gzip or zstd)", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// choose returns the preferred compressor the client supports, or "".
+func (c compressor) choose(ctx context.Context) string {
+	supported, err := grpc.ClientSupportedCompressors(ctx)
+	if err != nil {
+		return ""
+	}
+	for _, name := range c.names {
+		if slices.Contains(supported, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// unaryInterceptor picks the compressor after the handler, when the
+// response size is known; headers are not sent before that for unary RPCs.
+func (c compressor) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	if msg, ok := resp.(proto.Message); ok && proto.Size(msg) < c.minSize {
+		return resp, nil
+	}
+	if name := c.choose(ctx); name != "" {
+		grpc.SetSendCompressor(ctx, name)
+	}
+	return resp, nil
+}
+
+func (c compressor) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if name := c.choose(ss.Context()); name != "" {
+		grpc.SetSendCompressor(ss.Context(), name)
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"gopkg.in/yaml.v3"
+)
+
+// serverConfig is the effective server configuration. Values are resolved
+// in order: defaults, config file (-config / GRPC_CONFIG_FILE), environment
+// variables, then command-line flags.
+type serverConfig struct {
+	ListenAddr string `yaml:"listen_addr"`
+	// InstanceID is returned in the x-instance-id header and trailer of every
+	// RPC to tell replicas apart behind Kong (default: hostname).
+	InstanceID string `yaml:"instance_id"`
+	// Reflection registers the reflection service for grpcurl.
+	Reflection bool `yaml:"reflection"`
+
+	MaxRecvMsgSize int `yaml:"max_recv_msg_size"`
+	MaxSendMsgSize int `yaml:"max_send_msg_size"`
+	// MaxConcurrentStreams limits streams per HTTP/2 connection (0 = unlimited).
+	MaxConcurrentStreams int `yaml:"max_concurrent_streams"`
+	// MaxStreamDuration ends streams that run longer (0 = unlimited).
+	MaxStreamDuration time.Duration `yaml:"max_stream_duration"`
+	// Compression lists response compressors in order of preference, e.g.
+	// "zstd,gzip"; the first one the client accepts is used. none disables.
+	Compression string `yaml:"compression"`
+	// CompressionMinSize leaves smaller unary responses uncompressed.
+	CompressionMinSize int `yaml:"compression_min_size"`
+
+	ResponseCache responseCacheConfig `yaml:"response_cache"`
+
+	Keepalive keepaliveConfig `yaml:"keepalive"`
+	RateLimit rateLimitConfig `yaml:"rate_limit"`
+	TLS       tlsOptions      `yaml:"tls"`
+	Tracing   tracingOptions  `yaml:"tracing"`
+
+	MetricsAddr        string `yaml:"metrics_addr"`
+	DebugAddr          string `yaml:"debug_addr"`
+	HTTPAddr           string `yaml:"http_addr"`
+	CORSAllowedOrigins string `yaml:"cors_allowed_origins"`
+}
+
+// keepaliveConfig combines the enforcement policy for client pings with the
+// server's own ping and connection age settings. Kong keeps pooled upstream
+// connections open between requests, so pings without active streams are
+// permitted by default instead of answered with GOAWAY too_many_pings.
+type keepaliveConfig struct {
+	MinTime             time.Duration `yaml:"min_time"`
+	PermitWithoutStream bool          `yaml:"permit_without_stream"`
+
+	Time                  time.Duration `yaml:"time"`
+	Timeout               time.Duration `yaml:"timeout"`
+	MaxConnectionIdle     time.Duration `yaml:"max_connection_idle"`
+	MaxConnectionAge      time.Duration `yaml:"max_connection_age"`
+	MaxConnectionAgeGrace time.Duration `yaml:"max_connection_age_grace"`
+}
+
+func defaultConfig() serverConfig {
+	return serverConfig{
+		ListenAddr:         ":50051",
+		InstanceID:         defaultInstanceID(),
+		Reflection:         true,
+		MaxRecvMsgSize:     4 << 20,
+		MaxSendMsgSize:     math.MaxInt32,
+		Compression:        "none",
+		CompressionMinSize: 1024,
+		MaxStreamDuration:  5 * time.Minute,
+		ResponseCache: responseCacheConfig{
+			MaxEntries: 10000,
+			MaxBytes:   64 << 20,
+			DefaultTTL: time.Minute,
+		},
+		Keepalive: keepaliveConfig{
+			MinTime:             10 * time.Second,
+			PermitWithoutStream: true,
+			Time:                2 * time.Hour,
+			Timeout:             20 * time.Second,
+		},
+		RateLimit: rateLimitConfig{
+			MaxInFlight:    1000,
+			CallerHeaders:  "x-consumer-id,x-forwarded-for",
+			TrustedProxies: "127.0.0.1,::1",
+		},
+		TLS:         tlsOptions{ReloadInterval: 30 * time.Second},
+		Tracing:     tracingOptions{Exporter: "none", OTLPInsecure: true},
+		MetricsAddr: ":9090",
+		HTTPAddr:    ":8080",
+	}
+}
+
+// loadConfig resolves the configuration from args, the environment and the
+// optional config file. Flags are parsed twice: once to find -config, then
+// on top of the file and environment so they take precedence. Malformed
+// environment variables and flags are errors, like failed validation.
+func loadConfig(args []string) (serverConfig, error) {
+	path := getEnv("GRPC_CONFIG_FILE", "")
+	probe := defaultConfig()
+	fs := probe.flagSet(&path)
+	fs.SetOutput(io.Discard)
+	fs.Parse(args) // errors are reported by the second parse
+
+	cfg := defaultConfig()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, fmt.Errorf("invalid environment: %w", err)
+	}
+	if err := cfg.flagSet(&path).Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+func (c *serverConfig) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *serverConfig) applyEnv() error {
+	var env envReader
+	c.ListenAddr = getEnv("GRPC_LISTEN_ADDR", c.ListenAddr)
+	c.InstanceID = getEnv("GRPC_INSTANCE_ID", c.InstanceID)
+	c.Reflection = env.bool("GRPC_REFLECTION", c.Reflection)
+	c.MaxRecvMsgSize = env.int("GRPC_MAX_RECV_MSG_SIZE", c.MaxRecvMsgSize)
+	c.MaxSendMsgSize = env.int("GRPC_MAX_SEND_MSG_SIZE", c.MaxSendMsgSize)
+	c.MaxConcurrentStreams = env.int("GRPC_MAX_CONCURRENT_STREAMS", c.MaxConcurrentStreams)
+	c.MaxStreamDuration = env.duration("GRPC_MAX_STREAM_DURATION", c.MaxStreamDuration)
+	c.Compression = getEnv("GRPC_COMPRESSION", c.Compression)
+	c.CompressionMinSize = env.int("GRPC_COMPRESSION_MIN_SIZE", c.CompressionMinSize)
+
+	c.ResponseCache.Enabled = env.bool("GRPC_RESPONSE_CACHE", c.ResponseCache.Enabled)
+	c.ResponseCache.MaxEntries = env.int("GRPC_RESPONSE_CACHE_MAX_ENTRIES", c.ResponseCache.MaxEntries)
+	c.ResponseCache.MaxBytes = env.int("GRPC_RESPONSE_CACHE_MAX_BYTES", c.ResponseCache.MaxBytes)
+	c.ResponseCache.DefaultTTL = env.duration("GRPC_RESPONSE_CACHE_TTL", c.ResponseCache.DefaultTTL)
+
+	c.Keepalive.MinTime = env.duration("GRPC_KEEPALIVE_MIN_TIME", c.Keepalive.MinTime)
+	c.Keepalive.PermitWithoutStream = env.bool("GRPC_KEEPALIVE_PERMIT_WITHOUT_STREAM", c.Keepalive.PermitWithoutStream)
+	c.Keepalive.Time = env.duration("GRPC_KEEPALIVE_TIME", c.Keepalive.Time)
+	c.Keepalive.Timeout = env.duration("GRPC_KEEPALIVE_TIMEOUT", c.Keepalive.Timeout)
+	c.Keepalive.MaxConnectionIdle = env.duration("GRPC_MAX_CONNECTION_IDLE", c.Keepalive.MaxConnectionIdle)
+	c.Keepalive.MaxConnectionAge = env.duration("GRPC_MAX_CONNECTION_AGE", c.Keepalive.MaxConnectionAge)
+	c.Keepalive.MaxConnectionAgeGrace = env.duration("GRPC_MAX_CONNECTION_AGE_GRACE", c.Keepalive.MaxConnectionAgeGrace)
+
+	c.RateLimit.MaxInFlight = env.int("GRPC_MAX_IN_FLIGHT", c.RateLimit.MaxInFlight)
+	c.RateLimit.Method.Rate = env.float("GRPC_RATE_LIMIT_METHOD_RPS", c.RateLimit.Method.Rate)
+	c.RateLimit.Method.Burst = env.int("GRPC_RATE_LIMIT_METHOD_BURST", c.RateLimit.Method.Burst)
+	c.RateLimit.Caller.Rate = env.float("GRPC_RATE_LIMIT_CALLER_RPS", c.RateLimit.Caller.Rate)
+	c.RateLimit.Caller.Burst = env.int("GRPC_RATE_LIMIT_CALLER_BURST", c.RateLimit.Caller.Burst)
+	c.RateLimit.CallerHeaders = getEnv("GRPC_RATE_LIMIT_CALLER_HEADERS", c.RateLimit.CallerHeaders)
+	c.RateLimit.TrustedProxies = getEnv("GRPC_RATE_LIMIT_TRUSTED_PROXIES", c.RateLimit.TrustedProxies)
+
+	c.TLS.CertFile = getEnv("GRPC_TLS_CERT", c.TLS.CertFile)
+	c.TLS.KeyFile = getEnv("GRPC_TLS_KEY", c.TLS.KeyFile)
+	c.TLS.ClientCAFile = getEnv("GRPC_TLS_CLIENT_CA", c.TLS.ClientCAFile)
+	c.TLS.ReloadInterval = env.duration("GRPC_TLS_RELOAD_INTERVAL", c.TLS.ReloadInterval)
+
+	c.Tracing.Exporter = getEnv("GRPC_TRACE_EXPORTER", c.Tracing.Exporter)
+	c.Tracing.OTLPEndpoint = getEnv("GRPC_OTLP_ENDPOINT", c.Tracing.OTLPEndpoint)
+	c.Tracing.OTLPInsecure = env.bool("GRPC_OTLP_INSECURE", c.Tracing.OTLPInsecure)
+
+	c.MetricsAddr = getEnv("GRPC_METRICS_ADDR", c.MetricsAddr)
+	c.DebugAddr = getEnv("GRPC_DEBUG_ADDR", c.DebugAddr)
+	c.HTTPAddr = getEnv("GRPC_HTTP_ADDR", c.HTTPAddr)
+	c.CORSAllowedOrigins = getEnv("GRPC_CORS_ALLOWED_ORIGINS", c.CORSAllowedOrigins)
+	return env.err()
+}
+
+// flagSet binds flags to c, using the current values as defaults.
+func (c *serverConfig) flagSet(configFile *string) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.StringVar(configFile, "config", *configFile, "YAML config file (env GRPC_CONFIG_FILE)")
+
+	fs.StringVar(&c.ListenAddr, "listen-addr", c.ListenAddr, "gRPC listen address")
+	fs.StringVar(&c.InstanceID, "instance-id", c.InstanceID, "instance ID returned in the x-instance-id header and trailer")
+	fs.BoolVar(&c.Reflection, "reflection", c.Reflection, "register the reflection service for grpcurl")
+	fs.IntVar(&c.MaxRecvMsgSize, "max-recv-msg-size", c.MaxRecvMsgSize, "maximum request message size in bytes")
+	fs.IntVar(&c.MaxSendMsgSize, "max-send-msg-size", c.MaxSendMsgSize, "maximum response message size in bytes")
+	fs.IntVar(&c.MaxConcurrentStreams, "max-concurrent-streams", c.MaxConcurrentStreams, "maximum concurrent streams per connection (0 = unlimited)")
+	fs.DurationVar(&c.MaxStreamDuration, "max-stream-duration", c.MaxStreamDuration, "end streams running longer than this with DEADLINE_EXCEEDED (0 = unlimited)")
+	fs.StringVar(&c.Compression, "compression", c.Compression, "comma-separated response compressors in order of preference: none, gzip, zstd")
+	fs.IntVar(&c.CompressionMinSize, "compression-min-size", c.CompressionMinSize, "minimum unary response size in bytes to compress")
+
+	fs.BoolVar(&c.ResponseCache.Enabled, "response-cache", c.ResponseCache.Enabled, "cache responses of methods with the (cache.policy) option")
+	fs.IntVar(&c.ResponseCache.MaxEntries, "response-cache-max-entries", c.ResponseCache.MaxEntries, "maximum number of cached responses")
+	fs.IntVar(&c.ResponseCache.MaxBytes, "response-cache-max-bytes", c.ResponseCache.MaxBytes, "maximum size of cached requests and responses in bytes")
+	fs.DurationVar(&c.ResponseCache.DefaultTTL, "response-cache-ttl", c.ResponseCache.DefaultTTL, "TTL for methods whose cache policy sets none")
+
+	fs.DurationVar(&c.Keepalive.MinTime, "keepalive-min-time", c.Keepalive.MinTime, "minimum interval between client keepalive pings")
+	fs.BoolVar(&c.Keepalive.PermitWithoutStream, "keepalive-permit-without-stream", c.Keepalive.PermitWithoutStream, "allow client pings on connections without active streams")
+	fs.DurationVar(&c.Keepalive.Time, "keepalive-time", c.Keepalive.Time, "ping clients after this much idle time")
+	fs.DurationVar(&c.Keepalive.Timeout, "keepalive-timeout", c.Keepalive.Timeout, "close the connection if a ping is not acknowledged within this time")
+	fs.DurationVar(&c.Keepalive.MaxConnectionIdle, "max-connection-idle", c.Keepalive.MaxConnectionIdle, "close connections idle for this long (0 = never)")
+	fs.DurationVar(&c.Keepalive.MaxConnectionAge, "max-connection-age", c.Keepalive.MaxConnectionAge, "send GOAWAY to connections older than this (0 = never)")
+	fs.DurationVar(&c.Keepalive.MaxConnectionAgeGrace, "max-connection-age-grace", c.Keepalive.MaxConnectionAgeGrace, "time allowed for in-flight RPCs after max-connection-age (0 = unlimited)")
+
+	fs.IntVar(&c.RateLimit.MaxInFlight, "max-in-flight", c.RateLimit.MaxInFlight, "maximum concurrent RPCs before shedding load (0 = unlimited)")
+	fs.Float64Var(&c.RateLimit.Method.Rate, "rate-limit-method-rps", c.RateLimit.Method.Rate, "requests per second per method (0 = unlimited; per-method overrides via config file)")
+	fs.IntVar(&c.RateLimit.Method.Burst, "rate-limit-method-burst", c.RateLimit.Method.Burst, "burst per method (0 = one second of requests)")
+	fs.Float64Var(&c.RateLimit.Caller.Rate, "rate-limit-caller-rps", c.RateLimit.Caller.Rate, "requests per second per caller (0 = unlimited)")
+	fs.IntVar(&c.RateLimit.Caller.Burst, "rate-limit-caller-burst", c.RateLimit.Caller.Burst, "burst per caller (0 = one second of requests)")
+	fs.StringVar(&c.RateLimit.CallerHeaders, "rate-limit-caller-headers", c.RateLimit.CallerHeaders, "comma-separated metadata keys identifying the caller; falls back to the peer IP")
+	fs.StringVar(&c.RateLimit.TrustedProxies, "rate-limit-trusted-proxies", c.RateLimit.TrustedProxies, "comma-separated proxy addresses or CIDRs whose caller headers are trusted; list Kong's address explicitly")
+
+	fs.StringVar(&c.TLS.CertFile, "tls-cert", c.TLS.CertFile, "server certificate file; enables TLS (grpcs)")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key", c.TLS.KeyFile, "server private key file")
+	fs.StringVar(&c.TLS.ClientCAFile, "tls-client-ca", c.TLS.ClientCAFile, "CA bundle for verifying client certificates; enables mTLS")
+	fs.DurationVar(&c.TLS.ReloadInterval, "tls-reload-interval", c.TLS.ReloadInterval, "how often to check certificate files for changes (0 disables reload)")
+
+	fs.StringVar(&c.Tracing.Exporter, "trace-exporter", c.Tracing.Exporter, "span exporter: none, stdout or otlp")
+	fs.StringVar(&c.Tracing.OTLPEndpoint, "otlp-endpoint", c.Tracing.OTLPEndpoint, "OTLP gRPC collector endpoint (defaults to OTEL_EXPORTER_OTLP_ENDPOINT)")
+	fs.BoolVar(&c.Tracing.OTLPInsecure, "otlp-insecure", c.Tracing.OTLPInsecure, "use plaintext for the OTLP exporter")
+
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "address for the Prometheus /metrics endpoint (empty disables)")
+	fs.StringVar(&c.DebugAddr, "debug-addr", c.DebugAddr, "address for pprof, /debug/streams and the gRPC admin services such as channelz (empty disables)")
+	fs.StringVar(&c.HTTPAddr, "http-addr", c.HTTPAddr, "address for the REST/JSON and gRPC-Web gateway (empty disables)")
+	fs.StringVar(&c.CORSAllowedOrigins, "cors-allowed-origins", c.CORSAllowedOrigins, "comma-separated origins allowed to make cross-origin gRPC-Web calls; empty disables CORS, \"*\" allows any origin")
+	return fs
+}
+
+func (c serverConfig) validate() error {
+	var errs []error
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listen_addr: %w", err))
+	}
+	if c.DebugAddr != "" {
+		if _, _, err := net.SplitHostPort(c.DebugAddr); err != nil {
+			errs = append(errs, fmt.Errorf("debug_addr: %w", err))
+		}
+	}
+	if c.InstanceID == "" {
+		errs = append(errs, errors.New("instance_id must not be empty"))
+	}
+	if c.MaxRecvMsgSize <= 0 {
+		errs = append(errs, fmt.Errorf("max_recv_msg_size must be positive, got %d", c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize <= 0 {
+		errs = append(errs, fmt.Errorf("max_send_msg_size must be positive, got %d", c.MaxSendMsgSize))
+	}
+	if c.MaxConcurrentStreams < 0 || c.MaxConcurrentStreams > math.MaxUint32 {
+		errs = append(errs, fmt.Errorf("max_concurrent_streams out of range: %d", c.MaxConcurrentStreams))
+	}
+	if _, err := parseCompression(c.Compression); err != nil {
+		errs = append(errs, err)
+	}
+	if c.CompressionMinSize < 0 {
+		errs = append(errs, fmt.Errorf("compression_min_size must not be negative, got %d", c.CompressionMinSize))
+	}
+	if c.ResponseCache.Enabled {
+		if err := c.ResponseCache.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("response_cache: %w", err))
+		}
+	}
+
+	for name, d := range map[string]time.Duration{
+		"max_stream_duration":                c.MaxStreamDuration,
+		"keepalive.min_time":                 c.Keepalive.MinTime,
+		"keepalive.time":                     c.Keepalive.Time,
+		"keepalive.timeout":                  c.Keepalive.Timeout,
+		"keepalive.max_connection_idle":      c.Keepalive.MaxConnectionIdle,
+		"keepalive.max_connection_age":       c.Keepalive.MaxConnectionAge,
+		"keepalive.max_connection_age_grace": c.Keepalive.MaxConnectionAgeGrace,
+	} {
+		if d < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %s", name, d))
+		}
+	}
+
+	if err := c.RateLimit.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("rate_limit: %w", err))
+	}
+	if c.TLS.enabled() {
+		if err := c.TLS.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("tls: %w", err))
+		}
+	}
+	switch c.Tracing.Exporter {
+	case "", "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("unknown trace exporter %q (want none, stdout or otlp)", c.Tracing.Exporter))
+	}
+	return errors.Join(errs...)
+}
+
+// serverOptions returns the transport options shared by the public and the
+// in-process gRPC servers.
+func (c serverConfig) serverOptions() []grpc.ServerOption {
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(c.MaxRecvMsgSize),
+		grpc.MaxSendMsgSize(c.MaxSendMsgSize),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             c.Keepalive.MinTime,
+			PermitWithoutStream: c.Keepalive.PermitWithoutStream,
+		}),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     c.Keepalive.MaxConnectionIdle,
+			MaxConnectionAge:      c.Keepalive.MaxConnectionAge,
+			MaxConnectionAgeGrace: c.Keepalive.MaxConnectionAgeGrace,
+			Time:                  c.Keepalive.Time,
+			Timeout:               c.Keepalive.Timeout,
+		}),
+	}
+	if c.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(uint32(c.MaxConcurrentStreams)))
+	}
+	return opts
+}
+
+// dump renders the effective configuration for the startup log.
+func (c serverConfig) dump() string {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("<failed to encode config: %v>", err)
+	}
+	return string(out)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := writeConfigFile(t, `
+listen_addr: ":1001"
+max_recv_msg_size: 1001
+keepalive:
+  min_time: 1s
+`)
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want func(*serverConfig)
+	}{
+		{
+			name: "defaults",
+			want: func(c *serverConfig) {},
+		},
+		{
+			name: "file over defaults",
+			args: []string{"-config", file},
+			want: func(c *serverConfig) {
+				c.ListenAddr, c.MaxRecvMsgSize, c.Keepalive.MinTime = ":1001", 1001, time.Second
+			},
+		},
+		{
+			name: "file from the environment",
+			env:  map[string]string{"GRPC_CONFIG_FILE": file},
+			want: func(c *serverConfig) {
+				c.ListenAddr, c.MaxRecvMsgSize, c.Keepalive.MinTime = ":1001", 1001, time.Second
+			},
+		},
+		{
+			name: "env over file",
+			env:  map[string]string{"GRPC_MAX_RECV_MSG_SIZE": "2002", "GRPC_KEEPALIVE_MIN_TIME": "2s"},
+			args: []string{"-config", file},
+			want: func(c *serverConfig) {
+				c.ListenAddr, c.MaxRecvMsgSize, c.Keepalive.MinTime = ":1001", 2002, 2*time.Second
+			},
+		},
+		{
+			name: "flag over env and file",
+			env:  map[string]string{"GRPC_MAX_RECV_MSG_SIZE": "2002", "GRPC_KEEPALIVE_MIN_TIME": "2s"},
+			args: []string{"-config", file, "-max-recv-msg-size", "3003"},
+			want: func(c *serverConfig) {
+				c.ListenAddr, c.MaxRecvMsgSize, c.Keepalive.MinTime = ":1001", 3003, 2*time.Second
+			},
+		},
+		{
+			name: "flag before -config",
+			args: []string{"-listen-addr", ":3003", "-config", file},
+			want: func(c *serverConfig) {
+				c.ListenAddr, c.MaxRecvMsgSize, c.Keepalive.MinTime = ":3003", 1001, time.Second
+			},
+		},
+		{
+			name: "trusted proxies from env and flag",
+			env:  map[string]string{"GRPC_RATE_LIMIT_TRUSTED_PROXIES": "172.18.0.5"},
+			args: []string{"-rate-limit-caller-rps", "2.5"},
+			want: func(c *serverConfig) { c.RateLimit.TrustedProxies, c.RateLimit.Caller.Rate = "172.18.0.5", 2.5 },
+		},
+		{
+			name: "instance ID from env",
+			env:  map[string]string{"GRPC_INSTANCE_ID": "replica-2"},
+			want: func(c *serverConfig) { c.InstanceID = "replica-2" },
+		},
+		{
+			name: "bool env",
+			env:  map[string]string{"GRPC_REFLECTION": "false"},
+			want: func(c *serverConfig) { c.Reflection = false },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got, err := loadConfig(tt.args)
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			want := defaultConfig()
+			tt.want(&want)
+			if got.dump() != want.dump() {
+				t.Errorf("config =\n%s\nwant\n%s", got.dump(), want.dump())
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		file string
+		want string
+	}{
+		{name: "invalid int env", env: map[string]string{"GRPC_MAX_RECV_MSG_SIZE": "abc"}, want: `invalid int GRPC_MAX_RECV_MSG_SIZE="abc"`},
+		{name: "invalid duration env", env: map[string]string{"GRPC_KEEPALIVE_TIME": "soon"}, want: `invalid duration GRPC_KEEPALIVE_TIME="soon"`},
+		{name: "invalid stream duration env", env: map[string]string{"GRPC_MAX_STREAM_DURATION": "5"}, want: `invalid duration GRPC_MAX_STREAM_DURATION="5"`},
+		{name: "invalid bool env", env: map[string]string{"GRPC_REFLECTION": "maybe"}, want: `invalid bool GRPC_REFLECTION="maybe"`},
+		{name: "invalid cache TTL env", env: map[string]string{"GRPC_RESPONSE_CACHE_TTL": "60"}, want: `invalid duration GRPC_RESPONSE_CACHE_TTL="60"`},
+		{name: "invalid number env", env: map[string]string{"GRPC_RATE_LIMIT_CALLER_RPS": "abc"}, want: `invalid number GRPC_RATE_LIMIT_CALLER_RPS="abc"`},
+		{
+			name: "every invalid env is reported",
+			env:  map[string]string{"GRPC_MAX_SEND_MSG_SIZE": "1MiB", "GRPC_OTLP_INSECURE": "yes please"},
+			want: `invalid int GRPC_MAX_SEND_MSG_SIZE="1MiB"` + "\n" + `invalid bool GRPC_OTLP_INSECURE="yes please"`,
+		},
+		{name: "invalid env overridden by a flag", env: map[string]string{"GRPC_MAX_RECV_MSG_SIZE": "abc"}, args: []string{"-max-recv-msg-size", "1"}, want: "invalid environment"},
+		{name: "invalid int flag", args: []string{"-max-recv-msg-size", "abc"}, want: `invalid value "abc" for flag -max-recv-msg-size`},
+		{name: "invalid duration flag", args: []string{"-keepalive-time", "soon"}, want: `invalid value "soon" for flag -keepalive-time`},
+		{name: "invalid bool flag", args: []string{"-reflection=maybe"}, want: `invalid boolean value "maybe" for -reflection`},
+		{name: "invalid number flag", args: []string{"-rate-limit-method-rps", "fast"}, want: `invalid value "fast" for flag -rate-limit-method-rps`},
+		{name: "unknown flag", args: []string{"-no-such-flag"}, want: "flag provided but not defined: -no-such-flag"},
+		{name: "unknown file key", file: "listen_adr: \":1\"\n", want: "field listen_adr not found"},
+		{name: "missing file", args: []string{"-config", "/nonexistent/config.yaml"}, want: "failed to read config"},
+		{name: "validation", args: []string{"-compression", "brotli"}, want: `invalid configuration: unknown compression "brotli"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, tt.file)}, args...)
+			}
+			_, err := loadConfig(args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadConfig error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*serverConfig)
+		want   string // empty if valid
+	}{
+		{"defaults", func(c *serverConfig) {}, ""},
+		{"debug server", func(c *serverConfig) { c.DebugAddr = "localhost:6060" }, ""},
+		{"debug address without port", func(c *serverConfig) { c.DebugAddr = "localhost" }, "debug_addr"},
+		{"empty instance_id", func(c *serverConfig) { c.InstanceID = "" }, "instance_id must not be empty"},
+		{"listen address without port", func(c *serverConfig) { c.ListenAddr = "localhost" }, "listen_addr"},
+		{"zero max_recv_msg_size", func(c *serverConfig) { c.MaxRecvMsgSize = 0 }, "max_recv_msg_size must be positive"},
+		{"negative max_send_msg_size", func(c *serverConfig) { c.MaxSendMsgSize = -1 }, "max_send_msg_size must be positive"},
+		{"negative max_concurrent_streams", func(c *serverConfig) { c.MaxConcurrentStreams = -1 }, "max_concurrent_streams out of range"},
+		{"gzip", func(c *serverConfig) { c.Compression = "gzip" }, ""},
+		{"zstd preferred over gzip", func(c *serverConfig) { c.Compression = "zstd, gzip" }, ""},
+		{"unknown compression", func(c *serverConfig) { c.Compression = "gzip,br" }, `unknown compression "br"`},
+		{"negative compression_min_size", func(c *serverConfig) { c.CompressionMinSize = -1 }, "compression_min_size must not be negative"},
+		{"response cache", func(c *serverConfig) { c.ResponseCache.Enabled = true }, ""},
+		{"response cache without entries", func(c *serverConfig) {
+			c.ResponseCache.Enabled, c.ResponseCache.MaxEntries = true, 0
+		}, "response_cache: max_entries must be positive"},
+		{"response cache without TTL", func(c *serverConfig) {
+			c.ResponseCache.Enabled, c.ResponseCache.DefaultTTL = true, 0
+		}, "response_cache: default_ttl must be positive"},
+		{"disabled response cache is not checked", func(c *serverConfig) { c.ResponseCache.MaxBytes = 0 }, ""},
+		{"negative max_stream_duration", func(c *serverConfig) { c.MaxStreamDuration = -time.Second }, "max_stream_duration must not be negative"},
+		{"negative keepalive.min_time", func(c *serverConfig) { c.Keepalive.MinTime = -time.Second }, "keepalive.min_time must not be negative"},
+		{"negative keepalive.time", func(c *serverConfig) { c.Keepalive.Time = -time.Second }, "keepalive.time must not be negative"},
+		{"negative keepalive.timeout", func(c *serverConfig) { c.Keepalive.Timeout = -time.Second }, "keepalive.timeout must not be negative"},
+		{"negative max_connection_idle", func(c *serverConfig) { c.Keepalive.MaxConnectionIdle = -time.Second }, "keepalive.max_connection_idle must not be negative"},
+		{"negative max_connection_age", func(c *serverConfig) { c.Keepalive.MaxConnectionAge = -time.Second }, "keepalive.max_connection_age must not be negative"},
+		{"negative max_connection_age_grace", func(c *serverConfig) { c.Keepalive.MaxConnectionAgeGrace = -time.Second }, "keepalive.max_connection_age_grace must not be negative"},
+		{"TLS certificate without key", func(c *serverConfig) { c.TLS.CertFile = "server.crt" }, "tls: both a certificate and a key are required"},
+		{"negative TLS reload interval", func(c *serverConfig) {
+			c.TLS.CertFile, c.TLS.KeyFile, c.TLS.ReloadInterval = "server.crt", "server.key", -time.Second
+		}, "tls: negative TLS reload interval"},
+		{"unknown trace exporter", func(c *serverConfig) { c.Tracing.Exporter = "jaeger" }, "unknown trace exporter"},
+		{"negative max_in_flight", func(c *serverConfig) { c.RateLimit.MaxInFlight = -1 }, "rate_limit: max_in_flight must not be negative"},
+		{"negative method rate", func(c *serverConfig) { c.RateLimit.Method.Rate = -1 }, "rate_limit: method: rate and burst must not be negative"},
+		{"negative caller burst", func(c *serverConfig) { c.RateLimit.Caller.Burst = -1 }, "rate_limit: caller: rate and burst must not be negative"},
+		{"short method name", func(c *serverConfig) {
+			c.RateLimit.Methods = map[string]rateLimit{"SayHello": {Rate: 1}}
+		}, "rate_limit: methods: \"SayHello\" is not a full method name"},
+		{"negative per-method rate", func(c *serverConfig) {
+			c.RateLimit.Methods = map[string]rateLimit{"/hello.HelloService/SayHello": {Rate: -1}}
+		}, "rate_limit: /hello.HelloService/SayHello: rate and burst must not be negative"},
+		{"invalid trusted proxy", func(c *serverConfig) { c.RateLimit.TrustedProxies = "kong" }, "rate_limit: trusted_proxies"},
+		{"no trusted proxies", func(c *serverConfig) { c.RateLimit.TrustedProxies = "" }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			tt.modify(&cfg)
+			err := cfg.validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("validate: %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("validate error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	if _, err := loadConfig([]string{"-config", "config.example.yaml"}); err != nil {
+		t.Errorf("config.example.yaml: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/admin"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+)
+
+// activeRPC is an RPC in progress, as shown on /debug/streams.
+type activeRPC struct {
+	method   string
+	peer     string
+	callerIP string // x-forwarded-for, set by Kong
+	stream   bool
+	start    time.Time
+	deadline time.Time
+
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+// activeRPCs tracks the RPCs currently being handled, so streams stuck
+// behind Kong can be found by peer, method and age.
+type activeRPCs struct {
+	mu   sync.Mutex
+	next uint64
+	rpcs map[uint64]*activeRPC
+}
+
+func newActiveRPCs() *activeRPCs {
+	return &activeRPCs{rpcs: make(map[uint64]*activeRPC)}
+}
+
+// begin records an RPC and returns it with a function that removes it.
+func (a *activeRPCs) begin(ctx context.Context, method string, stream bool) (*activeRPC, func()) {
+	rpc := &activeRPC{method: method, stream: stream, start: time.Now()}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		rpc.peer = p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		rpc.callerIP = strings.Join(md.Get("x-forwarded-for"), ", ")
+	}
+	rpc.deadline, _ = ctx.Deadline()
+
+	a.mu.Lock()
+	a.next++
+	id := a.next
+	a.rpcs[id] = rpc
+	a.mu.Unlock()
+	return rpc, func() {
+		a.mu.Lock()
+		delete(a.rpcs, id)
+		a.mu.Unlock()
+	}
+}
+
+func (a *activeRPCs) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	_, done := a.begin(ctx, info.FullMethod, false)
+	defer done()
+	return handler(ctx, req)
+}
+
+func (a *activeRPCs) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	rpc, done := a.begin(ss.Context(), info.FullMethod, true)
+	defer done()
+	return handler(srv, &trackedStream{ServerStream: ss, rpc: rpc})
+}
+
+// trackedStream counts the messages of an active stream.
+type trackedStream struct {
+	grpc.ServerStream
+	rpc *activeRPC
+}
+
+func (s *trackedStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.rpc.sent.Add(1)
+	}
+	return err
+}
+
+func (s *trackedStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.rpc.received.Add(1)
+	}
+	return err
+}
+
+// rpcInfo is the JSON form of an activeRPC.
+type rpcInfo struct {
+	Method   string    `json:"method"`
+	Peer     string    `json:"peer"`
+	CallerIP string    `json:"caller_ip,omitempty"`
+	Stream   bool      `json:"stream"`
+	Start    time.Time `json:"start"`
+	Age      string    `json:"age"`
+	Deadline string    `json:"deadline,omitempty"` // time left
+	Sent     int64     `json:"messages_sent"`
+	Received int64     `json:"messages_received"`
+}
+
+// snapshot returns the active RPCs, oldest first.
+func (a *activeRPCs) snapshot() []rpcInfo {
+	now := time.Now()
+	a.mu.Lock()
+	infos := make([]rpcInfo, 0, len(a.rpcs))
+	for _, rpc := range a.rpcs {
+		info := rpcInfo{
+			Method:   rpc.method,
+			Peer:     rpc.peer,
+			CallerIP: rpc.callerIP,
+			Stream:   rpc.stream,
+			Start:    rpc.start,
+			Age:      now.Sub(rpc.start).Round(time.Millisecond).String(),
+			Sent:     rpc.sent.Load(),
+			Received: rpc.received.Load(),
+		}
+		if !rpc.deadline.IsZero() {
+			info.Deadline = rpc.deadline.Sub(now).Round(time.Millisecond).String()
+		}
+		infos = append(infos, info)
+	}
+	a.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Start.Before(infos[j].Start) })
+	return infos
+}
+
+var streamsPage = template.Must(template.New("streams").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Active RPCs</title></head>
+<body>
+<h1>Active RPCs ({{len .}})</h1>
+<p><a href="/debug/streams?format=json">JSON</a> · <a href="/debug/pprof/">pprof</a></p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Method</th><th>Type</th><th>Peer</th><th>X-Forwarded-For</th><th>Age</th><th>Deadline</th><th>Sent</th><th>Received</th></tr>
+{{range .}}<tr><td>{{.Method}}</td><td>{{if .Stream}}stream{{else}}unary{{end}}</td><td>{{.Peer}}</td><td>{{.CallerIP}}</td><td>{{.Age}}</td><td>{{.Deadline}}</td><td>{{.Sent}}</td><td>{{.Received}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// ServeHTTP renders the active RPCs as an HTML table, or as JSON with ?format=json.
+func (a *activeRPCs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	infos := a.snapshot()
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(infos)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := streamsPage.Execute(w, infos); err != nil {
+		log.Printf("Failed to render /debug/streams: %v", err)
+	}
+}
+
+// newDebugHandler serves pprof and the active RPC page over HTTP, and the
+// gRPC admin services (channelz, plus CSDS if xDS is linked in) with
+// reflection over HTTP/2 on the same port, e.g. "grpcurl -plaintext
+// localhost:6060 grpc.channelz.v1.Channelz/GetServers". Channelz reports on
+// every server and client in the process. The returned function releases the
+// admin services.
+func newDebugHandler(rpcs *activeRPCs) (http.Handler, func(), error) {
+	adminServer := grpc.NewServer()
+	cleanup, err := admin.Register(adminServer)
+	if err != nil {
+		return nil, nil, err
+	}
+	reflection.Register(adminServer)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/streams", rpcs)
+	mux.Handle("/{$}", http.RedirectHandler("/debug/streams", http.StatusFound))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			adminServer.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+	return h2c.NewHandler(handler, &http2.Server{}), func() {
+		adminServer.Stop()
+		cleanup()
+	}, nil
+}
+
+// serveDebug exposes newDebugHandler on addr. It has no authentication, so
+// addr should not be reachable from outside the host or cluster.
+func serveDebug(addr string, rpcs *activeRPCs) (*http.Server, func(), error) {
+	handler, cleanup, err := newDebugHandler(rpcs)
+	if err != nil {
+		return nil, nil, err
+	}
+	// No write timeout: CPU profiles and traces stream for their duration.
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		log.Printf("Debug server (pprof, channelz, admin) starting on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Debug server failed: %v", err)
+		}
+	}()
+	return srv, cleanup, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	pb "grpc-server/pb"
+)
+
+// newDebugTestServer serves the debug handler for s on a plain HTTP listener.
+func newDebugTestServer(t *testing.T, s *testServer) *httptest.Server {
+	t.Helper()
+	handler, cleanup, err := newDebugHandler(s.rpcs)
+	if err != nil {
+		t.Fatalf("newDebugHandler: %v", err)
+	}
+	t.Cleanup(cleanup)
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func get(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", url, resp.Status)
+	}
+	return string(body)
+}
+
+func TestDebugStreams(t *testing.T) {
+	s := newTestServer(t, nil)
+	ts := newDebugTestServer(t, s)
+
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "x-forwarded-for", "203.0.113.7"))
+	defer cancel()
+	stream, err := s.client.SayHelloServerStream(ctx, &pb.HelloRequest{
+		Name: "Stuck", Count: proto.Uint32(100), IntervalMs: proto.Uint32(50),
+	})
+	if err != nil {
+		t.Fatalf("SayHelloServerStream: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+
+	var infos []rpcInfo
+	if err := json.Unmarshal([]byte(get(t, ts.URL+"/debug/streams?format=json")), &infos); err != nil {
+		t.Fatalf("decode /debug/streams: %v", err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("active RPCs = %+v, want the stream", infos)
+	}
+	got := infos[0]
+	if got.Method != "/hello.HelloService/SayHelloServerStream" || !got.Stream || got.Peer == "" || got.CallerIP != "203.0.113.7" || got.Sent < 1 {
+		t.Errorf("active RPC = %+v", got)
+	}
+	if page := get(t, ts.URL+"/debug/streams"); !strings.Contains(page, "SayHelloServerStream") || !strings.Contains(page, "203.0.113.7") {
+		t.Errorf("/debug/streams page does not list the stream:\n%s", page)
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for len(s.rpcs.snapshot()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stream still listed after cancel: %+v", s.rpcs.snapshot())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if page := get(t, ts.URL+"/debug/pprof/"); !strings.Contains(page, "goroutine") {
+		t.Errorf("/debug/pprof/ does not list profiles")
+	}
+}
+
+func TestDebugAdminServices(t *testing.T) {
+	s := newTestServer(t, nil)
+	ts := newDebugTestServer(t, s)
+	if _, err := s.client.SayHello(context.Background(), &pb.HelloRequest{Name: "Channelz"}); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+
+	// gRPC clients speak HTTP/2 with prior knowledge, which the h2c handler accepts.
+	conn, err := grpc.NewClient(strings.TrimPrefix(ts.URL, "http://"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial debug server: %v", err)
+	}
+	defer conn.Close()
+	resp, err := channelzpb.NewChannelzClient(conn).GetServers(context.Background(), &channelzpb.GetServersRequest{})
+	if err != nil {
+		t.Fatalf("channelz GetServers: %v", err)
+	}
+	var calls int64
+	for _, server := range resp.GetServer() {
+		calls += server.GetData().GetCallsSucceeded()
+	}
+	if calls == 0 {
+		t.Errorf("channelz reports %d servers without successful calls", len(resp.GetServer()))
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"grpc-server/pb/echostorepb"
+)
+
+const (
+	defaultListPageSize = 100
+	// watchBuffer is how many events a watcher may fall behind before its
+	// stream is ended with ABORTED.
+	watchBuffer = 64
+)
+
+// storeWatcher receives the Puts to keys with prefix.
+type storeWatcher struct {
+	prefix string
+	events chan *echostorepb.Entry
+}
+
+// echoStoreServer implements EchoStoreService with an in-memory map. Entries
+// are not persisted and are lost on restart. A Put replaces the stored entry
+// instead of modifying it, so entries are shared with callers without copying.
+type echoStoreServer struct {
+	echostorepb.UnimplementedEchoStoreServiceServer
+
+	mu       sync.Mutex
+	entries  map[string]*echostorepb.Entry
+	watchers map[*storeWatcher]struct{}
+}
+
+func newEchoStoreServer() *echoStoreServer {
+	return &echoStoreServer{
+		entries:  make(map[string]*echostorepb.Entry),
+		watchers: make(map[*storeWatcher]struct{}),
+	}
+}
+
+func (s *echoStoreServer) Get(ctx context.Context, req *echostorepb.GetRequest) (*echostorepb.Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[req.GetKey()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "key %q not found", req.GetKey())
+	}
+	return entry, nil
+}
+
+func (s *echoStoreServer) Put(ctx context.Context, req *echostorepb.PutRequest) (*echostorepb.Entry, error) {
+	log.Printf("Received Put request: key=%s", req.GetKey())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &echostorepb.Entry{
+		Key:        req.GetKey(),
+		Value:      req.GetValue(),
+		Version:    1,
+		UpdateTime: timestamppb.Now(),
+	}
+	if old, ok := s.entries[req.GetKey()]; ok {
+		entry.Version = old.GetVersion() + 1
+	}
+	s.entries[entry.GetKey()] = entry
+
+	for w := range s.watchers {
+		if !strings.HasPrefix(entry.GetKey(), w.prefix) {
+			continue
+		}
+		select {
+		case w.events <- entry:
+		default:
+			// Closing the channel tells Watch the watcher fell behind.
+			close(w.events)
+			delete(s.watchers, w)
+		}
+	}
+	return entry, nil
+}
+
+func (s *echoStoreServer) List(ctx context.Context, req *echostorepb.ListRequest) (*echostorepb.ListResponse, error) {
+	pageSize := int(req.GetPageSize())
+	if pageSize == 0 {
+		pageSize = defaultListPageSize
+	}
+	// The page token is the last key of the previous page.
+	var after string
+	if req.GetPageToken() != "" {
+		key, err := base64.RawURLEncoding.DecodeString(req.GetPageToken())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		after = string(key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := s.keys(req.GetPrefix())
+	start := sort.SearchStrings(keys, after)
+	if start < len(keys) && after != "" && keys[start] == after {
+		start++
+	}
+
+	resp := &echostorepb.ListResponse{}
+	for _, key := range keys[start:] {
+		if len(resp.Entries) == pageSize {
+			resp.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(resp.Entries[pageSize-1].GetKey()))
+			break
+		}
+		resp.Entries = append(resp.Entries, s.entries[key])
+	}
+	return resp, nil
+}
+
+// keys returns the sorted keys with prefix. s.mu must be held.
+func (s *echoStoreServer) keys(prefix string) []string {
+	var keys []string
+	for key := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *echoStoreServer) Watch(req *echostorepb.WatchRequest, stream echostorepb.EchoStoreService_WatchServer) error {
+	log.Printf("Received Watch request: prefix=%q", req.GetPrefix())
+	w := &storeWatcher{prefix: req.GetPrefix(), events: make(chan *echostorepb.Entry, watchBuffer)}
+
+	// The snapshot is taken under the same lock that registers the watcher,
+	// so no Put is missed or sent twice.
+	s.mu.Lock()
+	var initial []*echostorepb.Entry
+	if req.GetSendInitial() {
+		for _, key := range s.keys(req.GetPrefix()) {
+			initial = append(initial, s.entries[key])
+		}
+	}
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watchers, w)
+	}()
+
+	for _, entry := range initial {
+		if err := stream.Send(&echostorepb.WatchEvent{Entry: entry, Initial: true}); err != nil {
+			return err
+		}
+	}
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case entry, ok := <-w.events:
+			if !ok {
+				return status.Errorf(codes.Aborted, "watcher fell more than %d events behind", watchBuffer)
+			}
+			if err := stream.Send(&echostorepb.WatchEvent{Entry: entry}); err != nil {
+				return err
+			}
+		}
+	}
+}
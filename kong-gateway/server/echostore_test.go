@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"grpc-server/pb/echostorepb"
+)
+
+func TestEchoStorePutGet(t *testing.T) {
+	s := newTestServer(t, nil)
+	store := echostorepb.NewEchoStoreServiceClient(s.conn)
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, &echostorepb.GetRequest{Key: "greeting"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Get before Put: %v, want NotFound", err)
+	}
+	for i, value := range []string{"hello", "hi"} {
+		entry, err := store.Put(ctx, &echostorepb.PutRequest{Key: "greeting", Value: value})
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if entry.GetVersion() != int64(i+1) || entry.GetUpdateTime() == nil {
+			t.Errorf("Put returned version %d, update_time %v; want version %d", entry.GetVersion(), entry.GetUpdateTime(), i+1)
+		}
+	}
+	entry, err := store.Get(ctx, &echostorepb.GetRequest{Key: "greeting"})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if entry.GetValue() != "hi" || entry.GetVersion() != 2 {
+		t.Errorf("Get = %q version %d, want %q version 2", entry.GetValue(), entry.GetVersion(), "hi")
+	}
+
+	// Requests are validated by the same interceptor as HelloService.
+	if _, err := store.Put(ctx, &echostorepb.PutRequest{Key: "bad key!"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Put with invalid key: %v, want InvalidArgument", err)
+	}
+}
+
+func TestEchoStoreList(t *testing.T) {
+	s := newTestServer(t, nil)
+	store := echostorepb.NewEchoStoreServiceClient(s.conn)
+	ctx := context.Background()
+
+	for _, key := range []string{"b/2", "a/1", "b/1", "b/3", "c/1"} {
+		if _, err := store.Put(ctx, &echostorepb.PutRequest{Key: key, Value: key}); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+
+	var pages [][]string
+	req := &echostorepb.ListRequest{Prefix: "b/", PageSize: 2}
+	for {
+		resp, err := store.List(ctx, req)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		var keys []string
+		for _, e := range resp.GetEntries() {
+			keys = append(keys, e.GetKey())
+		}
+		pages = append(pages, keys)
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+	if got, want := fmt.Sprint(pages), "[[b/1 b/2] [b/3]]"; got != want {
+		t.Errorf("pages = %s, want %s", got, want)
+	}
+
+	_, err := store.List(ctx, &echostorepb.ListRequest{PageToken: "!"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("List with invalid token: %v, want InvalidArgument", err)
+	}
+}
+
+func TestEchoStoreWatch(t *testing.T) {
+	s := newTestServer(t, nil)
+	store := echostorepb.NewEchoStoreServiceClient(s.conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := store.Put(ctx, &echostorepb.PutRequest{Key: "app/existing", Value: "1"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	stream, err := store.Watch(ctx, &echostorepb.WatchRequest{Prefix: "app/", SendInitial: true})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv initial: %v", err)
+	}
+	if !event.GetInitial() || event.GetEntry().GetKey() != "app/existing" {
+		t.Fatalf("initial event = %v", event)
+	}
+
+	// Only keys with the watched prefix are sent.
+	for _, key := range []string{"other/x", "app/new"} {
+		if _, err := store.Put(ctx, &echostorepb.PutRequest{Key: key, Value: "2"}); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+	event, err = stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if event.GetInitial() || event.GetEntry().GetKey() != "app/new" || event.GetEntry().GetValue() != "2" {
+		t.Errorf("event = %v, want the Put to app/new", event)
+	}
+
+	cancel()
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Errorf("Recv after cancel: %v, want Canceled", err)
+	}
+}
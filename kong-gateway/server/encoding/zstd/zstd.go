@@ -0,0 +1,94 @@
+// Package zstd registers a zstd compressor with gRPC. Import it for its side
+// effect, like google.golang.org/grpc/encoding/gzip; clients then advertise
+// zstd in grpc-accept-encoding and may send compressed requests with
+// grpc.UseCompressor(zstd.Name).
+package zstd
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// Name is the grpc-encoding value of the compressor.
+const Name = "zstd"
+
+// maxWindow bounds the memory a single compressed message can make the
+// decoder allocate.
+const maxWindow = 32 << 20
+
+func init() {
+	encoding.RegisterCompressor(&compressor{})
+}
+
+// compressor pools encoders and decoders, which are expensive to create.
+// With a concurrency of 1 they run synchronously and start no goroutines.
+type compressor struct {
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+func (c *compressor) Name() string {
+	return Name
+}
+
+func (c *compressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	enc, _ := c.encoders.Get().(*zstd.Encoder)
+	if enc == nil {
+		var err error
+		enc, err = zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		enc.Reset(w)
+	}
+	return &writer{Encoder: enc, pool: &c.encoders}, nil
+}
+
+func (c *compressor) Decompress(r io.Reader) (io.Reader, error) {
+	dec, _ := c.decoders.Get().(*zstd.Decoder)
+	if dec == nil {
+		var err error
+		dec, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxWindow))
+		if err != nil {
+			return nil, err
+		}
+	} else if err := dec.Reset(r); err != nil {
+		c.decoders.Put(dec)
+		return nil, err
+	}
+	return &reader{dec: dec, pool: &c.decoders}, nil
+}
+
+// writer returns its encoder to the pool on Close.
+type writer struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+func (w *writer) Close() error {
+	err := w.Encoder.Close()
+	w.pool.Put(w.Encoder)
+	return err
+}
+
+// reader returns its decoder to the pool once the message is fully read.
+type reader struct {
+	dec  *zstd.Decoder
+	pool *sync.Pool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.dec == nil {
+		return 0, io.EOF
+	}
+	n, err := r.dec.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r.dec)
+		r.dec = nil
+	}
+	return n, err
+}
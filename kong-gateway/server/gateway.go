@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "grpc-server/pb"
+)
+
+// openAPISpec is generated from hello.proto by protoc-gen-openapiv2 at build time.
+//
+//go:embed openapi/hello.swagger.json
+var openAPISpec []byte
+
+// inProcessConn serves internal on an in-memory listener and returns a client
+// connection to it, so the REST gateway reaches helloServer without a network
+// hop and without needing the TLS client certificate Kong uses.
+func inProcessConn(internal *grpc.Server) (*grpc.ClientConn, error) {
+	lis := bufconn.Listen(1 << 20)
+	go func() {
+		if err := internal.Serve(lis); err != nil {
+			log.Printf("In-process gRPC server stopped: %v", err)
+		}
+	}()
+	return grpc.NewClient("passthrough:///in-process",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+}
+
+// newRESTGateway returns a handler that transcodes REST/JSON requests into
+// HelloService calls according to the google.api.http annotations.
+func newRESTGateway(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+	gw := runtime.NewServeMux(
+		// Streams are newline-delimited JSON by default; SSE on Accept: text/event-stream.
+		runtime.WithMarshalerOption("text/event-stream", &sseMarshaler{}),
+		runtime.WithIncomingHeaderMatcher(gatewayHeaderMatcher),
+	)
+	if err := pb.RegisterHelloServiceHandler(ctx, gw, conn); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", gw)
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPISpec)
+	})
+	return mux, nil
+}
+
+// gatewayHeaderMatcher forwards W3C trace context headers in addition to the
+// defaults, so REST calls join traces started at Kong, and Kong's X-Consumer-*
+// headers for the rate limiter, which only believes them from trusted proxies.
+func gatewayHeaderMatcher(key string) (string, bool) {
+	switch lower := strings.ToLower(key); {
+	case lower == "traceparent", lower == "tracestate", strings.HasPrefix(lower, "x-consumer-"):
+		return lower, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// sseMarshaler frames each streamed message as a server-sent event.
+type sseMarshaler struct {
+	runtime.JSONPb
+}
+
+func (m *sseMarshaler) Marshal(v interface{}) ([]byte, error) {
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("data: "), data...), nil
+}
+
+func (m *sseMarshaler) Delimiter() []byte {
+	return []byte("\n\n")
+}
+
+func (m *sseMarshaler) ContentType(interface{}) string {
+	return "text/event-stream"
+}
+
+// StreamContentType implements runtime.StreamContentType.
+func (m *sseMarshaler) StreamContentType(interface{}) string {
+	return "text/event-stream"
+}
+
+func serveHTTP(addr string, handler http.Handler) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		log.Printf("HTTP gateway (REST, gRPC-Web) starting on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP gateway failed: %v", err)
+		}
+	}()
+	return srv
+}
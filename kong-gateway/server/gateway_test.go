@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// newGatewayTestServer serves the REST gateway in front of an in-process
+// server with the full interceptor chain, as main does.
+func newGatewayTestServer(t *testing.T, configure func(*serverConfig)) *httptest.Server {
+	t.Helper()
+	cfg := defaultConfig()
+	if configure != nil {
+		configure(&cfg)
+	}
+	internal := grpc.NewServer(newServerOptions(cfg, prometheus.NewRegistry(), nil)...)
+	registerServices(internal, &helloServer{}, newEchoStoreServer())
+	t.Cleanup(internal.Stop)
+	conn, err := inProcessConn(internal)
+	if err != nil {
+		t.Fatalf("inProcessConn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	handler, err := newRESTGateway(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("newRESTGateway: %v", err)
+	}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func doREST(t *testing.T, ts *httptest.Server, method, path, body string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return resp, data
+}
+
+func TestRESTGateway(t *testing.T) {
+	ts := newGatewayTestServer(t, nil)
+	tests := []struct {
+		method, path, body string
+		want               string
+	}{
+		{http.MethodGet, "/v1/hello/World", "", "Hello, World! (from gRPC server via Kong)"},
+		{http.MethodPost, "/v1/hello", `{"name": "Post"}`, "Hello, Post! (from gRPC server via Kong)"},
+	}
+	for _, tt := range tests {
+		resp, body := doREST(t, ts, tt.method, tt.path, tt.body, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s %s: status %d, body %s", tt.method, tt.path, resp.StatusCode, body)
+			continue
+		}
+		var got struct{ Message string }
+		if err := json.Unmarshal(body, &got); err != nil || got.Message != tt.want {
+			t.Errorf("%s %s: body %s, want message %q", tt.method, tt.path, body, tt.want)
+		}
+	}
+
+	resp, body := doREST(t, ts, http.MethodGet, "/openapi.json", "", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" || !json.Valid(body) {
+		t.Errorf("/openapi.json: status %d, content type %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestRESTGatewayStream(t *testing.T) {
+	ts := newGatewayTestServer(t, nil)
+	path := "/v1/hello/World/stream?count=3&interval_ms=0"
+	want := []string{"Hello World! Message 1 of 3", "Hello World! Message 2 of 3", "Hello World! Message 3 of 3"}
+
+	// Newline-delimited JSON by default.
+	resp, body := doREST(t, ts, http.MethodGet, path, "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, body %s", resp.StatusCode, body)
+	}
+	var got []string
+	scanner := bufio.NewScanner(strings.NewReader(string(body)))
+	for scanner.Scan() {
+		var line struct {
+			Result struct{ Message string }
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, line.Result.Message)
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+
+	// Server-sent events on request.
+	resp, body = doREST(t, ts, http.MethodGet, path, "", http.Header{"Accept": {"text/event-stream"}})
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("SSE: status %d, content type %s", resp.StatusCode, ct)
+	}
+	got = nil
+	for _, event := range strings.Split(strings.TrimSpace(string(body)), "\n\n") {
+		data, ok := strings.CutPrefix(event, "data: ")
+		if !ok {
+			t.Fatalf("event %q has no data field", event)
+		}
+		var msg struct {
+			Result struct{ Message string }
+		}
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("event %q: %v", event, err)
+		}
+		got = append(got, msg.Result.Message)
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("SSE messages = %q, want %q", got, want)
+	}
+}
+
+func TestRESTGatewayErrors(t *testing.T) {
+	ts := newGatewayTestServer(t, nil)
+	tests := []struct {
+		name, method, path string
+		status             int
+		code               int // gRPC code in the error body
+	}{
+		{"invalid name", http.MethodGet, "/v1/hello/no%21", http.StatusBadRequest, 3},
+		{"invalid stream count", http.MethodGet, "/v1/hello/World/stream?count=1000", http.StatusBadRequest, 3},
+		{"malformed body", http.MethodPost, "/v1/hello", http.StatusBadRequest, 3},
+		{"unknown path", http.MethodGet, "/v1/goodbye/World", http.StatusNotFound, 5},
+		{"wrong method", http.MethodDelete, "/v1/hello/World", http.StatusNotImplemented, 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := ""
+			if tt.method == http.MethodPost {
+				body = "{not json"
+			}
+			resp, data := doREST(t, ts, tt.method, tt.path, body, nil)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d (body %s)", resp.StatusCode, tt.status, data)
+			}
+			// Streams that fail before their first message wrap the status.
+			var st struct {
+				Code    int
+				Message string
+				Error   *struct {
+					Code    int
+					Message string
+				}
+			}
+			if err := json.Unmarshal(data, &st); err == nil && st.Error != nil {
+				st.Code, st.Message = st.Error.Code, st.Error.Message
+			}
+			if st.Code != tt.code || st.Message == "" {
+				t.Errorf("body %s, want code %d with a message", data, tt.code)
+			}
+		})
+	}
+}
+
+// TestRESTGatewayRateLimit checks that REST callers get buckets of their own
+// although they all reach the limiter over the in-process connection.
+func TestRESTGatewayRateLimit(t *testing.T) {
+	limited := func(trustedProxies string) *httptest.Server {
+		return newGatewayTestServer(t, func(c *serverConfig) {
+			c.RateLimit.Caller = rateLimit{Rate: 0.01, Burst: 1}
+			c.RateLimit.TrustedProxies = trustedProxies
+		})
+	}
+	forwarded := func(addr string) http.Header { return http.Header{"X-Forwarded-For": {addr}} }
+	consumer := func(id string) http.Header { return http.Header{"X-Consumer-Id": {id}} }
+
+	tests := []struct {
+		name    string
+		trusted string
+		headers []http.Header
+		want    []int
+	}{
+		{
+			// The test client connects from loopback, like a local proxy.
+			name:    "distinct forwarded callers",
+			trusted: "127.0.0.1,::1",
+			headers: []http.Header{forwarded("198.51.100.1"), forwarded("198.51.100.2"), forwarded("198.51.100.3"), forwarded("198.51.100.1")},
+			want:    []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:    "distinct consumers",
+			trusted: "127.0.0.1,::1",
+			headers: []http.Header{consumer("alice"), consumer("bob"), consumer("alice")},
+			want:    []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:    "untrusted client shares its address's bucket",
+			trusted: "",
+			headers: []http.Header{forwarded("198.51.100.1"), forwarded("198.51.100.2"), consumer("carol")},
+			want:    []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := limited(tt.trusted)
+			for i, header := range tt.headers {
+				resp, body := doREST(t, ts, http.MethodGet, "/v1/hello/World", "", header)
+				if resp.StatusCode != tt.want[i] {
+					t.Errorf("call %d with %v: status %d, want %d (body %s)", i+1, header, resp.StatusCode, tt.want[i], body)
+				}
+			}
+		})
+	}
+}
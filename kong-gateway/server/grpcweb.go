@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+)
+
+// newGRPCWebHandler wraps server so browsers can call it with gRPC-Web over
+// plain HTTP/1.1, including server streaming. allowedOrigins is the CORS
+// allow-list; it is empty by default, which only admits same-origin and
+// non-browser clients, and "*" explicitly allows any origin.
+func newGRPCWebHandler(server *grpc.Server, allowedOrigins []string) *grpcweb.WrappedGrpcServer {
+	return grpcweb.WrapServer(server,
+		grpcweb.WithOriginFunc(originMatcher(allowedOrigins)),
+		grpcweb.WithAllowedRequestHeaders([]string{"*"}),
+	)
+}
+
+func originMatcher(allowedOrigins []string) func(string) bool {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, o := range allowedOrigins {
+		if o = strings.TrimSpace(o); o != "" {
+			allowed[o] = true
+		}
+	}
+	return func(origin string) bool {
+		return allowed["*"] || allowed[origin]
+	}
+}
+
+// withGRPCWeb routes gRPC-Web requests and their CORS preflights to grpcWeb
+// and everything else to next.
+func withGRPCWeb(grpcWeb *grpcweb.WrappedGrpcServer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if grpcWeb.IsGrpcWebRequest(r) || grpcWeb.IsAcceptableGrpcCorsRequest(r) {
+			grpcWeb.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	pb "grpc-server/pb"
+)
+
+// newGRPCWebTestServer serves helloServer over gRPC-Web on a plain HTTP/1.1 listener.
+func newGRPCWebTestServer(t *testing.T, origins ...string) *httptest.Server {
+	t.Helper()
+	server := grpc.NewServer()
+	pb.RegisterHelloServiceServer(server, &helloServer{})
+	ts := httptest.NewServer(withGRPCWeb(newGRPCWebHandler(server, origins), http.NotFoundHandler()))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// grpcWebFrame encodes msg as an uncompressed gRPC-Web data frame.
+func grpcWebFrame(t *testing.T, msg proto.Message) []byte {
+	t.Helper()
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	frame := make([]byte, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[5:], data)
+	return frame
+}
+
+// readGRPCWebFrames splits a gRPC-Web response body into data messages and the trailer frame.
+func readGRPCWebFrames(t *testing.T, body io.Reader) ([][]byte, http.Header) {
+	t.Helper()
+	var messages [][]byte
+	trailer := http.Header{}
+	r := bufio.NewReader(body)
+	for {
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return messages, trailer
+		} else if err != nil {
+			t.Fatalf("read frame header: %v", err)
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[1:5]))
+		if _, err := io.ReadFull(r, payload); err != nil {
+			t.Fatalf("read frame payload: %v", err)
+		}
+		if header[0]&0x80 == 0 {
+			messages = append(messages, payload)
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(payload)), "\r\n") {
+			if k, v, ok := strings.Cut(line, ":"); ok {
+				trailer.Set(strings.TrimSpace(k), strings.TrimSpace(v))
+			}
+		}
+	}
+}
+
+func postGRPCWeb(t *testing.T, ts *httptest.Server, method string, req proto.Message) *http.Response {
+	t.Helper()
+	httpReq, err := http.NewRequest(http.MethodPost, ts.URL+method, bytes.NewReader(grpcWebFrame(t, req)))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/grpc-web+proto")
+	httpReq.Header.Set("X-Grpc-Web", "1")
+	resp, err := ts.Client().Do(httpReq)
+	if err != nil {
+		t.Fatalf("post %s: %v", method, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.ProtoMajor != 1 {
+		t.Fatalf("expected HTTP/1.x, got %s", resp.Proto)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	return resp
+}
+
+func TestGRPCWebUnary(t *testing.T) {
+	// Requests without an Origin header are not CORS requests, so they work
+	// with the default empty allow-list.
+	ts := newGRPCWebTestServer(t)
+
+	resp := postGRPCWeb(t, ts, "/hello.HelloService/SayHello", &pb.HelloRequest{Name: "Browser"})
+	messages, trailer := readGRPCWebFrames(t, resp.Body)
+
+	if got := trailer.Get("grpc-status"); got != "0" {
+		t.Fatalf("grpc-status = %q, want 0 (message %q)", got, trailer.Get("grpc-message"))
+	}
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	var reply pb.HelloResponse
+	if err := proto.Unmarshal(messages[0], &reply); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !strings.Contains(reply.Message, "Hello, Browser!") {
+		t.Errorf("message = %q", reply.Message)
+	}
+}
+
+func TestGRPCWebServerStream(t *testing.T) {
+	ts := newGRPCWebTestServer(t)
+
+	resp := postGRPCWeb(t, ts, "/hello.HelloService/SayHelloServerStream", &pb.HelloRequest{Name: "Browser"})
+	messages, trailer := readGRPCWebFrames(t, resp.Body)
+
+	if got := trailer.Get("grpc-status"); got != "0" {
+		t.Fatalf("grpc-status = %q, want 0 (message %q)", got, trailer.Get("grpc-message"))
+	}
+	if len(messages) != 5 {
+		t.Fatalf("got %d messages, want 5", len(messages))
+	}
+	for i, m := range messages {
+		var reply pb.HelloResponse
+		if err := proto.Unmarshal(m, &reply); err != nil {
+			t.Fatalf("unmarshal message %d: %v", i, err)
+		}
+		if !strings.HasPrefix(reply.Message, "Hello Browser! Message") {
+			t.Errorf("message %d = %q", i, reply.Message)
+		}
+	}
+}
+
+func TestGRPCWebCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins []string
+		origin  string
+		allowed bool
+	}{
+		{"listed origin", []string{"http://localhost:3000"}, "http://localhost:3000", true},
+		{"unlisted origin", []string{"http://localhost:3000"}, "http://evil.example", false},
+		{"default", []string{""}, "http://localhost:3000", false},
+		{"any origin", []string{"*"}, "http://evil.example", true},
+	}
+	for _, tt := range tests {
+		ts := newGRPCWebTestServer(t, tt.origins...)
+		req, _ := http.NewRequest(http.MethodOptions, ts.URL+"/hello.HelloService/SayHello", nil)
+		req.Header.Set("Origin", tt.origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s: preflight: %v", tt.name, err)
+		}
+		resp.Body.Close()
+
+		got := resp.Header.Get("Access-Control-Allow-Origin")
+		if tt.allowed && got != tt.origin {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", tt.name, got, tt.origin)
+		}
+		if !tt.allowed && got != "" {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want none", tt.name, got)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// clientIdentity is the verified identity of an mTLS client (e.g. Kong).
+type clientIdentity struct {
+	CommonName   string
+	DNSNames     []string
+	URIs         []string
+	SerialNumber string
+}
+
+type clientIdentityKey struct{}
+
+// clientIdentityFromContext returns the identity extracted by the identity
+// interceptors, if the caller presented a verified client certificate.
+func clientIdentityFromContext(ctx context.Context) (*clientIdentity, bool) {
+	id, ok := ctx.Value(clientIdentityKey{}).(*clientIdentity)
+	return id, ok
+}
+
+// name returns the most specific name of the client: its first URI SAN
+// (e.g. a SPIFFE ID), common name or first DNS SAN, else its serial number.
+func (id *clientIdentity) name() string {
+	switch {
+	case len(id.URIs) > 0:
+		return id.URIs[0]
+	case id.CommonName != "":
+		return id.CommonName
+	case len(id.DNSNames) > 0:
+		return id.DNSNames[0]
+	}
+	return "serial:" + id.SerialNumber
+}
+
+func identityFromPeer(ctx context.Context) *clientIdentity {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return newClientIdentity(info.State.VerifiedChains[0][0])
+}
+
+func newClientIdentity(cert *x509.Certificate) *clientIdentity {
+	id := &clientIdentity{
+		CommonName:   cert.Subject.CommonName,
+		DNSNames:     cert.DNSNames,
+		SerialNumber: cert.SerialNumber.String(),
+	}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+	}
+	return id
+}
+
+func withClientIdentity(ctx context.Context) context.Context {
+	if id := identityFromPeer(ctx); id != nil {
+		return context.WithValue(ctx, clientIdentityKey{}, id)
+	}
+	return ctx
+}
+
+func identityUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(withClientIdentity(ctx), req)
+}
+
+func identityStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{ServerStream: ss, ctx: withClientIdentity(ss.Context())})
+}
+
+// contextStream overrides the context of a server stream so interceptors can
+// pass values down to stream handlers.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// instanceIDHeader identifies the replica that handled an RPC. It is sent
+// both as a header and as a trailer, so it is also available on calls that
+// fail before any response header is sent.
+const instanceIDHeader = "x-instance-id"
+
+// defaultInstanceID is the hostname, which is the container ID under Docker.
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}
+
+// instanceID attaches id to every RPC. It runs first in the chain so that
+// RPCs rejected by the rate limiter or validation carry it too.
+type instanceID string
+
+func (id instanceID) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md := metadata.Pairs(instanceIDHeader, string(id))
+	grpc.SetHeader(ctx, md)
+	grpc.SetTrailer(ctx, md)
+	return handler(ctx, req)
+}
+
+func (id instanceID) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	md := metadata.Pairs(instanceIDHeader, string(id))
+	ss.SetHeader(md)
+	ss.SetTrailer(md)
+	return handler(srv, ss)
+}
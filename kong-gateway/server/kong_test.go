@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"grpc-server/client"
+	"grpc-server/kongtest"
+	pb "grpc-server/pb"
+)
+
+// helloRoute is grpc-hello-route from kong.yaml with the given plugins.
+func helloRoute(plugins ...kongtest.Plugin) kongtest.Route {
+	return kongtest.Route{Name: "grpc-hello-route", Paths: []string{"/hello.HelloService"}, Plugins: plugins}
+}
+
+// newKongTestServer is newTestServer on a TCP port behind a Kong stand-in
+// with routes; the returned client calls through the stand-in.
+func newKongTestServer(t *testing.T, configure func(*serverConfig), routes ...kongtest.Route) (*testServer, *kongtest.Proxy) {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.InstanceID = "kong-test"
+	if configure != nil {
+		configure(&cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("invalid test config: %v", err)
+	}
+
+	reg := prometheus.NewRegistry()
+	rpcs := newActiveRPCs()
+	server := newServer(cfg, &helloServer{}, newEchoStoreServer(), newServerOptions(cfg, reg, rpcs)...)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	kong, err := kongtest.NewProxy(lis.Addr().String(), routes...)
+	if err != nil {
+		t.Fatalf("start Kong stand-in: %v", err)
+	}
+	t.Cleanup(func() { kong.Close() })
+
+	conn, err := grpc.NewClient(kong.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial Kong stand-in: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testServer{conn: conn, client: pb.NewHelloServiceClient(conn), reg: reg, rpcs: rpcs}, kong
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func TestKongRouting(t *testing.T) {
+	s, _ := newKongTestServer(t, nil, helloRoute())
+	ctx := context.Background()
+
+	var header, trailer metadata.MD
+	resp, err := s.client.SayHello(ctx, &pb.HelloRequest{Name: "Kong"}, grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		t.Fatalf("SayHello through Kong: %v", err)
+	}
+	if !strings.Contains(resp.GetMessage(), "Hello, Kong!") {
+		t.Errorf("SayHello = %q", resp.GetMessage())
+	}
+	if got := firstValue(header, "via"); got != "kong/"+kongtest.Version {
+		t.Errorf("via = %q, want kong/%s", got, kongtest.Version)
+	}
+	if firstValue(header, instanceIDHeader) != "kong-test" || firstValue(trailer, instanceIDHeader) != "kong-test" {
+		t.Errorf("%s not passed through: header %v, trailer %v", instanceIDHeader, header, trailer)
+	}
+
+	stream, err := s.client.SayHelloServerStream(ctx, &pb.HelloRequest{Name: "Kong", Count: proto.Uint32(3), IntervalMs: proto.Uint32(0)})
+	if err != nil {
+		t.Fatalf("SayHelloServerStream through Kong: %v", err)
+	}
+	if messages, err := recvAll(stream); err != nil || len(messages) != 3 {
+		t.Errorf("stream through Kong got %d messages, err %v", len(messages), err)
+	}
+
+	// Server errors keep their details through the proxy.
+	_, err = s.client.SayHello(ctx, &pb.HelloRequest{})
+	if fields := client.FieldViolations(err); status.Code(err) != codes.InvalidArgument || len(fields["name"]) == 0 {
+		t.Errorf("invalid request through Kong: %v, violations %v", err, fields)
+	}
+
+	// Kong answers requests outside its routes itself.
+	trailer = nil
+	err = s.conn.Invoke(ctx, "/echostore.v1.EchoStoreService/Get", &pb.HelloRequest{}, &pb.HelloResponse{}, grpc.Trailer(&trailer))
+	if st := status.Convert(err); st.Code() != codes.NotFound || st.Message() != "no Route matched with those values" {
+		t.Errorf("unrouted call: %v, want NotFound from Kong", err)
+	}
+	if firstValue(trailer, instanceIDHeader) != "" {
+		t.Errorf("unrouted call reached the server: %v", trailer)
+	}
+}
+
+func TestKongHeaders(t *testing.T) {
+	consumers := map[string]kongtest.Consumer{
+		"alice-key": {ID: "consumer-alice", Username: "alice"},
+		"bob-key":   {ID: "consumer-bob", Username: "bob"},
+		"carol-key": {ID: "consumer-carol", Username: "carol"},
+	}
+	s, _ := newKongTestServer(t,
+		func(c *serverConfig) { c.RateLimit.Caller = rateLimit{Rate: 0.01, Burst: 1} },
+		helloRoute(
+			kongtest.CorrelationID{HeaderName: "Kong-Request-ID", EchoDownstream: true},
+			kongtest.KeyAuth{Consumers: consumers},
+		),
+	)
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "apikey", key)
+	}
+
+	var header metadata.MD
+	if _, err := s.client.SayHello(withKey("alice-key"), &pb.HelloRequest{Name: "Alice"}, grpc.Header(&header)); err != nil {
+		t.Fatalf("alice: %v", err)
+	}
+	if firstValue(header, "kong-request-id") == "" {
+		t.Errorf("kong-request-id not echoed: %v", header)
+	}
+
+	// Every call arrives from Kong's address, so the server's per-caller
+	// limit must key on the X-Consumer-ID that key-auth injects.
+	var trailer metadata.MD
+	_, err := s.client.SayHello(withKey("alice-key"), &pb.HelloRequest{Name: "Alice"}, grpc.Trailer(&trailer))
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted || firstValue(trailer, instanceIDHeader) != "kong-test" {
+		t.Fatalf("second alice call: %v (trailer %v), want ResourceExhausted from the server", err, trailer)
+	}
+	if _, ok := client.RetryDelay(err); !ok || firstValue(trailer, "grpc-retry-pushback-ms") == "" {
+		t.Errorf("server rate limit lost RetryInfo or pushback through Kong: %v, trailer %v", st.Details(), trailer)
+	}
+	if _, err := s.client.SayHello(withKey("bob-key"), &pb.HelloRequest{Name: "Bob"}); err != nil {
+		t.Errorf("bob was limited by alice's bucket: %v", err)
+	}
+	limited := s.counter(t, "grpc_server_rate_limited_total", map[string]string{"limit": "caller"})
+	if limited != 1 {
+		t.Errorf("caller rejections = %v, want 1", limited)
+	}
+
+	// Kong's own rejections never reach the server.
+	for key, want := range map[string]string{"": "No API key found in request", "mallory-key": "Invalid authentication credentials"} {
+		ctx := context.Background()
+		if key != "" {
+			ctx = withKey(key)
+		}
+		trailer = nil
+		_, err := s.client.SayHello(ctx, &pb.HelloRequest{Name: "Mallory"}, grpc.Trailer(&trailer))
+		if st := status.Convert(err); st.Code() != codes.Unauthenticated || st.Message() != want {
+			t.Errorf("apikey %q: %v, want Unauthenticated %q", key, err, want)
+		}
+		if firstValue(trailer, instanceIDHeader) != "" {
+			t.Errorf("apikey %q: call reached the server", key)
+		}
+	}
+
+	// The server sees the client address in X-Forwarded-For, not just Kong as the peer.
+	ctx, cancel := context.WithCancel(withKey("carol-key"))
+	defer cancel()
+	stream, err := s.client.SayHelloServerStream(ctx, &pb.HelloRequest{Name: "Carol", Count: proto.Uint32(100), IntervalMs: proto.Uint32(50)})
+	if err != nil {
+		t.Fatalf("SayHelloServerStream: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if rpcs := s.rpcs.snapshot(); len(rpcs) != 1 || rpcs[0].CallerIP != "127.0.0.1" {
+		t.Errorf("active RPCs = %+v, want the stream with X-Forwarded-For 127.0.0.1", rpcs)
+	}
+}
+
+func TestKongRequestTransformer(t *testing.T) {
+	// Like grpc-echostore-canary-route: a header route that injects a header
+	// wins over the plain route with the same path.
+	fresh := kongtest.Route{
+		Name:    "grpc-hello-fresh-route",
+		Paths:   []string{"/hello.HelloService"},
+		Headers: map[string][]string{"x-hello-track": {"fresh"}},
+		Plugins: []kongtest.Plugin{kongtest.RequestTransformer{AddHeaders: map[string]string{"cache-control": "no-cache"}}},
+	}
+	s, _ := newKongTestServer(t, func(c *serverConfig) { c.ResponseCache.Enabled = true }, helloRoute(), fresh)
+
+	sayHello := func(ctx context.Context) string {
+		t.Helper()
+		var header metadata.MD
+		if _, err := s.client.SayHello(ctx, &pb.HelloRequest{Name: "Fresh"}, grpc.Header(&header)); err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+		return firstValue(header, cacheHeader)
+	}
+	ctx := context.Background()
+	if got := sayHello(ctx); got != "miss" {
+		t.Errorf("first call: %s = %q, want miss", cacheHeader, got)
+	}
+	if got := sayHello(ctx); got != "hit" {
+		t.Errorf("second call: %s = %q, want hit", cacheHeader, got)
+	}
+	if got := sayHello(metadata.AppendToOutgoingContext(ctx, "x-hello-track", "fresh")); got != "bypass" {
+		t.Errorf("fresh route: %s = %q, want bypass from the injected cache-control", cacheHeader, got)
+	}
+}
+
+func TestKongRateLimiting(t *testing.T) {
+	s, kong := newKongTestServer(t, nil, helloRoute(kongtest.RateLimiting{Minute: 2}))
+	now := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC)
+	kong.SetClock(func() time.Time { return now })
+
+	for i, want := range []string{"1", "0"} {
+		var header metadata.MD
+		if _, err := s.client.SayHello(context.Background(), &pb.HelloRequest{Name: "Limit"}, grpc.Header(&header)); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+		if got := firstValue(header, "x-ratelimit-remaining-minute"); got != want {
+			t.Errorf("call %d: x-ratelimit-remaining-minute = %q, want %s", i+1, got, want)
+		}
+	}
+
+	// Kong's 429 becomes RESOURCE_EXHAUSTED like the server's own limit, but
+	// with Retry-After instead of RetryInfo and without an instance ID.
+	var header, trailer metadata.MD
+	_, err := s.client.SayHello(context.Background(), &pb.HelloRequest{Name: "Limit"}, grpc.Header(&header), grpc.Trailer(&trailer))
+	if st := status.Convert(err); st.Code() != codes.ResourceExhausted || st.Message() != "API rate limit exceeded" {
+		t.Fatalf("third call: %v, want ResourceExhausted from Kong", err)
+	}
+	retryAfter := firstValue(header, "retry-after") + firstValue(trailer, "retry-after")
+	if retryAfter != "30" {
+		t.Errorf("retry-after = %q, want 30", retryAfter)
+	}
+	if _, ok := client.RetryDelay(err); ok {
+		t.Error("Kong's rate limit response carries RetryInfo")
+	}
+	if firstValue(header, instanceIDHeader)+firstValue(trailer, instanceIDHeader) != "" {
+		t.Error("rate limited call reached the server")
+	}
+	if handled := s.counter(t, "grpc_server_handled_total", map[string]string{"grpc_method": "SayHello"}); handled != 2 {
+		t.Errorf("server handled %v calls, want 2", handled)
+	}
+
+	// A new window admits calls again.
+	kong.SetClock(func() time.Time { return now.Add(time.Minute) })
+	if _, err := s.client.SayHello(context.Background(), &pb.HelloRequest{Name: "Limit"}); err != nil {
+		t.Errorf("call in the next window: %v", err)
+	}
+}
@@ -0,0 +1,376 @@
+// Package kongtest provides a local stand-in for the Kong gRPC proxy, so the
+// server's handling of Kong-added headers and Kong-generated errors can be
+// tested without Docker. It emulates the subset of Kong 3.5 we rely on:
+// path and header routing of gRPC requests, the proxy headers Kong adds, the
+// correlation-id, request-transformer, key-auth and rate-limiting plugins,
+// and gRPC status mapping of responses Kong produces itself.
+package kongtest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Version is the Kong version reported in the Via header.
+const Version = "3.5.0"
+
+// Route matches gRPC requests by path prefix and, optionally, by headers.
+// As in Kong, routes with header conditions take precedence over routes
+// without, then the longest matching path wins.
+type Route struct {
+	Name    string
+	Paths   []string
+	Headers map[string][]string
+	Plugins []Plugin
+}
+
+func (r Route) match(req *http.Request) (pathLen int, ok bool) {
+	for name, values := range r.Headers {
+		if !containsFold(values, req.Header.Get(name)) {
+			return 0, false
+		}
+	}
+	pathLen = -1
+	for _, p := range r.Paths {
+		if strings.HasPrefix(req.URL.Path, p) && len(p) > pathLen {
+			pathLen = len(p)
+		}
+	}
+	return pathLen, pathLen >= 0
+}
+
+func containsFold(values []string, v string) bool {
+	for _, want := range values {
+		if strings.EqualFold(want, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Plugin runs in the access phase of a matched route, in order.
+type Plugin interface {
+	access(p *Proxy, c *call) *exit
+}
+
+// call is the state of one proxied request shared by its plugins.
+type call struct {
+	req      *http.Request
+	route    *Route
+	consumer *Consumer
+	clientIP string
+	// header is added to the response, whether proxied or produced by Kong.
+	header http.Header
+}
+
+// exit is a response produced by Kong instead of the upstream, like
+// kong.response.exit.
+type exit struct {
+	status  int
+	message string
+}
+
+// Proxy is a running Kong stand-in in front of one gRPC upstream.
+type Proxy struct {
+	// Addr is the host:port to dial with plaintext gRPC.
+	Addr string
+
+	routes []Route
+	server *http.Server
+	proxy  *httputil.ReverseProxy
+
+	mu       sync.Mutex
+	now      func() time.Time
+	counters map[string]*window
+}
+
+// NewProxy starts a proxy for upstream, a plaintext gRPC host:port.
+func NewProxy(upstream string, routes ...Route) (*Proxy, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &Proxy{
+		Addr:     lis.Addr().String(),
+		routes:   routes,
+		now:      time.Now,
+		counters: make(map[string]*window),
+	}
+	target := &url.URL{Scheme: "http", Host: upstream}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			c := pr.In.Context().Value(callKey{}).(*call)
+			pr.Out.Header.Set("X-Real-IP", c.clientIP)
+			pr.Out.Header.Set("X-Forwarded-Path", pr.In.URL.Path)
+			if _, port, err := net.SplitHostPort(p.Addr); err == nil {
+				pr.Out.Header.Set("X-Forwarded-Port", port)
+			}
+		},
+		// Upstream gRPC over plaintext HTTP/2, as with protocol: grpc.
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			c := resp.Request.Context().Value(callKey{}).(*call)
+			for k, v := range c.header {
+				resp.Header[k] = v
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			c := r.Context().Value(callKey{}).(*call)
+			writeExit(w, c.header, &exit{http.StatusBadGateway, "An invalid response was received from the upstream server"})
+		},
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	p.server = &http.Server{Handler: h2c.NewHandler(p, &http2.Server{}), ReadHeaderTimeout: 5 * time.Second}
+	go p.server.Serve(lis)
+	return p, nil
+}
+
+// Close stops the proxy.
+func (p *Proxy) Close() error {
+	return p.server.Close()
+}
+
+// SetClock replaces the clock of rate limiting windows, so tests don't
+// straddle a minute boundary.
+func (p *Proxy) SetClock(now func() time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.now = now
+}
+
+type callKey struct{}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	c := &call{req: r, header: make(http.Header)}
+	c.clientIP, _, _ = net.SplitHostPort(r.RemoteAddr)
+	c.header.Set("Via", "kong/"+Version)
+	c.header.Set("X-Kong-Request-Id", newID())
+
+	c.route = p.match(r)
+	if c.route == nil || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		writeExit(w, c.header, &exit{http.StatusNotFound, "no Route matched with those values"})
+		return
+	}
+	for _, plugin := range c.route.Plugins {
+		if e := plugin.access(p, c); e != nil {
+			writeExit(w, c.header, e)
+			return
+		}
+	}
+	c.header.Set("X-Kong-Proxy-Latency", strconv.FormatInt(time.Since(start).Milliseconds(), 10))
+	p.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callKey{}, c)))
+}
+
+func (p *Proxy) match(r *http.Request) *Route {
+	var best *Route
+	bestHeaders, bestPath := -1, -1
+	for i := range p.routes {
+		route := &p.routes[i]
+		pathLen, ok := route.match(r)
+		if !ok {
+			continue
+		}
+		if n := len(route.Headers); n > bestHeaders || (n == bestHeaders && pathLen > bestPath) {
+			best, bestHeaders, bestPath = route, n, pathLen
+		}
+	}
+	return best
+}
+
+// httpToGRPC is Kong's mapping of kong.response.exit statuses for gRPC
+// requests; other statuses become UNKNOWN.
+var httpToGRPC = map[int]int{
+	200: 0,  // OK
+	400: 3,  // INVALID_ARGUMENT
+	401: 16, // UNAUTHENTICATED
+	403: 7,  // PERMISSION_DENIED
+	404: 5,  // NOT_FOUND
+	409: 6,  // ALREADY_EXISTS
+	429: 8,  // RESOURCE_EXHAUSTED
+	499: 1,  // CANCELLED
+	500: 13, // INTERNAL
+	501: 12, // UNIMPLEMENTED
+	503: 14, // UNAVAILABLE
+	504: 4,  // DEADLINE_EXCEEDED
+}
+
+// writeExit sends e as a trailers-only gRPC response.
+func writeExit(w http.ResponseWriter, header http.Header, e *exit) {
+	code, ok := httpToGRPC[e.status]
+	if !ok {
+		code = 2 // UNKNOWN
+	}
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", e.message)
+	w.WriteHeader(http.StatusOK)
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// CorrelationID is the correlation-id plugin: it adds a unique ID header to
+// the upstream request unless the client sent one.
+type CorrelationID struct {
+	HeaderName     string // defaults to Kong-Request-ID
+	EchoDownstream bool
+}
+
+func (pl CorrelationID) access(_ *Proxy, c *call) *exit {
+	name := pl.HeaderName
+	if name == "" {
+		name = "Kong-Request-ID"
+	}
+	id := c.req.Header.Get(name)
+	if id == "" {
+		id = newID()
+		c.req.Header.Set(name, id)
+	}
+	if pl.EchoDownstream {
+		c.header.Set(name, id)
+	}
+	return nil
+}
+
+// RequestTransformer is the request-transformer plugin's add.headers: the
+// headers are added to the upstream request unless already present.
+type RequestTransformer struct {
+	AddHeaders map[string]string
+}
+
+func (pl RequestTransformer) access(_ *Proxy, c *call) *exit {
+	for k, v := range pl.AddHeaders {
+		if c.req.Header.Get(k) == "" {
+			c.req.Header.Set(k, v)
+		}
+	}
+	return nil
+}
+
+// Consumer is an authenticated Kong consumer.
+type Consumer struct {
+	ID       string
+	Username string
+	CustomID string
+}
+
+// KeyAuth is the key-auth plugin. Consumers maps API keys to consumers;
+// authenticated requests carry X-Consumer-* headers upstream.
+type KeyAuth struct {
+	KeyNames  []string // defaults to apikey
+	Consumers map[string]Consumer
+}
+
+func (pl KeyAuth) access(_ *Proxy, c *call) *exit {
+	names := pl.KeyNames
+	if len(names) == 0 {
+		names = []string{"apikey"}
+	}
+	var key string
+	for _, name := range names {
+		if key = c.req.Header.Get(name); key != "" {
+			break
+		}
+	}
+	if key == "" {
+		c.header.Set("WWW-Authenticate", `Key realm="kong"`)
+		return &exit{http.StatusUnauthorized, "No API key found in request"}
+	}
+	consumer, ok := pl.Consumers[key]
+	if !ok {
+		c.header.Set("WWW-Authenticate", `Key realm="kong"`)
+		return &exit{http.StatusUnauthorized, "Invalid authentication credentials"}
+	}
+	c.consumer = &consumer
+	c.req.Header.Set("X-Consumer-ID", consumer.ID)
+	if consumer.Username != "" {
+		c.req.Header.Set("X-Consumer-Username", consumer.Username)
+	}
+	if consumer.CustomID != "" {
+		c.req.Header.Set("X-Consumer-Custom-ID", consumer.CustomID)
+	}
+	c.req.Header.Set("X-Credential-Identifier", consumer.ID)
+	return nil
+}
+
+// RateLimiting is the rate-limiting plugin with policy local and
+// limit_by consumer, which falls back to the client IP.
+type RateLimiting struct {
+	Minute int
+}
+
+// window is a fixed rate limiting window.
+type window struct {
+	start time.Time
+	count int
+}
+
+func (pl RateLimiting) access(p *Proxy, c *call) *exit {
+	id := "ip:" + c.clientIP
+	if c.consumer != nil {
+		id = "consumer:" + c.consumer.ID
+	}
+	key := fmt.Sprintf("%s/%s", c.route.Name, id)
+
+	p.mu.Lock()
+	now := p.now()
+	start := now.Truncate(time.Minute)
+	w, ok := p.counters[key]
+	if !ok || !w.start.Equal(start) {
+		w = &window{start: start}
+		p.counters[key] = w
+	}
+	w.count++
+	count := w.count
+	p.mu.Unlock()
+
+	remaining := pl.Minute - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	reset := int(math.Ceil(start.Add(time.Minute).Sub(now).Seconds()))
+	c.header.Set("X-RateLimit-Limit-Minute", strconv.Itoa(pl.Minute))
+	c.header.Set("X-RateLimit-Remaining-Minute", strconv.Itoa(remaining))
+	c.header.Set("RateLimit-Limit", strconv.Itoa(pl.Minute))
+	c.header.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	c.header.Set("RateLimit-Reset", strconv.Itoa(reset))
+	if count > pl.Minute {
+		c.header.Set("Retry-After", strconv.Itoa(reset))
+		return &exit{http.StatusTooManyRequests, "API rate limit exceeded"}
+	}
+	return nil
+}
@@ -2,13 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 
 	pb "grpc-server/pb"
 )
@@ -24,35 +33,214 @@ func (s *helloServer) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.H
 	}, nil
 }
 
+// Defaults for SayHelloServerStream when the request leaves count or interval_ms unset.
+const (
+	defaultStreamCount    = 5
+	defaultStreamInterval = 500 * time.Millisecond
+)
+
 func (s *helloServer) SayHelloServerStream(req *pb.HelloRequest, stream pb.HelloService_SayHelloServerStreamServer) error {
 	log.Printf("Received SayHelloServerStream request: name=%s", req.Name)
-	for i := 1; i <= 5; i++ {
+	count := uint32(defaultStreamCount)
+	if req.Count != nil {
+		count = req.GetCount()
+	}
+	interval := defaultStreamInterval
+	if req.IntervalMs != nil {
+		interval = time.Duration(req.GetIntervalMs()) * time.Millisecond
+	}
+
+	// Stop as soon as the client cancels, its deadline passes or the
+	// server's maximum stream duration is reached.
+	ctx := stream.Context()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for i := uint32(1); i <= count; i++ {
+		select {
+		case <-ctx.Done():
+			log.Printf("SayHelloServerStream for %s stopped after %d of %d messages: %v", req.Name, i-1, count, ctx.Err())
+			return status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+		}
 		msg := &pb.HelloResponse{
-			Message: fmt.Sprintf("Hello %s! Message %d of 5", req.Name, i),
+			Message: fmt.Sprintf("Hello %s! Message %d of %d", req.Name, i, count),
 		}
 		if err := stream.Send(msg); err != nil {
 			return err
 		}
-		time.Sleep(500 * time.Millisecond)
+		timer.Reset(interval)
 	}
 	return nil
 }
 
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// envReader parses typed environment variables, collecting the values it
+// cannot parse so startup fails on them like on invalid flags.
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) duration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		d, err := time.ParseDuration(value)
+		if err == nil {
+			return d
+		}
+		e.errs = append(e.errs, fmt.Errorf("invalid duration %s=%q", key, value))
+	}
+	return defaultValue
+}
+
+func (e *envReader) int(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		n, err := strconv.Atoi(value)
+		if err == nil {
+			return n
+		}
+		e.errs = append(e.errs, fmt.Errorf("invalid int %s=%q", key, value))
+	}
+	return defaultValue
+}
+
+func (e *envReader) float(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			return f
+		}
+		e.errs = append(e.errs, fmt.Errorf("invalid number %s=%q", key, value))
+	}
+	return defaultValue
+}
+
+func (e *envReader) bool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err == nil {
+			return b
+		}
+		e.errs = append(e.errs, fmt.Errorf("invalid bool %s=%q", key, value))
+	}
+	return defaultValue
+}
+
+// err returns the parse errors, if any.
+func (e *envReader) err() error {
+	return errors.Join(e.errs...)
+}
+
 func main() {
-	port := ":50051"
-	lis, err := net.Listen("tcp", port)
+	cfg, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	log.Printf("Effective configuration:\n%s", cfg.dump())
+
+	shutdownTracing, err := setupTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", cfg.ListenAddr)
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	server := grpc.NewServer()
-	pb.RegisterHelloServiceServer(server, &helloServer{})
+	reg := newMetricsRegistry()
+	var rpcs *activeRPCs
+	if cfg.DebugAddr != "" {
+		rpcs = newActiveRPCs()
+	}
+	opts := newServerOptions(cfg, reg, rpcs)
+	hello := &helloServer{}
+	store := newEchoStoreServer()
+
+	var creds []grpc.ServerOption
+	if cfg.TLS.enabled() {
+		reloader, err := newCertReloader(cfg.TLS)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificates: %v", err)
+		}
+		go reloader.watch(nil)
+		creds = append(creds, grpc.Creds(credentials.NewTLS(reloader.tlsConfig())))
+		if cfg.TLS.ClientCAFile != "" {
+			log.Printf("mTLS enabled: client certificates verified against %s", cfg.TLS.ClientCAFile)
+		} else {
+			log.Printf("TLS enabled with certificate %s", cfg.TLS.CertFile)
+		}
+	}
+
+	server := newServer(cfg, hello, store, append(opts, creds...)...)
 
-	// Enable reflection for grpcurl
-	reflection.Register(server)
+	var metricsServer *http.Server
+	if cfg.MetricsAddr != "" {
+		metricsServer = serveMetrics(cfg.MetricsAddr, reg)
+	}
+
+	var debugServer *http.Server
+	if cfg.DebugAddr != "" {
+		var stopAdmin func()
+		debugServer, stopAdmin, err = serveDebug(cfg.DebugAddr, rpcs)
+		if err != nil {
+			log.Fatalf("Failed to register admin services: %v", err)
+		}
+		defer stopAdmin()
+	}
+
+	// The HTTP gateways use a plaintext in-process server backed by the same services.
+	var internal *grpc.Server
+	var httpServer *http.Server
+	if cfg.HTTPAddr != "" {
+		internal = grpc.NewServer(opts...)
+		registerServices(internal, hello, store)
+		conn, err := inProcessConn(internal)
+		if err != nil {
+			log.Fatalf("Failed to connect REST gateway: %v", err)
+		}
+		defer conn.Close()
+		gateway, err := newRESTGateway(context.Background(), conn)
+		if err != nil {
+			log.Fatalf("Failed to register REST gateway: %v", err)
+		}
+		grpcWeb := newGRPCWebHandler(internal, strings.Split(cfg.CORSAllowedOrigins, ","))
+		httpServer = serveHTTP(cfg.HTTPAddr, withGRPCWeb(grpcWeb, gateway))
+	}
+
+	go func() {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		<-sigChan
+		log.Println("Shutting down gRPC server...")
+		server.GracefulStop()
+	}()
 
-	log.Printf("gRPC server starting on %s", port)
+	log.Printf("gRPC server starting on %s", cfg.ListenAddr)
 	if err := server.Serve(lis); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if httpServer != nil {
+		httpServer.Shutdown(ctx)
+		internal.GracefulStop()
+	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(ctx)
+	}
+	if debugServer != nil {
+		debugServer.Shutdown(ctx)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
 }
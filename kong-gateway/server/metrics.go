@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// rpcMetrics holds the per-method Prometheus collectors for the gRPC server.
+type rpcMetrics struct {
+	started     *prometheus.CounterVec
+	handled     *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	inFlight    *prometheus.GaugeVec
+	msgSent     *prometheus.CounterVec
+	msgReceived *prometheus.CounterVec
+}
+
+func newRPCMetrics(reg prometheus.Registerer) *rpcMetrics {
+	labels := []string{"grpc_service", "grpc_method", "grpc_type"}
+	m := &rpcMetrics{
+		started: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_started_total",
+			Help: "Total number of RPCs started on the server.",
+		}, labels),
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+		}, append(labels, "grpc_code")),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Latency of RPCs (unary) and total duration of streams handled by the server.",
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, labels),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_server_in_flight",
+			Help: "Number of RPCs currently being handled.",
+		}, labels),
+		msgSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_msg_sent_total",
+			Help: "Total number of messages sent by the server, including streamed messages.",
+		}, labels),
+		msgReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_msg_received_total",
+			Help: "Total number of messages received by the server.",
+		}, labels),
+	}
+	reg.MustRegister(m.started, m.handled, m.duration, m.inFlight, m.msgSent, m.msgReceived)
+	return m
+}
+
+// splitMethodName splits "/hello.HelloService/SayHello" into service and method.
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
+
+func streamType(info *grpc.StreamServerInfo) string {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return "bidi_stream"
+	case info.IsClientStream:
+		return "client_stream"
+	default:
+		return "server_stream"
+	}
+}
+
+// begin records the start of an RPC and returns a function that records its completion.
+func (m *rpcMetrics) begin(fullMethod, rpcType string) func(err error) {
+	service, method := splitMethodName(fullMethod)
+	labels := prometheus.Labels{"grpc_service": service, "grpc_method": method, "grpc_type": rpcType}
+	m.started.With(labels).Inc()
+	m.inFlight.With(labels).Inc()
+	start := time.Now()
+
+	return func(err error) {
+		m.inFlight.With(labels).Dec()
+		m.duration.With(labels).Observe(time.Since(start).Seconds())
+		m.handled.WithLabelValues(service, method, rpcType, status.Code(err).String()).Inc()
+	}
+}
+
+func (m *rpcMetrics) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	service, method := splitMethodName(info.FullMethod)
+	m.msgReceived.WithLabelValues(service, method, "unary").Inc()
+
+	done := m.begin(info.FullMethod, "unary")
+	resp, err := handler(ctx, req)
+	done(err)
+	if err == nil {
+		m.msgSent.WithLabelValues(service, method, "unary").Inc()
+	}
+	return resp, err
+}
+
+func (m *rpcMetrics) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	rpcType := streamType(info)
+	service, method := splitMethodName(info.FullMethod)
+
+	done := m.begin(info.FullMethod, rpcType)
+	err := handler(srv, &monitoredStream{
+		ServerStream: ss,
+		sent:         m.msgSent.WithLabelValues(service, method, rpcType),
+		received:     m.msgReceived.WithLabelValues(service, method, rpcType),
+	})
+	done(err)
+	return err
+}
+
+// monitoredStream counts the messages flowing through a server stream.
+type monitoredStream struct {
+	grpc.ServerStream
+	sent     prometheus.Counter
+	received prometheus.Counter
+}
+
+func (s *monitoredStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
+
+func (s *monitoredStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Inc()
+	}
+	return err
+}
+
+// newMetricsRegistry returns a registry with the Go runtime and process collectors.
+func newMetricsRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// serveMetrics exposes the registry on addr at /metrics.
+func serveMetrics(addr string, reg *prometheus.Registry) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		log.Printf("Metrics server starting on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics server failed: %v", err)
+		}
+	}()
+	return srv
+}
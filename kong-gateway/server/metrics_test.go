@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "grpc-server/pb"
+)
+
+// recordSpans installs a global tracer provider that records spans in memory,
+// for servers started afterwards.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		tp.Shutdown(context.Background())
+	})
+	return spans
+}
+
+// waitForSpan waits for the server span of method, which ends just after the
+// client sees the response.
+func waitForSpan(t *testing.T, spans *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for _, span := range spans.Ended() {
+			if span.Name() == name {
+				return span
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no span %s recorded", name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func grpcStatusCode(span sdktrace.ReadOnlySpan) (int64, bool) {
+	for _, attr := range span.Attributes() {
+		if attr.Key == "rpc.grpc.status_code" {
+			return attr.Value.AsInt64(), true
+		}
+	}
+	return 0, false
+}
+
+func TestMetricsAndTracing(t *testing.T) {
+	stream := func(req *pb.HelloRequest) func(*testServer) error {
+		return func(s *testServer) error {
+			stream, err := s.client.SayHelloServerStream(context.Background(), req)
+			if err != nil {
+				return err
+			}
+			_, err = recvAll(stream)
+			return err
+		}
+	}
+	tests := []struct {
+		name       string
+		configure  func(*serverConfig)
+		call       func(*testServer) error
+		method     string
+		code       codes.Code
+		spanStatus otelcodes.Code
+	}{
+		{
+			name: "unary",
+			call: func(s *testServer) error {
+				_, err := s.client.SayHello(context.Background(), &pb.HelloRequest{Name: "metrics"})
+				return err
+			},
+			method:     "SayHello",
+			code:       codes.OK,
+			spanStatus: otelcodes.Unset,
+		},
+		{
+			// Client errors are no server errors for the span status.
+			name: "unary invalid",
+			call: func(s *testServer) error {
+				_, err := s.client.SayHello(context.Background(), &pb.HelloRequest{})
+				return err
+			},
+			method:     "SayHello",
+			code:       codes.InvalidArgument,
+			spanStatus: otelcodes.Unset,
+		},
+		{
+			name:       "server stream",
+			call:       stream(&pb.HelloRequest{Name: "metrics", Count: proto.Uint32(2), IntervalMs: proto.Uint32(0)}),
+			method:     "SayHelloServerStream",
+			code:       codes.OK,
+			spanStatus: otelcodes.Unset,
+		},
+		{
+			name:       "server stream timeout",
+			configure:  func(c *serverConfig) { c.MaxStreamDuration = 50 * time.Millisecond },
+			call:       stream(&pb.HelloRequest{Name: "metrics", Count: proto.Uint32(100), IntervalMs: proto.Uint32(20)}),
+			method:     "SayHelloServerStream",
+			code:       codes.DeadlineExceeded,
+			spanStatus: otelcodes.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans := recordSpans(t)
+			s := newTestServer(t, tt.configure)
+			if got := status.Code(tt.call(s)); got != tt.code {
+				t.Fatalf("code = %v, want %v", got, tt.code)
+			}
+
+			handled := s.counter(t, "grpc_server_handled_total", map[string]string{"grpc_method": tt.method, "grpc_code": tt.code.String()})
+			if handled != 1 {
+				t.Errorf("grpc_server_handled_total{grpc_code=%s} = %v, want 1", tt.code, handled)
+			}
+			seconds := s.metric(t, "grpc_server_handling_seconds", map[string]string{"grpc_method": tt.method})
+			if got := seconds.GetHistogram().GetSampleCount(); got != 1 {
+				t.Errorf("grpc_server_handling_seconds sample count = %v, want 1", got)
+			}
+
+			span := waitForSpan(t, spans, "hello.HelloService/"+tt.method)
+			if code, ok := grpcStatusCode(span); !ok || codes.Code(code) != tt.code {
+				t.Errorf("span rpc.grpc.status_code = %v (set %v), want %v", codes.Code(code), ok, tt.code)
+			}
+			if got := span.Status().Code; got != tt.spanStatus {
+				t.Errorf("span status = %v, want %v", got, tt.spanStatus)
+			}
+		})
+	}
+}
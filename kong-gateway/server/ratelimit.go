@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	// loadShedRetryDelay is the RetryInfo hint when the in-flight cap is hit.
+	loadShedRetryDelay = time.Second
+	// callerIdleTimeout is how long an unused caller bucket is kept.
+	callerIdleTimeout = 10 * time.Minute
+)
+
+// rateLimit is a token bucket: Rate tokens per second, up to Burst at once.
+type rateLimit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// newLimiter returns nil when the limit is disabled. Burst defaults to one
+// second worth of tokens.
+func (l rateLimit) newLimiter() *rate.Limiter {
+	if l.Rate <= 0 {
+		return nil
+	}
+	burst := l.Burst
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(l.Rate)))
+	}
+	return rate.NewLimiter(rate.Limit(l.Rate), burst)
+}
+
+// rateLimitConfig is a last line of defense in case Kong's rate-limiting
+// plugin is missing or misconfigured.
+type rateLimitConfig struct {
+	// MaxInFlight caps concurrent RPCs across all methods (0 = unlimited).
+	MaxInFlight int `yaml:"max_in_flight"`
+	// Method applies to every method without an entry in Methods.
+	Method rateLimit `yaml:"method"`
+	// Methods overrides Method by full method name, e.g. "/hello.HelloService/SayHello".
+	Methods map[string]rateLimit `yaml:"methods"`
+	// Caller limits each caller separately.
+	Caller rateLimit `yaml:"caller"`
+	// CallerHeaders are the metadata keys identifying a caller, in order.
+	// Behind Kong the peer is always Kong, so the peer address is only a fallback.
+	CallerHeaders string `yaml:"caller_headers"`
+	// TrustedProxies are the addresses or CIDRs of proxies such as Kong whose
+	// CallerHeaders are believed. Other peers could set them to anything, so
+	// they are keyed by their own address.
+	TrustedProxies string `yaml:"trusted_proxies"`
+}
+
+func (c rateLimitConfig) validate() error {
+	if c.MaxInFlight < 0 {
+		return fmt.Errorf("max_in_flight must not be negative, got %d", c.MaxInFlight)
+	}
+	limits := map[string]rateLimit{"method": c.Method, "caller": c.Caller}
+	for name, l := range c.Methods {
+		if !strings.HasPrefix(name, "/") || strings.Count(name, "/") != 2 {
+			return fmt.Errorf("methods: %q is not a full method name like /hello.HelloService/SayHello", name)
+		}
+		limits[name] = l
+	}
+	for name, l := range limits {
+		if l.Rate < 0 || l.Burst < 0 {
+			return fmt.Errorf("%s: rate and burst must not be negative", name)
+		}
+	}
+	if _, err := parsePrefixes(c.TrustedProxies); err != nil {
+		return fmt.Errorf("trusted_proxies: %w", err)
+	}
+	return nil
+}
+
+// parsePrefixes parses a comma-separated list of CIDRs and addresses; an
+// address is a prefix of its full length.
+func parsePrefixes(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if strings.Contains(v, "/") {
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+type callerBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter enforces the in-flight cap and the per-method and per-caller
+// token buckets. It is also a Prometheus collector exposing its state.
+type rateLimiter struct {
+	cfg            rateLimitConfig
+	callerHeaders  []string
+	trustedProxies []netip.Prefix
+	inFlight       atomic.Int64
+
+	mu        sync.Mutex
+	methods   map[string]*rate.Limiter
+	callers   map[string]*callerBucket
+	lastSweep time.Time
+
+	rejected        *prometheus.CounterVec
+	inFlightDesc    *prometheus.Desc
+	maxInFlightDesc *prometheus.Desc
+	tokensDesc      *prometheus.Desc
+	callersDesc     *prometheus.Desc
+}
+
+func newRateLimiter(cfg rateLimitConfig, reg prometheus.Registerer) *rateLimiter {
+	l := &rateLimiter{
+		cfg:       cfg,
+		methods:   make(map[string]*rate.Limiter),
+		callers:   make(map[string]*callerBucket),
+		lastSweep: time.Now(),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_rate_limited_total",
+			Help: "Total number of RPCs rejected with ResourceExhausted, by limit.",
+		}, []string{"grpc_service", "grpc_method", "limit"}),
+		inFlightDesc: prometheus.NewDesc("grpc_server_rate_limit_in_flight",
+			"Number of RPCs counted against the in-flight cap.", nil, nil),
+		maxInFlightDesc: prometheus.NewDesc("grpc_server_rate_limit_max_in_flight",
+			"Configured in-flight cap (0 = unlimited).", nil, nil),
+		tokensDesc: prometheus.NewDesc("grpc_server_rate_limit_tokens",
+			"Tokens currently available in the per-method bucket.", []string{"grpc_service", "grpc_method"}, nil),
+		callersDesc: prometheus.NewDesc("grpc_server_rate_limit_callers",
+			"Number of callers with an active token bucket.", nil, nil),
+	}
+	for _, h := range strings.Split(cfg.CallerHeaders, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			l.callerHeaders = append(l.callerHeaders, h)
+		}
+	}
+	// validate has already rejected invalid prefixes.
+	l.trustedProxies, _ = parsePrefixes(cfg.TrustedProxies)
+	reg.MustRegister(l)
+	return l
+}
+
+func (l *rateLimiter) Describe(ch chan<- *prometheus.Desc) {
+	l.rejected.Describe(ch)
+	ch <- l.inFlightDesc
+	ch <- l.maxInFlightDesc
+	ch <- l.tokensDesc
+	ch <- l.callersDesc
+}
+
+func (l *rateLimiter) Collect(ch chan<- prometheus.Metric) {
+	l.rejected.Collect(ch)
+	ch <- prometheus.MustNewConstMetric(l.inFlightDesc, prometheus.GaugeValue, float64(l.inFlight.Load()))
+	ch <- prometheus.MustNewConstMetric(l.maxInFlightDesc, prometheus.GaugeValue, float64(l.cfg.MaxInFlight))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for fullMethod, lim := range l.methods {
+		if lim == nil {
+			continue
+		}
+		service, method := splitMethodName(fullMethod)
+		ch <- prometheus.MustNewConstMetric(l.tokensDesc, prometheus.GaugeValue, lim.Tokens(), service, method)
+	}
+	ch <- prometheus.MustNewConstMetric(l.callersDesc, prometheus.GaugeValue, float64(len(l.callers)))
+}
+
+// limiters returns the buckets for the method and the caller; either may be nil.
+func (l *rateLimiter) limiters(fullMethod, caller string) (*rate.Limiter, *rate.Limiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	methodLim, ok := l.methods[fullMethod]
+	if !ok {
+		limit, ok := l.cfg.Methods[fullMethod]
+		if !ok {
+			limit = l.cfg.Method
+		}
+		methodLim = limit.newLimiter()
+		l.methods[fullMethod] = methodLim
+	}
+
+	if l.cfg.Caller.Rate <= 0 {
+		return methodLim, nil
+	}
+	now := time.Now()
+	if now.Sub(l.lastSweep) > callerIdleTimeout {
+		for key, b := range l.callers {
+			if now.Sub(b.lastSeen) > callerIdleTimeout {
+				delete(l.callers, key)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.callers[caller]
+	if !ok {
+		b = &callerBucket{limiter: l.cfg.Caller.newLimiter()}
+		l.callers[caller] = b
+	}
+	b.lastSeen = now
+	return methodLim, b.limiter
+}
+
+// callerKey identifies the caller. Calls from a trusted proxy are keyed by
+// the first configured metadata key that is set; all others, and proxied
+// calls without any of the keys, by the verified client certificate or else
+// the peer IP.
+func (l *rateLimiter) callerKey(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	host := p.Addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if p.Addr.Network() == "bufconn" {
+		// The REST gateway calls in process (inProcessConn) and appends the
+		// address of its HTTP client to x-forwarded-for, so that is the peer.
+		if hop, rest := splitLastHop(md.Get("x-forwarded-for")); hop != "" {
+			host = hop
+			md = md.Copy()
+			md.Delete("x-forwarded-for")
+			md.Append("x-forwarded-for", rest...)
+		}
+	}
+	if l.trusted(host) {
+		for _, h := range l.callerHeaders {
+			if value, _ := splitLastHop(md.Get(h)); value != "" {
+				return h + "=" + value
+			}
+		}
+	}
+	if id, ok := clientIdentityFromContext(ctx); ok {
+		return "cert=" + id.name()
+	}
+	return "peer=" + host
+}
+
+// trusted reports whether the peer at host is a trusted proxy.
+func (l *rateLimiter) trusted(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range l.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitLastHop splits the last comma-separated entry off metadata values,
+// returning it and the values before it. For x-forwarded-for that entry is
+// the address the trusted proxy appended; entries before it come from the
+// client and may be forged.
+func splitLastHop(values []string) (string, []string) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	rest := append([]string(nil), values[:len(values)-1]...)
+	last := values[len(values)-1]
+	i := strings.LastIndexByte(last, ',')
+	if i >= 0 {
+		rest = append(rest, strings.TrimSpace(last[:i]))
+	}
+	return strings.TrimSpace(last[i+1:]), rest
+}
+
+// admit checks every limit for an RPC. On success the returned function must
+// be called when the RPC finishes.
+func (l *rateLimiter) admit(ctx context.Context, fullMethod string) (func(), error) {
+	n := l.inFlight.Add(1)
+	release := func() { l.inFlight.Add(-1) }
+	if max := l.cfg.MaxInFlight; max > 0 && n > int64(max) {
+		release()
+		return nil, l.reject(ctx, fullMethod, "in_flight", loadShedRetryDelay,
+			fmt.Sprintf("server overloaded: %d RPCs in flight", max))
+	}
+
+	methodLim, callerLim := l.limiters(fullMethod, l.callerKey(ctx))
+	// Reservations are made and cancelled at the same instant so a token
+	// taken from the method bucket is returned if the caller bucket rejects.
+	now := time.Now()
+	var methodRes *rate.Reservation
+	if methodLim != nil {
+		methodRes = methodLim.ReserveN(now, 1)
+		if delay := methodRes.DelayFrom(now); delay > 0 {
+			methodRes.CancelAt(now)
+			release()
+			return nil, l.reject(ctx, fullMethod, "method", delay,
+				fmt.Sprintf("rate limit exceeded for %s", fullMethod))
+		}
+	}
+	if callerLim != nil {
+		res := callerLim.ReserveN(now, 1)
+		if delay := res.DelayFrom(now); delay > 0 {
+			res.CancelAt(now)
+			if methodRes != nil {
+				methodRes.CancelAt(now)
+			}
+			release()
+			return nil, l.reject(ctx, fullMethod, "caller", delay, "rate limit exceeded for caller")
+		}
+	}
+	return release, nil
+}
+
+// reject returns ResourceExhausted with a RetryInfo detail. The same delay
+// goes into the grpc-retry-pushback-ms trailer, which gRPC clients with a
+// retry policy honor instead of their own backoff.
+func (l *rateLimiter) reject(ctx context.Context, fullMethod, limit string, delay time.Duration, msg string) error {
+	service, method := splitMethodName(fullMethod)
+	l.rejected.WithLabelValues(service, method, limit).Inc()
+	grpc.SetTrailer(ctx, metadata.Pairs("grpc-retry-pushback-ms", strconv.FormatInt(delay.Milliseconds()+1, 10)))
+
+	st, err := status.New(codes.ResourceExhausted, msg).WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(delay),
+	})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, msg)
+	}
+	return st.Err()
+}
+
+func (l *rateLimiter) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	release, err := l.admit(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return handler(ctx, req)
+}
+
+// streamInterceptor counts a stream against the in-flight cap for its whole
+// lifetime, but takes a single token when it starts.
+func (l *rateLimiter) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	release, err := l.admit(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return handler(srv, ss)
+}
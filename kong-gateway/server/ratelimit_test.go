@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	kongAddr   = "172.18.0.5:41234"
+	clientAddr = "203.0.113.7:55000"
+	// inProcess is the peer address of calls from the REST gateway.
+	inProcess = "bufconn"
+)
+
+// incoming returns a server context for a call from addr with the metadata
+// key/value pairs.
+func incoming(addr string, kv ...string) context.Context {
+	var from net.Addr = bufconn.Listen(1).Addr()
+	if addr != inProcess {
+		tcp, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			panic(err)
+		}
+		from = tcp
+	}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: from})
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(kv...))
+}
+
+// kongLimiterConfig trusts Kong at kongAddr in addition to the defaults.
+func kongLimiterConfig() rateLimitConfig {
+	cfg := defaultConfig().RateLimit
+	cfg.TrustedProxies += ",172.18.0.5"
+	return cfg
+}
+
+func TestCallerKey(t *testing.T) {
+	l := newRateLimiter(kongLimiterConfig(), prometheus.NewRegistry())
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"proxied consumer", incoming(kongAddr, "x-consumer-id", "consumer-alice", "x-forwarded-for", "203.0.113.7"), "x-consumer-id=consumer-alice"},
+		{"proxied address", incoming(kongAddr, "x-forwarded-for", "203.0.113.7"), "x-forwarded-for=203.0.113.7"},
+		{"proxied chain", incoming(kongAddr, "x-forwarded-for", "198.51.100.1, 203.0.113.7"), "x-forwarded-for=203.0.113.7"},
+		{"repeated header", incoming(kongAddr, "x-forwarded-for", "198.51.100.1", "x-forwarded-for", "203.0.113.7"), "x-forwarded-for=203.0.113.7"},
+		{"proxied without headers", incoming(kongAddr), "peer=172.18.0.5"},
+		{"loopback proxy", incoming("[::1]:41234", "x-forwarded-for", "203.0.113.7"), "x-forwarded-for=203.0.113.7"},
+		{"direct consumer", incoming(clientAddr, "x-consumer-id", "consumer-alice"), "peer=203.0.113.7"},
+		{"direct forwarded", incoming(clientAddr, "x-forwarded-for", "198.51.100.1"), "peer=203.0.113.7"},
+		{"REST client", incoming(inProcess, "x-forwarded-for", "203.0.113.7"), "peer=203.0.113.7"},
+		{"REST client with headers", incoming(inProcess, "x-consumer-id", "consumer-bob", "x-forwarded-for", "198.51.100.1, 203.0.113.7"), "peer=203.0.113.7"},
+		{"REST via Kong", incoming(inProcess, "x-consumer-id", "consumer-alice", "x-forwarded-for", "203.0.113.7, 172.18.0.5"), "x-consumer-id=consumer-alice"},
+		{"REST address via Kong", incoming(inProcess, "x-forwarded-for", "198.51.100.1, 203.0.113.7, 172.18.0.5"), "x-forwarded-for=203.0.113.7"},
+		{"REST via Kong without headers", incoming(inProcess, "x-forwarded-for", "172.18.0.5"), "peer=172.18.0.5"},
+		{"REST without address", incoming(inProcess), "peer=bufconn"},
+		{"no peer", context.Background(), "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := l.callerKey(tt.ctx); got != tt.want {
+				t.Errorf("callerKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCallerSpoofing checks that headers a client makes up do not give it a
+// fresh bucket.
+func TestCallerSpoofing(t *testing.T) {
+	tests := []struct {
+		name          string
+		first, second context.Context
+	}{
+		{
+			"spoofed leftmost x-forwarded-for",
+			incoming(kongAddr, "x-forwarded-for", "203.0.113.7"),
+			incoming(kongAddr, "x-forwarded-for", "198.51.100.1, 203.0.113.7"),
+		},
+		{
+			"spoofed x-consumer-id without proxy",
+			incoming(clientAddr),
+			incoming(clientAddr, "x-consumer-id", "consumer-bob"),
+		},
+		{
+			"spoofed x-forwarded-for without proxy",
+			incoming(clientAddr, "x-forwarded-for", "198.51.100.1"),
+			incoming(clientAddr, "x-forwarded-for", "198.51.100.2"),
+		},
+		{
+			"spoofed x-forwarded-for over REST",
+			incoming(inProcess, "x-forwarded-for", "203.0.113.7"),
+			incoming(inProcess, "x-forwarded-for", "198.51.100.1, 203.0.113.7"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := kongLimiterConfig()
+			cfg.Caller = rateLimit{Rate: 0.01, Burst: 1}
+			l := newRateLimiter(cfg, prometheus.NewRegistry())
+
+			release, err := l.admit(tt.first, "/hello.HelloService/SayHello")
+			if err != nil {
+				t.Fatalf("first call: %v", err)
+			}
+			release()
+			if _, err := l.admit(tt.second, "/hello.HelloService/SayHello"); status.Code(err) != codes.ResourceExhausted {
+				t.Errorf("spoofed call: %v, want ResourceExhausted from the shared bucket", err)
+			}
+		})
+	}
+}
+
+func TestTrustedProxiesConfig(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"", true},
+		{"10.0.0.0/8, 192.0.2.1, ::1", true},
+		{"10.0.0.0/33", false},
+		{"kong", false},
+	}
+	for _, tt := range tests {
+		cfg := defaultConfig().RateLimit
+		cfg.TrustedProxies = tt.value
+		if err := cfg.validate(); (err == nil) != tt.ok {
+			t.Errorf("validate(%q) = %v, want ok %v", tt.value, err, tt.ok)
+		}
+	}
+}
+
+// TestDefaultTrustedProxies checks that only loopback peers are trusted
+// unless Kong's address is configured.
+func TestDefaultTrustedProxies(t *testing.T) {
+	l := newRateLimiter(defaultConfig().RateLimit, prometheus.NewRegistry())
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"loopback", incoming("127.0.0.1:41234", "x-consumer-id", "consumer-alice"), "x-consumer-id=consumer-alice"},
+		{"private network", incoming(kongAddr, "x-consumer-id", "consumer-alice"), "peer=172.18.0.5"},
+		{"REST via private network", incoming(inProcess, "x-consumer-id", "consumer-alice", "x-forwarded-for", "172.18.0.5"), "peer=172.18.0.5"},
+	}
+	for _, tt := range tests {
+		if got := l.callerKey(tt.ctx); got != tt.want {
+			t.Errorf("%s: callerKey = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitLastHop(t *testing.T) {
+	tests := []struct {
+		values   []string
+		hop      string
+		wantRest []string
+	}{
+		{nil, "", nil},
+		{[]string{"203.0.113.7"}, "203.0.113.7", nil},
+		{[]string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7", []string{"198.51.100.1"}},
+		{[]string{"a", "b,c , d"}, "d", []string{"a", "b,c"}},
+	}
+	for _, tt := range tests {
+		hop, rest := splitLastHop(tt.values)
+		if hop != tt.hop || !reflect.DeepEqual(rest, tt.wantRest) {
+			t.Errorf("splitLastHop(%q) = %q, %q; want %q, %q", tt.values, hop, rest, tt.hop, tt.wantRest)
+		}
+	}
+}
+
+func TestCallerKeyIdentity(t *testing.T) {
+	l := newRateLimiter(kongLimiterConfig(), prometheus.NewRegistry())
+	withID := func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, clientIdentityKey{}, &clientIdentity{CommonName: "alice"})
+	}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"direct client", withID(incoming(clientAddr)), "cert=alice"},
+		{"direct client with headers", withID(incoming(clientAddr, "x-consumer-id", "consumer-bob")), "cert=alice"},
+		{"proxy with headers", withID(incoming(kongAddr, "x-consumer-id", "consumer-bob")), "x-consumer-id=consumer-bob"},
+		{"proxy without headers", withID(incoming(kongAddr)), "cert=alice"},
+	}
+	for _, tt := range tests {
+		if got := l.callerKey(tt.ctx); got != tt.want {
+			t.Errorf("%s: callerKey = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
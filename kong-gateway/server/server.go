@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+
+	pb "grpc-server/pb"
+	"grpc-server/pb/echostorepb"
+)
+
+// newServerOptions builds the interceptor chain and transport options shared
+// by the public server and the in-process server behind the HTTP gateways.
+// Metrics and limiter state are registered with reg. If rpcs is not nil,
+// RPCs in progress are tracked for the debug server.
+func newServerOptions(cfg serverConfig, reg prometheus.Registerer, rpcs *activeRPCs) []grpc.ServerOption {
+	metrics := newRPCMetrics(reg)
+	limiter := newRateLimiter(cfg.RateLimit, reg)
+
+	// Rejected RPCs still show up in grpc_server_handled_total as ResourceExhausted.
+	// The identity goes first so the limiter can key mTLS clients on it.
+	id := instanceID(cfg.InstanceID)
+	unary := []grpc.UnaryServerInterceptor{id.unaryInterceptor, metrics.unaryInterceptor, identityUnaryInterceptor, limiter.unaryInterceptor, validationUnaryInterceptor}
+	stream := []grpc.StreamServerInterceptor{id.streamInterceptor, metrics.streamInterceptor, identityStreamInterceptor, limiter.streamInterceptor, validationStreamInterceptor}
+	if rpcs != nil {
+		// After the limiter, so shed RPCs don't crowd the list.
+		unary = append(unary, rpcs.unaryInterceptor)
+		stream = append(stream, rpcs.streamInterceptor)
+	}
+	// The compressor wraps the cache so cached responses are compressed too.
+	if names, _ := parseCompression(cfg.Compression); len(names) > 0 {
+		c := compressor{names: names, minSize: cfg.CompressionMinSize}
+		unary = append(unary, c.unaryInterceptor)
+		stream = append(stream, c.streamInterceptor)
+	}
+	if cfg.ResponseCache.Enabled {
+		unary = append(unary, newResponseCache(cfg.ResponseCache, reg).unaryInterceptor)
+	}
+	if cfg.MaxStreamDuration > 0 {
+		stream = append(stream, maxStreamDuration(cfg.MaxStreamDuration))
+	}
+
+	return append(cfg.serverOptions(),
+		// Extracts W3C trace context from incoming metadata and records a span per RPC.
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+}
+
+// registerServices registers every service this binary serves.
+func registerServices(server *grpc.Server, hello pb.HelloServiceServer, store echostorepb.EchoStoreServiceServer) {
+	pb.RegisterHelloServiceServer(server, hello)
+	echostorepb.RegisterEchoStoreServiceServer(server, store)
+}
+
+// newServer returns the public gRPC server for hello and store, with the
+// reflection service for grpcurl unless disabled.
+func newServer(cfg serverConfig, hello pb.HelloServiceServer, store echostorepb.EchoStoreServiceServer, opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(opts...)
+	registerServices(server, hello, store)
+	if cfg.Reflection {
+		reflection.Register(server)
+	}
+	return server
+}
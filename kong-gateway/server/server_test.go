@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	pb "grpc-server/pb"
+)
+
+// testServer is helloServer behind the full interceptor chain, served over bufconn.
+type testServer struct {
+	conn   *grpc.ClientConn
+	client pb.HelloServiceClient
+	reg    *prometheus.Registry
+	rpcs   *activeRPCs
+}
+
+// newTestServer starts a server with defaultConfig, adjusted by configure.
+func newTestServer(t *testing.T, configure func(*serverConfig)) *testServer {
+	t.Helper()
+	cfg := defaultConfig()
+	if configure != nil {
+		configure(&cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("invalid test config: %v", err)
+	}
+
+	reg := prometheus.NewRegistry()
+	rpcs := newActiveRPCs()
+	server := newServer(cfg, &helloServer{}, newEchoStoreServer(), newServerOptions(cfg, reg, rpcs)...)
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testServer{conn: conn, client: pb.NewHelloServiceClient(conn), reg: reg, rpcs: rpcs}
+}
+
+// metric returns the series of name with the given labels, or nil.
+func (s *testServer) metric(t *testing.T, name string, labels map[string]string) *dto.Metric {
+	t.Helper()
+	families, err := s.reg.Gather()
+	if err != nil {
+		t.Fatalf("gather metrics: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if want, ok := labels[lp.GetName()]; ok && want != lp.GetValue() {
+					continue metrics
+				}
+			}
+			return m
+		}
+	}
+	return nil
+}
+
+// counter returns the value of a counter with exactly the given labels, or 0.
+func (s *testServer) counter(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	return s.metric(t, name, labels).GetCounter().GetValue()
+}
+
+// recvAll reads a stream until it ends and returns the messages and the final error.
+func recvAll(stream pb.HelloService_SayHelloServerStreamClient) ([]string, error) {
+	var messages []string
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return messages, nil
+		}
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, resp.GetMessage())
+	}
+}
+
+func TestSayHello(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	resp, err := s.client.SayHello(context.Background(), &pb.HelloRequest{Name: "Test"})
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if want := "Hello, Test! (from gRPC server via Kong)"; resp.GetMessage() != want {
+		t.Errorf("message = %q, want %q", resp.GetMessage(), want)
+	}
+
+	ok := s.counter(t, "grpc_server_handled_total", map[string]string{"grpc_method": "SayHello", "grpc_code": "OK"})
+	if ok != 1 {
+		t.Errorf("grpc_server_handled_total{grpc_code=OK} = %v, want 1", ok)
+	}
+}
+
+func TestSayHelloServerStream(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	tests := []struct {
+		name string
+		req  *pb.HelloRequest
+		want int
+	}{
+		{"defaults", &pb.HelloRequest{Name: "Stream", IntervalMs: proto.Uint32(1)}, defaultStreamCount},
+		{"count", &pb.HelloRequest{Name: "Stream", Count: proto.Uint32(3), IntervalMs: proto.Uint32(0)}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := s.client.SayHelloServerStream(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("SayHelloServerStream: %v", err)
+			}
+			messages, err := recvAll(stream)
+			if err != nil {
+				t.Fatalf("stream ended with %v", err)
+			}
+			if len(messages) != tt.want {
+				t.Fatalf("got %d messages, want %d: %q", len(messages), tt.want, messages)
+			}
+			for i, msg := range messages {
+				if want := fmt.Sprintf("Hello Stream! Message %d of %d", i+1, tt.want); msg != want {
+					t.Errorf("message %d = %q, want %q", i, msg, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamCancellation(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := s.client.SayHelloServerStream(ctx, &pb.HelloRequest{
+		Name: "Cancel", Count: proto.Uint32(100), IntervalMs: proto.Uint32(50),
+	})
+	if err != nil {
+		t.Fatalf("SayHelloServerStream: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("Recv %d: %v", i, err)
+		}
+	}
+	cancel()
+
+	if _, err := recvAll(stream); status.Code(err) != codes.Canceled {
+		t.Fatalf("stream ended with %v, want Canceled", err)
+	}
+
+	// The handler must return promptly instead of sending the remaining messages.
+	labels := map[string]string{"grpc_method": "SayHelloServerStream", "grpc_code": "Canceled"}
+	deadline := time.Now().Add(time.Second)
+	for s.counter(t, "grpc_server_handled_total", labels) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("server handler did not stop after the client cancelled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamDeadlines(t *testing.T) {
+	s := newTestServer(t, func(c *serverConfig) { c.MaxStreamDuration = 200 * time.Millisecond })
+	long := &pb.HelloRequest{Name: "Long", Count: proto.Uint32(100), IntervalMs: proto.Uint32(20)}
+
+	t.Run("client deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		stream, err := s.client.SayHelloServerStream(ctx, long)
+		if err != nil {
+			t.Fatalf("SayHelloServerStream: %v", err)
+		}
+		if _, err := recvAll(stream); status.Code(err) != codes.DeadlineExceeded {
+			t.Fatalf("stream ended with %v, want DeadlineExceeded", err)
+		}
+	})
+
+	t.Run("max stream duration", func(t *testing.T) {
+		stream, err := s.client.SayHelloServerStream(context.Background(), long)
+		if err != nil {
+			t.Fatalf("SayHelloServerStream: %v", err)
+		}
+		messages, err := recvAll(stream)
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Fatalf("stream ended with %v, want DeadlineExceeded", err)
+		}
+		if len(messages) == 0 || len(messages) >= 100 {
+			t.Errorf("got %d messages before the limit", len(messages))
+		}
+	})
+}
+
+func TestReflection(t *testing.T) {
+	listServices := func(t *testing.T, conn *grpc.ClientConn) ([]string, error) {
+		t.Helper()
+		stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		}); err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, svc := range resp.GetListServicesResponse().GetService() {
+			names = append(names, svc.GetName())
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		s := newTestServer(t, nil)
+		names, err := listServices(t, s.conn)
+		if err != nil {
+			t.Fatalf("list services: %v", err)
+		}
+		want := []string{"echostore.v1.EchoStoreService", "grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection", "hello.HelloService"}
+		if fmt.Sprint(names) != fmt.Sprint(want) {
+			t.Errorf("services = %v, want %v", names, want)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		s := newTestServer(t, func(c *serverConfig) { c.Reflection = false })
+		if _, err := listServices(t, s.conn); status.Code(err) != codes.Unimplemented {
+			t.Errorf("list services err = %v, want Unimplemented", err)
+		}
+	})
+}
+
+func TestErrorCodes(t *testing.T) {
+	t.Run("validation", func(t *testing.T) {
+		s := newTestServer(t, nil)
+		tests := []struct {
+			req   *pb.HelloRequest
+			field string
+		}{
+			{&pb.HelloRequest{}, "name"},
+			{&pb.HelloRequest{Name: "<script>"}, "name"},
+			{&pb.HelloRequest{Name: "Count", Count: proto.Uint32(0)}, "count"},
+			{&pb.HelloRequest{Name: "Interval", IntervalMs: proto.Uint32(60000)}, "interval_ms"},
+		}
+		for _, tt := range tests {
+			_, err := s.client.SayHello(context.Background(), tt.req)
+			st := status.Convert(err)
+			if st.Code() != codes.InvalidArgument {
+				t.Errorf("SayHello(%v) code = %v, want InvalidArgument", tt.req, st.Code())
+				continue
+			}
+			var fields []string
+			for _, d := range st.Details() {
+				if br, ok := d.(*errdetails.BadRequest); ok {
+					for _, v := range br.GetFieldViolations() {
+						fields = append(fields, v.GetField())
+					}
+				}
+			}
+			if len(fields) == 0 || fields[0] != tt.field {
+				t.Errorf("SayHello(%v) violations = %v, want field %s", tt.req, fields, tt.field)
+			}
+		}
+
+		// Streams validate the request before the first message.
+		stream, err := s.client.SayHelloServerStream(context.Background(), &pb.HelloRequest{})
+		if err != nil {
+			t.Fatalf("SayHelloServerStream: %v", err)
+		}
+		if _, err := recvAll(stream); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("stream err = %v, want InvalidArgument", err)
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		s := newTestServer(t, func(c *serverConfig) { c.RateLimit.Method = rateLimit{Rate: 1, Burst: 1} })
+		req := &pb.HelloRequest{Name: "Limited"}
+		if _, err := s.client.SayHello(context.Background(), req); err != nil {
+			t.Fatalf("first call: %v", err)
+		}
+
+		var trailer metadata.MD
+		_, err := s.client.SayHello(context.Background(), req, grpc.Trailer(&trailer))
+		st := status.Convert(err)
+		if st.Code() != codes.ResourceExhausted {
+			t.Fatalf("second call code = %v, want ResourceExhausted", st.Code())
+		}
+		var retry *errdetails.RetryInfo
+		for _, d := range st.Details() {
+			if r, ok := d.(*errdetails.RetryInfo); ok {
+				retry = r
+			}
+		}
+		if retry == nil || retry.GetRetryDelay().AsDuration() <= 0 {
+			t.Errorf("details = %v, want RetryInfo with a positive delay", st.Details())
+		}
+		if len(trailer.Get("grpc-retry-pushback-ms")) != 1 {
+			t.Errorf("trailer = %v, want grpc-retry-pushback-ms", trailer)
+		}
+
+		rejected := s.counter(t, "grpc_server_rate_limited_total", map[string]string{"grpc_method": "SayHello", "limit": "method"})
+		if rejected != 1 {
+			t.Errorf("grpc_server_rate_limited_total = %v, want 1", rejected)
+		}
+	})
+
+	t.Run("in-flight cap", func(t *testing.T) {
+		s := newTestServer(t, func(c *serverConfig) { c.RateLimit.MaxInFlight = 1 })
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := s.client.SayHelloServerStream(ctx, &pb.HelloRequest{
+			Name: "Busy", Count: proto.Uint32(100), IntervalMs: proto.Uint32(50),
+		})
+		if err != nil {
+			t.Fatalf("SayHelloServerStream: %v", err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+
+		_, err = s.client.SayHello(context.Background(), &pb.HelloRequest{Name: "Shed"})
+		if status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("SayHello while a stream is in flight: %v, want ResourceExhausted", err)
+		}
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		s := newTestServer(t, nil)
+		err := s.conn.Invoke(context.Background(), "/hello.HelloService/SayGoodbye", &pb.HelloRequest{Name: "x"}, &pb.HelloResponse{})
+		if status.Code(err) != codes.Unimplemented {
+			t.Errorf("err = %v, want Unimplemented", err)
+		}
+	})
+
+	t.Run("client deadline", func(t *testing.T) {
+		s := newTestServer(t, nil)
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		_, err := s.client.SayHello(ctx, &pb.HelloRequest{Name: "Late"})
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("err = %v, want DeadlineExceeded", err)
+		}
+	})
+}
+
+func TestInstanceID(t *testing.T) {
+	s := newTestServer(t, func(c *serverConfig) { c.InstanceID = "test-1" })
+
+	var header, trailer metadata.MD
+	if _, err := s.client.SayHello(context.Background(), &pb.HelloRequest{Name: "Replica"}, grpc.Header(&header), grpc.Trailer(&trailer)); err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if got := header.Get(instanceIDHeader); len(got) != 1 || got[0] != "test-1" {
+		t.Errorf("header %s = %q, want test-1", instanceIDHeader, got)
+	}
+	if got := trailer.Get(instanceIDHeader); len(got) != 1 || got[0] != "test-1" {
+		t.Errorf("trailer %s = %q, want test-1", instanceIDHeader, got)
+	}
+
+	// Calls rejected by validation carry it too.
+	trailer = nil
+	_, err := s.client.SayHello(context.Background(), &pb.HelloRequest{}, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("SayHello with empty name: %v, want InvalidArgument", err)
+	}
+	if got := trailer.Get(instanceIDHeader); len(got) != 1 || got[0] != "test-1" {
+		t.Errorf("error trailer %s = %q, want test-1", instanceIDHeader, got)
+	}
+
+	stream, err := s.client.SayHelloServerStream(context.Background(), &pb.HelloRequest{Name: "Replica", Count: proto.Uint32(1)})
+	if err != nil {
+		t.Fatalf("SayHelloServerStream: %v", err)
+	}
+	if _, err := recvAll(stream); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if got := stream.Trailer().Get(instanceIDHeader); len(got) != 1 || got[0] != "test-1" {
+		t.Errorf("stream trailer %s = %q, want test-1", instanceIDHeader, got)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxStreamDuration cancels the context of streams running longer than max,
+// so long-lived streams through Kong cannot pin server resources. Handlers
+// must watch stream.Context() for this to take effect.
+func maxStreamDuration(max time.Duration) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := context.WithTimeout(ss.Context(), max)
+		defer cancel()
+
+		err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		// Only report our own timeout; the client's deadline or cancellation
+		// surfaces as the handler returned it.
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && ss.Context().Err() == nil {
+			return status.Errorf(codes.DeadlineExceeded, "stream exceeded the maximum duration of %s", max)
+		}
+		return err
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// tlsOptions describes where the server certificate and client CA live on disk.
+type tlsOptions struct {
+	CertFile       string        `yaml:"cert_file"`
+	KeyFile        string        `yaml:"key_file"`
+	ClientCAFile   string        `yaml:"client_ca_file"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// enabled reports whether the server should listen with TLS (grpcs).
+func (o tlsOptions) enabled() bool {
+	return o.CertFile != "" || o.KeyFile != ""
+}
+
+func (o tlsOptions) validate() error {
+	if o.CertFile == "" || o.KeyFile == "" {
+		return fmt.Errorf("both a certificate and a key are required for TLS")
+	}
+	if o.ReloadInterval < 0 {
+		return fmt.Errorf("negative TLS reload interval: %s", o.ReloadInterval)
+	}
+	return nil
+}
+
+// certReloader keeps the server certificate and the client CA pool in sync
+// with the files on disk, so certificates can be rotated without a restart.
+type certReloader struct {
+	opts tlsOptions
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+func newCertReloader(opts tlsOptions) (*certReloader, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	r := &certReloader{opts: opts}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.opts.CertFile, r.opts.KeyFile}
+	if r.opts.ClientCAFile != "" {
+		files = append(files, r.opts.ClientCAFile)
+	}
+	return files
+}
+
+// reload reads the certificate, key and client CA from disk and swaps them in.
+func (r *certReloader) reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", f, err)
+		}
+		modTimes[f] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.opts.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return nil
+}
+
+// changed reports whether any of the watched files has a new modification time.
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			// The file may be mid-rotation; try again on the next tick.
+			continue
+		}
+		if !info.ModTime().Equal(r.modTimes[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch polls the certificate files and reloads them when they change.
+// A failed reload keeps serving the previous certificate.
+func (r *certReloader) watch(done <-chan struct{}) {
+	if r.opts.ReloadInterval == 0 {
+		return
+	}
+	ticker := time.NewTicker(r.opts.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Printf("TLS reload failed, keeping previous certificate: %v", err)
+				continue
+			}
+			log.Printf("TLS certificates reloaded from %s", r.opts.CertFile)
+		}
+	}
+}
+
+// tlsConfig returns a server config that resolves the certificate and client
+// CA on every handshake, picking up reloaded files for new connections.
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				// gRPC requires h2 to be negotiated via ALPN.
+				NextProtos: []string{"h2"},
+			}
+			if r.clientCAs != nil {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				cfg.ClientCAs = r.clientCAs
+			}
+			return cfg, nil
+		},
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	pb "grpc-server/pb"
+)
+
+// testCA issues certificates for the TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	ca := &testCA{}
+	ca.cert, ca.key, ca.pem = issueCert(t, tmpl, nil)
+	return ca
+}
+
+// issue returns the PEM encoded certificate and key for tmpl, signed by ca.
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate) (certPEM, keyPEM []byte) {
+	t.Helper()
+	_, key, certPEM := issueCert(t, tmpl, ca)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func issueCert(t *testing.T, tmpl *x509.Certificate, ca *testCA) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl.SerialNumber = serial
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	parent, signer := tmpl, key
+	if ca != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func serverCertTemplate(name string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		DNSNames:    []string{"localhost"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+}
+
+func clientCertTemplate(name string, uris ...string) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, u := range uris {
+		parsed, _ := url.Parse(u)
+		tmpl.URIs = append(tmpl.URIs, parsed)
+	}
+	return tmpl
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+// writeServerFiles writes a server certificate and key signed by ca and the
+// client CA bundle, returning the options to load them.
+func writeServerFiles(t *testing.T, dir string, ca, clientCA *testCA, name string) tlsOptions {
+	t.Helper()
+	opts := tlsOptions{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	certPEM, keyPEM := ca.issue(t, serverCertTemplate(name))
+	writeFile(t, opts.CertFile, certPEM)
+	writeFile(t, opts.KeyFile, keyPEM)
+	writeFile(t, opts.ClientCAFile, clientCA.pem)
+	return opts
+}
+
+func clientTLSConfig(t *testing.T, ca, clientCA *testCA, tmpl *x509.Certificate) *tls.Config {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	cfg := &tls.Config{RootCAs: roots, ServerName: "localhost", MinVersion: tls.VersionTLS12}
+	if tmpl != nil {
+		certPEM, keyPEM := clientCA.issue(t, tmpl)
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatalf("client key pair: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg
+}
+
+// TestMTLS runs the server behind the identity interceptors and a per-caller
+// limit with mTLS, and checks which clients get through, what identity the
+// handlers see and that direct clients are limited by their certificate.
+func TestMTLS(t *testing.T) {
+	ca := newTestCA(t, "test-ca")
+	opts := writeServerFiles(t, t.TempDir(), ca, ca, "server")
+	reloader, err := newCertReloader(opts)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+
+	var seen *clientIdentity
+	record := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		seen, _ = clientIdentityFromContext(ctx)
+		return handler(ctx, req)
+	}
+	cfg := defaultConfig().RateLimit
+	cfg.Caller = rateLimit{Rate: 0.01, Burst: 1}
+	limiter := newRateLimiter(cfg, prometheus.NewRegistry())
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(identityUnaryInterceptor, limiter.unaryInterceptor, record),
+		grpc.Creds(credentials.NewTLS(reloader.tlsConfig())),
+	)
+	pb.RegisterHelloServiceServer(server, &helloServer{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	call := func(cfg *tls.Config) error {
+		conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(cfg)))
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = pb.NewHelloServiceClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "mTLS"})
+		return err
+	}
+
+	other := newTestCA(t, "other-ca")
+	alice := clientTLSConfig(t, ca, ca, clientCertTemplate("alice"))
+	tests := []struct {
+		name     string
+		cfg      *tls.Config
+		want     codes.Code
+		wantCN   string
+		wantURIs []string
+	}{
+		{"no client certificate", clientTLSConfig(t, ca, ca, nil), codes.Unavailable, "", nil},
+		{"untrusted client certificate", clientTLSConfig(t, ca, other, clientCertTemplate("mallory")), codes.Unavailable, "", nil},
+		{"alice", alice, codes.OK, "alice", nil},
+		{"alice again, limited", alice, codes.ResourceExhausted, "", nil},
+		{"alice with a new certificate, limited", clientTLSConfig(t, ca, ca, clientCertTemplate("alice")), codes.ResourceExhausted, "", nil},
+		{"kong with a SPIFFE ID from the same address", clientTLSConfig(t, ca, ca, clientCertTemplate("kong", "spiffe://example.org/kong")), codes.OK, "kong", []string{"spiffe://example.org/kong"}},
+	}
+	for _, tt := range tests {
+		seen = nil
+		if got := status.Code(call(tt.cfg)); got != tt.want {
+			t.Errorf("%s: code = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		if tt.want != codes.OK {
+			continue
+		}
+		if seen == nil {
+			t.Errorf("%s: no client identity in the handler context", tt.name)
+			continue
+		}
+		if seen.CommonName != tt.wantCN || !reflect.DeepEqual(seen.URIs, tt.wantURIs) {
+			t.Errorf("%s: identity = %+v, want CN %q and URIs %v", tt.name, seen, tt.wantCN, tt.wantURIs)
+		}
+	}
+}
+
+func TestClientIdentityName(t *testing.T) {
+	tests := []struct {
+		id   clientIdentity
+		want string
+	}{
+		{clientIdentity{CommonName: "kong", URIs: []string{"spiffe://example.org/kong"}, DNSNames: []string{"kong.local"}}, "spiffe://example.org/kong"},
+		{clientIdentity{CommonName: "kong", DNSNames: []string{"kong.local"}}, "kong"},
+		{clientIdentity{DNSNames: []string{"kong.local"}}, "kong.local"},
+		{clientIdentity{SerialNumber: "42"}, "serial:42"},
+	}
+	for _, tt := range tests {
+		if got := tt.id.name(); got != tt.want {
+			t.Errorf("name(%+v) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+// serverName returns the common name of the certificate the server at addr
+// presents to a new connection.
+func serverName(t *testing.T, addr string, cfg *tls.Config) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := newTestCA(t, "test-ca")
+	dir := t.TempDir()
+	opts := writeServerFiles(t, dir, ca, ca, "server-1")
+	opts.ReloadInterval = 10 * time.Millisecond
+	reloader, err := newCertReloader(opts)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go reloader.watch(done)
+
+	cfg := reloader.tlsConfig()
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				// Accepted clients get a byte, so they can tell.
+				if conn.(*tls.Conn).Handshake() == nil {
+					conn.Write([]byte{1})
+				}
+				conn.Close()
+			}()
+		}
+	}()
+	client := clientTLSConfig(t, ca, ca, clientCertTemplate("kong"))
+	addr := lis.Addr().String()
+
+	if got := serverName(t, addr, client); got != "server-1" {
+		t.Fatalf("certificate = %s, want server-1", got)
+	}
+
+	// bump moves the modification time forward, as coarse file system clocks
+	// may not change it for quick rewrites.
+	mtime := time.Now()
+	bump := func(files ...string) {
+		mtime = mtime.Add(time.Second)
+		for _, f := range files {
+			if err := os.Chtimes(f, mtime, mtime); err != nil {
+				t.Fatalf("chtimes: %v", err)
+			}
+		}
+	}
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			got := serverName(t, addr, client)
+			if got == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("certificate = %s, want %s", got, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	writeServerFiles(t, dir, ca, ca, "server-2")
+	bump(opts.CertFile, opts.KeyFile, opts.ClientCAFile)
+	waitFor("server-2")
+
+	// A broken file keeps the previous certificate.
+	writeFile(t, opts.CertFile, []byte("not a certificate"))
+	bump(opts.CertFile)
+	time.Sleep(50 * time.Millisecond)
+	if got := serverName(t, addr, client); got != "server-2" {
+		t.Errorf("certificate after failed reload = %s, want server-2", got)
+	}
+
+	writeServerFiles(t, dir, ca, ca, "server-3")
+	bump(opts.CertFile, opts.KeyFile, opts.ClientCAFile)
+	waitFor("server-3")
+
+	// A rotated client CA rejects certificates from the old one.
+	newCA := newTestCA(t, "new-ca")
+	writeFile(t, opts.ClientCAFile, newCA.pem)
+	bump(opts.ClientCAFile)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := tls.Dial("tcp", addr, client)
+		if err == nil {
+			// TLS 1.3 reports a rejected client certificate on the first read.
+			_, err = conn.Read(make([]byte, 1))
+			conn.Close()
+		}
+		if err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("client certificate from the old CA still accepted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"grpc-server/pb/validatepb"
+)
+
+// patterns caches compiled (validate.rules).string.pattern regexps by field.
+var patterns sync.Map // protoreflect.FullName -> *regexp.Regexp
+
+func fieldPattern(fd protoreflect.FieldDescriptor, pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(fd.FullName()); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern on %s: %w", fd.FullName(), err)
+	}
+	patterns.Store(fd.FullName(), re)
+	return re, nil
+}
+
+// validateMessage checks msg and its nested messages against the
+// (validate.rules) field options and returns one violation per failed rule.
+func validateMessage(msg protoreflect.Message, prefix string) ([]*errdetails.BadRequest_FieldViolation, error) {
+	var violations []*errdetails.BadRequest_FieldViolation
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		path := prefix + string(fd.Name())
+
+		switch {
+		case fd.IsList() && fd.Kind() == protoreflect.MessageKind:
+			list := msg.Get(fd).List()
+			for j := 0; j < list.Len(); j++ {
+				v, err := validateMessage(list.Get(j).Message(), fmt.Sprintf("%s[%d].", path, j))
+				if err != nil {
+					return nil, err
+				}
+				violations = append(violations, v...)
+			}
+		case fd.IsMap():
+			// Map values are not validated.
+		case fd.Kind() == protoreflect.MessageKind:
+			if msg.Has(fd) {
+				v, err := validateMessage(msg.Get(fd).Message(), path+".")
+				if err != nil {
+					return nil, err
+				}
+				violations = append(violations, v...)
+			}
+		case fd.IsList():
+			// Rules on repeated scalars are not supported.
+		default:
+			rules, ok := proto.GetExtension(fd.Options(), validatepb.E_Rules).(*validatepb.FieldRules)
+			if !ok || rules == nil {
+				continue
+			}
+			switch {
+			case rules.GetString_() != nil && fd.Kind() == protoreflect.StringKind:
+				v, err := validateString(fd, path, msg.Get(fd).String(), rules.GetString_())
+				if err != nil {
+					return nil, err
+				}
+				violations = append(violations, v...)
+			case rules.GetUint32() != nil && fd.Kind() == protoreflect.Uint32Kind:
+				if fd.HasPresence() && !msg.Has(fd) {
+					continue
+				}
+				violations = append(violations, validateUint32(path, uint32(msg.Get(fd).Uint()), rules.GetUint32())...)
+			}
+		}
+	}
+	return violations, nil
+}
+
+func validateString(fd protoreflect.FieldDescriptor, path, value string, rules *validatepb.StringRules) ([]*errdetails.BadRequest_FieldViolation, error) {
+	var violations []*errdetails.BadRequest_FieldViolation
+	violate := func(format string, args ...interface{}) {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       path,
+			Description: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if value == "" {
+		if rules.GetRequired() {
+			violate("value is required")
+		}
+		// Other rules only apply to set values.
+		return violations, nil
+	}
+	n := uint64(utf8.RuneCountInString(value))
+	if rules.MinLen != nil && n < rules.GetMinLen() {
+		violate("value length must be at least %d characters", rules.GetMinLen())
+	}
+	if rules.MaxLen != nil && n > rules.GetMaxLen() {
+		violate("value length must be at most %d characters", rules.GetMaxLen())
+	}
+	if rules.GetPattern() != "" {
+		re, err := fieldPattern(fd, rules.GetPattern())
+		if err != nil {
+			return nil, err
+		}
+		if !re.MatchString(value) {
+			violate("value does not match pattern %q", rules.GetPattern())
+		}
+	}
+	return violations, nil
+}
+
+func validateUint32(path string, value uint32, rules *validatepb.UInt32Rules) []*errdetails.BadRequest_FieldViolation {
+	var violations []*errdetails.BadRequest_FieldViolation
+	if rules.Gte != nil && value < rules.GetGte() {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       path,
+			Description: fmt.Sprintf("value must be greater than or equal to %d", rules.GetGte()),
+		})
+	}
+	if rules.Lte != nil && value > rules.GetLte() {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       path,
+			Description: fmt.Sprintf("value must be less than or equal to %d", rules.GetLte()),
+		})
+	}
+	return violations
+}
+
+// validateRequest returns an InvalidArgument status with google.rpc.BadRequest
+// details if req breaks any rule. Non-proto requests are accepted as is.
+func validateRequest(req interface{}) error {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+	violations, err := validateMessage(msg.ProtoReflect(), "")
+	if err != nil {
+		return status.Errorf(codes.Internal, "validation failed: %v", err)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	desc := fmt.Sprintf("invalid %s: %s %s", msg.ProtoReflect().Descriptor().Name(), violations[0].Field, violations[0].Description)
+	if len(violations) > 1 {
+		desc += fmt.Sprintf(" (and %d more)", len(violations)-1)
+	}
+	st, err := status.New(codes.InvalidArgument, desc).WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, desc)
+	}
+	return st.Err()
+}
+
+func validationUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func validationStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &validatingStream{ServerStream: ss})
+}
+
+// validatingStream validates every message the client sends on a stream.
+type validatingStream struct {
+	grpc.ServerStream
+}
+
+func (s *validatingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validateRequest(m)
+}
@@ -7,13 +7,27 @@ until curl -s http://localhost:18001/status > /dev/null 2>&1; do
 done
 echo "Kong is ready!"
 
+# Upstream protocol: grpc (plaintext) or grpcs (TLS to grpc-server)
+GRPC_PROTOCOL=${GRPC_PROTOCOL:-grpc}
+
+# For mTLS, upload the client certificate Kong presents to grpc-server
+CLIENT_CERT_ARGS=()
+if [ -n "$KONG_CLIENT_CERT" ] && [ -n "$KONG_CLIENT_KEY" ]; then
+    echo "Uploading Kong client certificate..."
+    CERT_ID=$(curl -s -X POST http://localhost:18001/certificates \
+      --data-urlencode "cert@${KONG_CLIENT_CERT}" \
+      --data-urlencode "key@${KONG_CLIENT_KEY}" | jq -r '.id')
+    CLIENT_CERT_ARGS=(--data "client_certificate.id=${CERT_ID}")
+fi
+
 # Create gRPC Service
-echo "Creating gRPC service..."
+echo "Creating gRPC service (${GRPC_PROTOCOL})..."
 curl -s -X POST http://localhost:18001/services \
   --data "name=grpc-hello-service" \
-  --data "protocol=grpc" \
+  --data "protocol=${GRPC_PROTOCOL}" \
   --data "host=grpc-server" \
-  --data "port=50051"
+  --data "port=50051" \
+  "${CLIENT_CERT_ARGS[@]}"
 
 echo ""
 
@@ -26,6 +40,95 @@ curl -s -X POST http://localhost:18001/services/grpc-hello-service/routes \
 
 echo ""
 
+# EchoStoreService in the same binary
+echo "Creating gRPC echostore service (${GRPC_PROTOCOL})..."
+curl -s -X POST http://localhost:18001/services \
+  --data "name=grpc-echostore-service" \
+  --data "protocol=${GRPC_PROTOCOL}" \
+  --data "host=grpc-server" \
+  --data "port=50051" \
+  "${CLIENT_CERT_ARGS[@]}"
+
+echo ""
+
+# Package-wide route
+echo "Creating gRPC echostore routes..."
+curl -s -X POST http://localhost:18001/services/grpc-echostore-service/routes \
+  --data "name=grpc-echostore-route" \
+  --data "protocols[]=grpc" \
+  --data "paths[]=/echostore.v1.EchoStoreService"
+
+echo ""
+
+# Method-level route for writes, with its own rate limit
+curl -s -X POST http://localhost:18001/services/grpc-echostore-service/routes \
+  --data "name=grpc-echostore-put-route" \
+  --data "protocols[]=grpc" \
+  --data "paths[]=/echostore.v1.EchoStoreService/Put"
+
+echo ""
+
+curl -s -X POST http://localhost:18001/routes/grpc-echostore-put-route/plugins \
+  --data "name=rate-limiting" \
+  --data "config.minute=300" \
+  --data "config.policy=local"
+
+echo ""
+
+# Header-based route: x-echostore-track: canary, tagged by request-transformer
+curl -s -X POST http://localhost:18001/services/grpc-echostore-service/routes \
+  --data "name=grpc-echostore-canary-route" \
+  --data "protocols[]=grpc" \
+  --data "paths[]=/echostore.v1.EchoStoreService" \
+  --data "headers.x-echostore-track=canary"
+
+echo ""
+
+curl -s -X POST http://localhost:18001/routes/grpc-echostore-canary-route/plugins \
+  --data "name=request-transformer" \
+  --data "config.add.headers=x-kong-route:canary"
+
+echo ""
+
+# REST/JSON gateway served by the same binary
+echo "Creating REST service..."
+curl -s -X POST http://localhost:18001/services \
+  --data "name=rest-hello-service" \
+  --data "protocol=http" \
+  --data "host=grpc-server" \
+  --data "port=8080"
+
+echo ""
+
+echo "Creating REST route..."
+curl -s -X POST http://localhost:18001/services/rest-hello-service/routes \
+  --data "name=rest-hello-route" \
+  --data "protocols[]=http" \
+  --data "paths[]=/v1/hello" \
+  --data "strip_path=false"
+
+echo ""
+
+# gRPC-Web (HTTP/1.1) from browsers, served by the same HTTP listener
+echo "Creating gRPC-Web route..."
+curl -s -X POST http://localhost:18001/services/rest-hello-service/routes \
+  --data "name=grpc-web-hello-route" \
+  --data "protocols[]=http" \
+  --data "paths[]=/hello.HelloService" \
+  --data "strip_path=false"
+
+echo ""
+
+# Export Kong spans so they share a trace with grpc-server (W3C traceparent)
+if [ -n "$OTEL_COLLECTOR_URL" ]; then
+    echo "Enabling opentelemetry plugin..."
+    curl -s -X POST http://localhost:18001/services/grpc-hello-service/plugins \
+      --data "name=opentelemetry" \
+      --data "config.endpoint=${OTEL_COLLECTOR_URL}" \
+      --data "config.header_type=w3c"
+    echo ""
+fi
+
 # Verify configuration
 echo ""
 echo "=== Configured Services ==="
@@ -44,3 +147,7 @@ echo "  grpcurl -plaintext -d '{\"name\": \"World\"}' localhost:50051 hello.Hell
 echo ""
 echo "  # Through Kong:"
 echo "  grpcurl -plaintext -d '{\"name\": \"World\"}' localhost:19080 hello.HelloService/SayHello"
+echo "  grpcurl -plaintext -d '{\"key\": \"greeting\", \"value\": \"hi\"}' localhost:19080 echostore.v1.EchoStoreService/Put"
+echo ""
+echo "  # REST through Kong:"
+echo "  curl http://localhost:18000/v1/hello/World"
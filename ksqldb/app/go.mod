@@ -1,7 +1,10 @@
 module github.com/example/ksqldb-demo
 
-go 1.21
+go 1.23
 
 require (
 	github.com/confluentinc/confluent-kafka-go/v2 v2.3.0
+	golang.org/x/net v0.30.0
 )
+
+require golang.org/x/text v0.19.0 // indirect
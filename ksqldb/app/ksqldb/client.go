@@ -1,244 +1,260 @@
 package ksqldb
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	timeout    time.Duration
+	header     http.Header
+
+	transport http.RoundTripper
+	tlsConfig *tls.Config
+	http2     bool
+	username  string
+	password  string
+	token     string
 }
 
-func NewClient(baseURL string) *Client {
-	return &Client{
+// NewClient returns a client for the ksqlDB server at baseURL, e.g.
+// "http://localhost:8088".
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
 		baseURL:    strings.TrimSuffix(baseURL, "/"),
 		httpClient: &http.Client{},
+		timeout:    DefaultTimeout,
+		header:     make(http.Header),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	scheme, _, _ := strings.Cut(c.baseURL, "://")
+	if rt := c.newTransport(scheme); rt != nil {
+		hc := *c.httpClient
+		hc.Transport = rt
+		c.httpClient = &hc
+	}
+	return c
 }
 
-type queryRequest struct {
-	KSQL string `json:"ksql"`
-}
-
-type pullQueryResponse struct {
-	Schema     string          `json:"@type,omitempty"`
-	QueryID    string          `json:"queryId,omitempty"`
-	ColumnNames []string       `json:"columnNames,omitempty"`
-	ColumnTypes []string       `json:"columnTypes,omitempty"`
-	Row        *rowData        `json:"row,omitempty"`
-	FinalMessage string        `json:"finalMessage,omitempty"`
-}
-
-type rowData struct {
-	Columns []interface{} `json:"columns"`
+// requestContext applies the client timeout to a request that is expected
+// to complete.
+func (c *Client) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
 }
 
-// PullQuery executes a pull query and returns all rows
-func (c *Client) PullQuery(query string) ([]map[string]interface{}, error) {
-	reqBody := queryRequest{KSQL: query}
-	jsonBody, err := json.Marshal(reqBody)
+// post sends body as JSON to path with the configured headers and credentials.
+func (c *Client) post(ctx context.Context, path string, body interface{}, accept string) (*http.Response, error) {
+	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
-
-	req, err := http.NewRequest("POST", c.baseURL+"/query", bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+path, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/vnd.ksql.v1+json")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	return c.do(req)
+}
 
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	} else if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	// Auth options clear an earlier Authorization header, so one still set
+	// here came later and wins.
+	for k := range c.header {
+		req.Header.Set(k, c.header.Get(k))
+	}
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("query failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse as JSON array
-	var rawResponse []json.RawMessage
-	if err := json.Unmarshal(body, &rawResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
+	return resp, nil
+}
 
-	var results []map[string]interface{}
-	var columnNames []string
+type queryRequest struct {
+	KSQL              string                 `json:"ksql"`
+	StreamsProperties map[string]interface{} `json:"streamsProperties,omitempty"`
+}
 
-	for _, raw := range rawResponse {
-		var item map[string]interface{}
-		if err := json.Unmarshal(raw, &item); err != nil {
-			continue
-		}
+// queryItem is an element of the /query response array: a header, a row,
+// an error or the final message.
+type queryItem struct {
+	Header *struct {
+		QueryID string `json:"queryId"`
+		Schema  string `json:"schema"`
+	} `json:"header,omitempty"`
+	Row *struct {
+		Columns []json.RawMessage `json:"columns"`
+	} `json:"row,omitempty"`
+	ErrorMessage *Error `json:"errorMessage,omitempty"`
+	FinalMessage string `json:"finalMessage,omitempty"`
+}
 
-		// Parse header to get schema
-		if header, ok := item["header"].(map[string]interface{}); ok {
-			if schema, ok := header["schema"].(string); ok {
-				columnNames = parseSchema(schema)
-			}
-		}
+// PullQuery executes a pull query and returns all rows
+func (c *Client) PullQuery(query string) ([]map[string]interface{}, error) {
+	return c.PullQueryContext(context.Background(), query)
+}
 
-		// Parse row data
-		if row, ok := item["row"].(map[string]interface{}); ok {
-			if columns, ok := row["columns"].([]interface{}); ok && len(columnNames) > 0 {
-				rowMap := make(map[string]interface{})
-				for i, name := range columnNames {
-					if i < len(columns) {
-						rowMap[name] = columns[i]
-					}
-				}
-				results = append(results, rowMap)
-			}
+// PullQueryContext is PullQuery with a context.
+func (c *Client) PullQueryContext(ctx context.Context, query string) ([]map[string]interface{}, error) {
+	results := []map[string]interface{}{}
+	err := c.pullQuery(ctx, query, func(row Row) error {
+		rowMap, err := row.Map()
+		if err != nil {
+			return err
 		}
+		results = append(results, rowMap)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	return results, nil
 }
 
-// parseSchema extracts column names from schema string like "`COL1` TYPE, `COL2` TYPE"
-func parseSchema(schema string) []string {
-	var names []string
-	parts := strings.Split(schema, ",")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if strings.HasPrefix(part, "`") {
-			end := strings.Index(part[1:], "`")
-			if end > 0 {
-				names = append(names, part[1:end+1])
-			}
+// pullQuery calls fn with each row of a pull query, stopping at the first
+// error.
+func (c *Client) pullQuery(ctx context.Context, query string, fn func(Row) error) error {
+	stream, err := c.StreamPullQuery(ctx, query)
+	if err != nil {
+		return err
+	}
+	for row, err := range stream.Rows() {
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
 		}
 	}
-	return names
+	return nil
 }
 
-// PushQuery executes a push query and streams results
-func (c *Client) PushQuery(ctx context.Context, query string, handler func(map[string]interface{})) error {
-	reqBody := map[string]interface{}{
-		"sql": query,
-		"properties": map[string]string{
-			"auto.offset.reset": "earliest",
-		},
-	}
-	jsonBody, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+// rowToMap decodes a row into a map keyed by column name, with numbers as float64.
+func rowToMap(columns []Column, values []json.RawMessage) (map[string]interface{}, error) {
+	row := make(map[string]interface{}, len(columns))
+	for i, col := range columns {
+		if i >= len(values) {
+			break
+		}
+		var v interface{}
+		if err := json.Unmarshal(values[i], &v); err != nil {
+			return nil, fmt.Errorf("failed to decode column %s: %w", col.Name, err)
+		}
+		row[col.Name] = v
 	}
+	return row, nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/query-stream", bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/vnd.ksql.v1+json")
-	req.Header.Set("Accept", "application/vnd.ksqlapi.delimited.v1")
+// PushQuery executes a push query and calls handler with each row until
+// ctx is done or the query ends. See Subscribe for the options.
+func (c *Client) PushQuery(ctx context.Context, query string, handler func(map[string]interface{}), opts ...QueryOption) error {
+	return c.pushQuery(ctx, query, opts, func(row Row) error {
+		rowMap, err := row.Map()
+		if err != nil {
+			return err
+		}
+		handler(rowMap)
+		return nil
+	})
+}
 
-	resp, err := c.httpClient.Do(req)
+// pushQuery calls handler with each row of a push query until ctx is done,
+// the query ends or handler fails.
+func (c *Client) pushQuery(ctx context.Context, query string, opts []QueryOption, handler func(Row) error) error {
+	sub, err := c.Subscribe(ctx, query, opts...)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("query failed with status %d: %s", resp.StatusCode, string(body))
+		return err
 	}
-
-	reader := bufio.NewReader(resp.Body)
-	var columnNames []string
-
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
-		line, err := reader.ReadString('\n')
+	for row, err := range sub.Rows() {
 		if err != nil {
-			if err == io.EOF {
-				return nil
-			}
-			return fmt.Errorf("read error: %w", err)
+			return err
 		}
-
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		var data interface{}
-		if err := json.Unmarshal([]byte(line), &data); err != nil {
-			continue
-		}
-
-		switch v := data.(type) {
-		case map[string]interface{}:
-			// Header with column names
-			if names, ok := v["columnNames"].([]interface{}); ok {
-				columnNames = make([]string, len(names))
-				for i, n := range names {
-					columnNames[i] = n.(string)
-				}
-			}
-		case []interface{}:
-			// Data row
-			if len(columnNames) > 0 {
-				row := make(map[string]interface{})
-				for i, name := range columnNames {
-					if i < len(v) {
-						row[name] = v[i]
-					}
-				}
-				handler(row)
-			}
+		if err := handler(row); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 // ExecuteStatement executes a ksqlDB statement (CREATE, INSERT, etc.)
 func (c *Client) ExecuteStatement(statement string) error {
-	reqBody := queryRequest{KSQL: statement}
-	jsonBody, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
+	return c.ExecuteStatementContext(context.Background(), statement)
+}
 
-	req, err := http.NewRequest("POST", c.baseURL+"/ksql", bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/vnd.ksql.v1+json")
+// ExecuteStatementContext is ExecuteStatement with a context.
+func (c *Client) ExecuteStatementContext(ctx context.Context, statement string) error {
+	return c.statement(ctx, statement, nil)
+}
 
-	resp, err := c.httpClient.Do(req)
+// statement runs statement on /ksql and decodes the response array into
+// out, unless out is nil.
+func (c *Client) statement(ctx context.Context, statement string, out interface{}) error {
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+	resp, err := c.post(ctx, "/ksql", queryRequest{KSQL: statement}, "")
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("statement failed with status %d: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("statement failed: %w", newError(resp.StatusCode, body))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
 	}
-
 	return nil
 }
 
 // GetServerInfo returns ksqlDB server information
 func (c *Client) GetServerInfo() (map[string]interface{}, error) {
-	resp, err := c.httpClient.Get(c.baseURL + "/info")
+	return c.GetServerInfoContext(context.Background())
+}
+
+// GetServerInfoContext is GetServerInfo with a context.
+func (c *Client) GetServerInfoContext(ctx context.Context) (map[string]interface{}, error) {
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/info", nil)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("info request failed: %w", newError(resp.StatusCode, body))
+	}
+
 	var info map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
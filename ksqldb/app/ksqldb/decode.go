@@ -0,0 +1,509 @@
+package ksqldb
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PullQueryInto executes a pull query and decodes each row into a T, which
+// is usually a struct whose fields are mapped to columns by a ksql tag:
+//
+//	type OrderTotal struct {
+//		CustomerID  string      `ksql:"CUSTOMER_ID"`
+//		OrderCount  int64       `ksql:"ORDER_COUNT"`
+//		TotalAmount json.Number `ksql:"TOTAL_AMOUNT"`
+//	}
+//
+// Untagged fields match columns by name, ignoring case and underscores, so
+// CustomerID also matches CUSTOMER_ID; `ksql:"-"` skips a field. Fields of
+// embedded structs are promoted, and nil embedded pointers are allocated
+// when one of their columns is present. As with encoding/json, a column
+// goes to the shallowest field matching it and then to a tagged one; if
+// that leaves several, decoding fails. Columns without a field are ignored.
+//
+// Numbers are decoded without going through float64, so BIGINT fits int64
+// exactly and DECIMAL keeps its digits in a json.Number, string or a type
+// implementing encoding.TextUnmarshaler such as *big.Rat. TIMESTAMP, DATE
+// and TIME decode into time.Time (in UTC), BYTES into []byte, ARRAY into
+// slices, MAP into maps with string keys and STRUCT into structs, using the
+// same field mapping. Values stored in interface{} fields take the Go type
+// of the column type (int64 for BIGINT, json.Number for DECIMAL and so on).
+// NULL leaves the zero value; use pointer fields to tell it apart.
+func PullQueryInto[T any](ctx context.Context, c *Client, query string) ([]T, error) {
+	results := []T{}
+	err := c.pullQuery(ctx, query, func(row Row) error {
+		var v T
+		if err := row.Decode(&v); err != nil {
+			return err
+		}
+		results = append(results, v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// PushQueryInto executes a push query and calls handler with each row
+// decoded into a T as by PullQueryInto. It returns when ctx is done, the
+// query ends, or a row fails to decode or handler returns an error, which
+// is then returned. See Subscribe for the options.
+func PushQueryInto[T any](ctx context.Context, c *Client, query string, handler func(T) error, opts ...QueryOption) error {
+	return c.pushQuery(ctx, query, opts, func(row Row) error {
+		var v T
+		if err := row.Decode(&v); err != nil {
+			return err
+		}
+		return handler(v)
+	})
+}
+
+// decodeRow decodes the values of a row into the value dst points to. The
+// row is decoded like a STRUCT with the columns as fields.
+func decodeRow(columns []Column, values []json.RawMessage, dst interface{}) error {
+	row := make(map[string]interface{}, len(columns))
+	for i, col := range columns {
+		if i >= len(values) {
+			break
+		}
+		dec := json.NewDecoder(bytes.NewReader(values[i]))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return fmt.Errorf("failed to decode column %s: %w", col.Name, err)
+		}
+		row[col.Name] = v
+	}
+	if err := assign(reflect.ValueOf(dst).Elem(), row, &Type{Base: TypeStruct, Fields: columns}); err != nil {
+		return fmt.Errorf("failed to decode row: %w", err)
+	}
+	return nil
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	numberType          = reflect.TypeOf(json.Number(""))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	timeLayouts         = map[string][]string{
+		TypeTimestamp: {"2006-01-02T15:04:05.999999999", time.RFC3339Nano},
+		TypeDate:      {"2006-01-02"},
+		TypeTime:      {"15:04:05.999999999"},
+	}
+	anyTimeLayouts = []string{"2006-01-02T15:04:05.999999999", time.RFC3339Nano, "2006-01-02", "15:04:05.999999999"}
+)
+
+// naturalType returns the Go type of values of t in interface{} targets.
+func naturalType(t *Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	switch t.Base {
+	case TypeBoolean:
+		return reflect.TypeOf(false)
+	case TypeInteger:
+		return reflect.TypeOf(int32(0))
+	case TypeBigint:
+		return reflect.TypeOf(int64(0))
+	case TypeDouble:
+		return reflect.TypeOf(float64(0))
+	case TypeDecimal:
+		return numberType
+	case TypeString:
+		return reflect.TypeOf("")
+	case TypeBytes:
+		return reflect.TypeOf([]byte(nil))
+	case TypeTimestamp, TypeDate, TypeTime:
+		return timeType
+	case TypeArray:
+		return reflect.TypeOf([]interface{}(nil))
+	case TypeMap, TypeStruct:
+		return reflect.TypeOf(map[string]interface{}(nil))
+	}
+	return nil
+}
+
+// elem returns the element type of an ARRAY or MAP, or nil.
+func (t *Type) elem() *Type {
+	if t == nil {
+		return nil
+	}
+	return t.Elem
+}
+
+// assign stores src, a value decoded by encoding/json with UseNumber, in
+// dst. t is the ksqlDB type of src, or nil if unknown.
+func assign(dst reflect.Value, src interface{}, t *Type) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(dst.Elem(), src, t)
+	}
+
+	switch dt := dst.Type(); {
+	case dt == timeType:
+		ts, err := parseTimestamp(src, t)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(ts))
+		return nil
+	case dt == numberType:
+		switch s := src.(type) {
+		case json.Number:
+			dst.SetString(string(s))
+			return nil
+		case string:
+			if _, err := strconv.ParseFloat(s, 64); err != nil {
+				return fmt.Errorf("cannot decode %q into json.Number", s)
+			}
+			dst.SetString(s)
+			return nil
+		}
+		return mismatch(src, dt)
+	case reflect.PointerTo(dt).Implements(textUnmarshalerType):
+		var text string
+		switch s := src.(type) {
+		case json.Number:
+			text = string(s)
+		case string:
+			text = s
+		default:
+			return mismatch(src, dt)
+		}
+		return dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	case reflect.PointerTo(dt).Implements(jsonUnmarshalerType):
+		data, err := json.Marshal(src)
+		if err != nil {
+			return err
+		}
+		return dst.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(data)
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			return mismatch(src, dst.Type())
+		}
+		nt := naturalType(t)
+		if nt == nil {
+			dst.Set(reflect.ValueOf(src))
+			return nil
+		}
+		v := reflect.New(nt).Elem()
+		if err := assign(v, src, t); err != nil {
+			return err
+		}
+		dst.Set(v)
+	case reflect.String:
+		switch s := src.(type) {
+		case string:
+			dst.SetString(s)
+		case json.Number:
+			dst.SetString(string(s))
+		default:
+			return mismatch(src, dst.Type())
+		}
+	case reflect.Bool:
+		b, ok := src.(bool)
+		if !ok {
+			return mismatch(src, dst.Type())
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := src.(json.Number)
+		if !ok {
+			return mismatch(src, dst.Type())
+		}
+		i, err := strconv.ParseInt(string(n), 10, 64)
+		if err != nil || dst.OverflowInt(i) {
+			return fmt.Errorf("cannot decode %s into %s", n, dst.Type())
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := src.(json.Number)
+		if !ok {
+			return mismatch(src, dst.Type())
+		}
+		u, err := strconv.ParseUint(string(n), 10, 64)
+		if err != nil || dst.OverflowUint(u) {
+			return fmt.Errorf("cannot decode %s into %s", n, dst.Type())
+		}
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		n, ok := src.(json.Number)
+		if !ok {
+			return mismatch(src, dst.Type())
+		}
+		f, err := strconv.ParseFloat(string(n), dst.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot decode %s into %s", n, dst.Type())
+		}
+		dst.SetFloat(f)
+	case reflect.Slice:
+		// BYTES arrive base64 encoded.
+		if s, ok := src.(string); ok && dst.Type().Elem().Kind() == reflect.Uint8 && (t == nil || t.Base == TypeBytes) {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return fmt.Errorf("cannot decode %q into %s: %w", s, dst.Type(), err)
+			}
+			dst.SetBytes(b)
+			return nil
+		}
+		items, ok := src.([]interface{})
+		if !ok {
+			return mismatch(src, dst.Type())
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assign(slice.Index(i), item, t.elem()); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		dst.Set(slice)
+	case reflect.Array:
+		items, ok := src.([]interface{})
+		if !ok || len(items) > dst.Len() {
+			return mismatch(src, dst.Type())
+		}
+		for i := 0; i < dst.Len(); i++ {
+			var item interface{}
+			if i < len(items) {
+				item = items[i]
+			}
+			if err := assign(dst.Index(i), item, t.elem()); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+	case reflect.Map:
+		entries, ok := src.(map[string]interface{})
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return mismatch(src, dst.Type())
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), len(entries))
+		for k, item := range entries {
+			itemType := t.elem()
+			if t != nil && t.Base == TypeStruct {
+				itemType = t.field(k)
+			}
+			v := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(v, item, itemType); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			m.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), v)
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		entries, ok := src.(map[string]interface{})
+		if !ok {
+			return mismatch(src, dst.Type())
+		}
+		fields, err := structFields(dst.Type())
+		if err != nil {
+			return err
+		}
+		for k, item := range entries {
+			index, ok := fields.lookup(k)
+			if !ok {
+				continue
+			}
+			if err := assign(fieldByIndex(dst, index), item, t.field(k)); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+	default:
+		return fmt.Errorf("cannot decode into unsupported type %s", dst.Type())
+	}
+	return nil
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex, except that it allocates nil
+// embedded struct pointers on the way instead of panicking.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func mismatch(src interface{}, t reflect.Type) error {
+	kind := "string"
+	switch src.(type) {
+	case json.Number:
+		kind = "number"
+	case bool:
+		kind = "boolean"
+	case []interface{}:
+		kind = "array"
+	case map[string]interface{}:
+		kind = "object"
+	}
+	return fmt.Errorf("cannot decode %s into %s", kind, t)
+}
+
+// parseTimestamp parses a TIMESTAMP, DATE or TIME value of type t (any of
+// them if nil). ksqlDB sends them as strings without a zone, or as
+// milliseconds since the epoch, days since the epoch and milliseconds since
+// midnight respectively.
+func parseTimestamp(src interface{}, t *Type) (time.Time, error) {
+	base := ""
+	if t != nil {
+		base = t.Base
+	}
+	switch s := src.(type) {
+	case string:
+		layouts, ok := timeLayouts[base]
+		if !ok {
+			layouts = anyTimeLayouts
+		}
+		for _, layout := range layouts {
+			if ts, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+				return ts, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot decode %q into time.Time", s)
+	case json.Number:
+		n, err := s.Int64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("cannot decode %s into time.Time", s)
+		}
+		if base == TypeDate {
+			return time.Unix(n*24*60*60, 0).UTC(), nil
+		}
+		// TIME counts from midnight of the zero date, as time.Parse does.
+		if base == TypeTime {
+			return time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(n) * time.Millisecond), nil
+		}
+		return time.UnixMilli(n).UTC(), nil
+	}
+	return time.Time{}, mismatch(src, timeType)
+}
+
+// fieldMap maps column names to struct field indexes.
+// fieldMap maps normalized column names to struct field indexes.
+type fieldMap map[string][]int
+
+func (m fieldMap) lookup(column string) ([]int, bool) {
+	index, ok := m[normalizeName(column)]
+	return index, ok
+}
+
+var fieldCache sync.Map // map[reflect.Type]fieldMap
+
+// fieldCandidate is a field that matches the column name.
+type fieldCandidate struct {
+	field  reflect.StructField
+	name   string
+	tagged bool
+}
+
+// dominates reports whether c wins over other for a column, as with
+// encoding/json: the shallower field wins, then the one with a ksql tag.
+func (c fieldCandidate) dominates(other fieldCandidate) bool {
+	if len(c.field.Index) != len(other.field.Index) {
+		return len(c.field.Index) < len(other.field.Index)
+	}
+	return c.tagged && !other.tagged
+}
+
+// structFields returns the column mapping of the exported fields of t. It
+// is an error if no single field dominates the others matching a column.
+func structFields(t reflect.Type) (fieldMap, error) {
+	if m, ok := fieldCache.Load(t); ok {
+		return m.(fieldMap), nil
+	}
+	var columns []string
+	candidates := make(map[string][]fieldCandidate)
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous && isStruct(f.Type) && f.Tag.Get("ksql") == "" {
+			continue
+		}
+		// Fields promoted through an unexported embedded pointer cannot be
+		// set when the pointer is nil, as with encoding/json.
+		if unexportedPointerEmbed(t, f.Index) {
+			continue
+		}
+		c := fieldCandidate{field: f, name: f.Tag.Get("ksql"), tagged: true}
+		switch c.name {
+		case "-":
+			continue
+		case "":
+			c.name, c.tagged = f.Name, false
+		}
+		column := normalizeName(c.name)
+		if _, ok := candidates[column]; !ok {
+			columns = append(columns, column)
+		}
+		candidates[column] = append(candidates[column], c)
+	}
+
+	m := make(fieldMap, len(columns))
+	for _, column := range columns {
+		var best []fieldCandidate
+		for _, c := range candidates[column] {
+			switch {
+			case len(best) == 0 || c.dominates(best[0]):
+				best = []fieldCandidate{c}
+			case !best[0].dominates(c):
+				best = append(best, c)
+			}
+		}
+		if len(best) > 1 {
+			return nil, fmt.Errorf("%s: fields %s and %s both match column %s", t, best[0].field.Name, best[1].field.Name, best[1].name)
+		}
+		m[column] = best[0].field.Index
+	}
+	fieldCache.Store(t, m)
+	return m, nil
+}
+
+// isStruct reports whether t is a struct or a pointer to one.
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// unexportedPointerEmbed reports whether the field of t at index is reached
+// through an unexported embedded struct pointer.
+func unexportedPointerEmbed(t reflect.Type, index []int) bool {
+	for _, x := range index[:len(index)-1] {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		f := t.Field(x)
+		if !f.IsExported() && f.Type.Kind() == reflect.Pointer {
+			return true
+		}
+		t = f.Type
+	}
+	return false
+}
+
+// normalizeName folds case and drops underscores, so CustomerID matches
+// CUSTOMER_ID.
+func normalizeName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "_", ""))
+}
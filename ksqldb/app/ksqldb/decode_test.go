@@ -0,0 +1,225 @@
+package ksqldb
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeJSON decodes data the way rows are decoded, with UseNumber.
+func decodeJSON(t *testing.T, data string) interface{} {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader([]byte(data)))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	return v
+}
+
+type address struct {
+	City string
+	Zip  string `ksql:"ZIP_CODE"`
+}
+
+func TestAssign(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 45, 123000000, time.UTC)
+	seven := int64(7)
+	tests := []struct {
+		name string
+		typ  string // ksqlDB type of the value; empty if unknown
+		json string
+		want interface{} // also gives the Go type decoded into, except for interface cases
+		err  string
+	}{
+		{name: "BOOLEAN", typ: "BOOLEAN", json: `true`, want: true},
+		{name: "BOOLEAN from number", typ: "BOOLEAN", json: `1`, want: false, err: "cannot decode number into bool"},
+		{name: "INTEGER", typ: "INTEGER", json: `-42`, want: int32(-42)},
+		{name: "INTEGER overflow", typ: "INTEGER", json: `2147483648`, want: int32(0), err: "cannot decode 2147483648 into int32"},
+		{name: "BIGINT exact", typ: "BIGINT", json: `9007199254740993`, want: int64(9007199254740993)},
+		{name: "BIGINT into uint8 overflow", typ: "BIGINT", json: `256`, want: uint8(0), err: "cannot decode 256 into uint8"},
+		{name: "BIGINT negative into uint", typ: "BIGINT", json: `-1`, want: uint(0), err: "cannot decode -1 into uint"},
+		{name: "BIGINT from fraction", typ: "BIGINT", json: `1.5`, want: int64(0), err: "cannot decode 1.5 into int64"},
+		{name: "DOUBLE", typ: "DOUBLE", json: `2.5e3`, want: float64(2500)},
+		{name: "DOUBLE into float32", typ: "DOUBLE", json: `0.5`, want: float32(0.5)},
+		{name: "DECIMAL into json.Number", typ: "DECIMAL(20, 2)", json: `12345678901234567.89`, want: json.Number("12345678901234567.89")},
+		{name: "DECIMAL into string", typ: "DECIMAL(4, 2)", json: `10.50`, want: "10.50"},
+		{name: "DECIMAL into big.Rat", typ: "DECIMAL(4, 2)", json: `10.50`, want: *big.NewRat(21, 2)},
+		{name: "DECIMAL as string into json.Number", typ: "DECIMAL(4, 2)", json: `"10.50"`, want: json.Number("10.50")},
+		{name: "DECIMAL bad string", typ: "DECIMAL(4, 2)", json: `"ten"`, want: json.Number(""), err: `cannot decode "ten" into json.Number`},
+		{name: "STRING", typ: "STRING", json: `"héllo"`, want: "héllo"},
+		{name: "STRING from object", typ: "STRING", json: `{}`, want: "", err: "cannot decode object into string"},
+		{name: "BYTES", typ: "BYTES", json: `"aGk="`, want: []byte("hi")},
+		{name: "BYTES bad base64", typ: "BYTES", json: `"!"`, want: []byte(nil), err: `cannot decode "!" into []uint8`},
+		{name: "TIMESTAMP string", typ: "TIMESTAMP", json: `"2024-03-01T12:30:45.123"`, want: ts},
+		{name: "TIMESTAMP with zone", typ: "TIMESTAMP", json: `"2024-03-01T13:30:45.123+01:00"`, want: ts.In(time.FixedZone("", 3600))},
+		{name: "TIMESTAMP millis", typ: "TIMESTAMP", json: `1709296245123`, want: ts},
+		{name: "DATE string", typ: "DATE", json: `"2024-03-01"`, want: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "DATE days", typ: "DATE", json: `19783`, want: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "TIME string", typ: "TIME", json: `"12:30:45.123"`, want: time.Date(0, 1, 1, 12, 30, 45, 123000000, time.UTC)},
+		{name: "TIME millis", typ: "TIME", json: `45045123`, want: time.Date(0, 1, 1, 12, 30, 45, 123000000, time.UTC)},
+		{name: "DATE bad string", typ: "DATE", json: `"01/03/2024"`, want: time.Time{}, err: `cannot decode "01/03/2024" into time.Time`},
+		{name: "ARRAY", typ: "ARRAY<INT>", json: `[1, 2, 3]`, want: []int{1, 2, 3}},
+		{name: "ARRAY into array", typ: "ARRAY<INT>", json: `[1, 2]`, want: [3]int{1, 2, 0}},
+		{name: "ARRAY too long", typ: "ARRAY<INT>", json: `[1, 2]`, want: [1]int{}, err: "cannot decode array into [1]int"},
+		{name: "ARRAY element error", typ: "ARRAY<INT>", json: `[1, "x"]`, want: []int(nil), err: "[1]: cannot decode string into int"},
+		{name: "MAP", typ: "MAP<STRING, BIGINT>", json: `{"a": 7, "b": null}`, want: map[string]*int64{"a": &seven, "b": nil}},
+		{name: "MAP value error", typ: "MAP<STRING, BIGINT>", json: `{"a": true}`, want: map[string]int64(nil), err: "a: cannot decode boolean into int64"},
+		{name: "STRUCT", typ: "STRUCT<CITY STRING, ZIP_CODE STRING>", json: `{"CITY": "Tokyo", "ZIP_CODE": "100-0001", "EXTRA": 1}`, want: address{City: "Tokyo", Zip: "100-0001"}},
+		{name: "STRUCT field error", typ: "STRUCT<CITY STRING>", json: `{"CITY": true}`, want: address{}, err: "CITY: cannot decode boolean into string"},
+		{name: "STRUCT into map", typ: "STRUCT<N BIGINT>", json: `{"N": 1}`, want: map[string]interface{}{"N": int64(1)}},
+		{name: "interface BIGINT", typ: "BIGINT", json: `7`, want: interface{}(int64(7))},
+		{name: "interface ARRAY", typ: "ARRAY<DOUBLE>", json: `[1]`, want: interface{}([]interface{}{float64(1)})},
+		{name: "interface TIMESTAMP", typ: "TIMESTAMP", json: `1709296245123`, want: interface{}(ts)},
+		{name: "interface unknown", json: `7`, want: interface{}(json.Number("7"))},
+		{name: "NULL into value", typ: "BIGINT", json: `null`, want: int64(0)},
+		{name: "NULL into pointer", typ: "BIGINT", json: `null`, want: (*int64)(nil)},
+		{name: "pointer", typ: "BIGINT", json: `7`, want: &seven},
+		{name: "unsupported", typ: "BIGINT", json: `7`, want: make(chan int), err: "unsupported type chan int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var typ *Type
+			if tt.typ != "" {
+				var err error
+				if typ, err = ParseType(tt.typ); err != nil {
+					t.Fatalf("ParseType(%q): %v", tt.typ, err)
+				}
+			}
+			dst := reflect.New(reflect.TypeOf(tt.want)).Elem()
+			if strings.HasPrefix(tt.name, "interface") {
+				dst = reflect.New(reflect.TypeOf(&tt.want).Elem()).Elem()
+			}
+			err := assign(dst, decodeJSON(t, tt.json), typ)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("assign error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("assign: %v", err)
+			}
+			got := dst.Interface()
+			if ts, ok := tt.want.(time.Time); ok {
+				if !got.(time.Time).Equal(ts) {
+					t.Errorf("assign = %v, want %v", got, ts)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("assign = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+type Audit struct {
+	CreatedBy string
+	Version   int64 `ksql:"VER"`
+}
+
+type hidden struct {
+	Secret string
+}
+
+type order struct {
+	ID      string `ksql:"ORDER_ID"`
+	Amount  json.Number
+	Skipped string `ksql:"-"`
+	*Audit
+	*hidden
+	Address *address
+}
+
+func TestDecodeRow(t *testing.T) {
+	columns, err := ParseSchema("`ORDER_ID` STRING KEY, `AMOUNT` DECIMAL(10, 2), `SKIPPED` STRING, `CREATED_BY` STRING, `VER` BIGINT, `SECRET` STRING, `ADDRESS` STRUCT<`CITY` STRING>")
+	if err != nil {
+		t.Fatalf("ParseSchema: %v", err)
+	}
+	row := []json.RawMessage{[]byte(`"o-1"`), []byte(`12.30`), []byte(`"x"`), []byte(`"alice"`), []byte(`3`), []byte(`"s"`), []byte(`{"CITY": "Osaka"}`)}
+
+	var got order
+	if err := decodeRow(columns, row, &got); err != nil {
+		t.Fatalf("decodeRow: %v", err)
+	}
+	want := order{
+		ID:      "o-1",
+		Amount:  "12.30",
+		Audit:   &Audit{CreatedBy: "alice", Version: 3},
+		Address: &address{City: "Osaka"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeRow = %+v, want %+v", got, want)
+	}
+
+	// Rows without the promoted columns leave the embedded pointer nil.
+	var short order
+	if err := decodeRow(columns[:2], row[:2], &short); err != nil {
+		t.Fatalf("decodeRow: %v", err)
+	}
+	if short.Audit != nil {
+		t.Errorf("Audit = %+v, want nil", short.Audit)
+	}
+
+	if err := decodeRow(columns[:2], []json.RawMessage{[]byte(`"o-1"`), []byte(`{`)}, &short); err == nil || !strings.Contains(err.Error(), "column AMOUNT") {
+		t.Errorf("decodeRow malformed column error = %v", err)
+	}
+}
+
+func TestStructFields(t *testing.T) {
+	type tagWins struct {
+		CustomerID string
+		Customer   string `ksql:"CUSTOMER_ID"`
+	}
+	type shallowWins struct {
+		Audit
+		Created_By string
+	}
+	type clash struct {
+		CustomerID  string
+		Customer_ID string
+	}
+	type tagClash struct {
+		A string `ksql:"ID"`
+		B string `ksql:"id"`
+	}
+
+	var tw tagWins
+	if err := decodeRow([]Column{{Name: "customer_id"}}, []json.RawMessage{[]byte(`"c-1"`)}, &tw); err != nil {
+		t.Fatalf("decodeRow: %v", err)
+	}
+	if tw != (tagWins{Customer: "c-1"}) {
+		t.Errorf("tagged field: decodeRow = %+v, want Customer set", tw)
+	}
+
+	var sw shallowWins
+	if err := decodeRow([]Column{{Name: "CREATED_BY"}, {Name: "VER"}}, []json.RawMessage{[]byte(`"alice"`), []byte(`3`)}, &sw); err != nil {
+		t.Fatalf("decodeRow: %v", err)
+	}
+	if sw != (shallowWins{Audit: Audit{Version: 3}, Created_By: "alice"}) {
+		t.Errorf("shallow field: decodeRow = %+v, want Created_By set", sw)
+	}
+
+	tests := []struct {
+		name string
+		dst  interface{}
+		want string
+	}{
+		{"untagged", &clash{}, "fields CustomerID and Customer_ID both match column Customer_ID"},
+		{"tagged", &tagClash{}, "fields A and B both match column id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decodeRow([]Column{{Name: "X"}}, []json.RawMessage{[]byte(`1`)}, tt.dst)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("decodeRow error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package ksqldb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ksqlDB error codes. The first three digits are the HTTP status.
+const (
+	ErrorCodeBadRequest      = 40000
+	ErrorCodeBadStatement    = 40001
+	ErrorCodeQueryEndpoint   = 40002
+	ErrorCodeMaxPushQueries  = 40003
+	ErrorCodeUnauthorized    = 40100
+	ErrorCodeForbidden       = 40300
+	ErrorCodeForbiddenKafka  = 40301
+	ErrorCodeNotFound        = 40400
+	ErrorCodeTooManyRequests = 42900
+	ErrorCodeServerError     = 50000
+)
+
+// Error is an error response from ksqlDB, e.g.
+//
+//	{"@type": "statement_error", "error_code": 40001,
+//	 "message": "ORDERS does not exist.", "statementText": "SELECT ...", "entities": []}
+//
+// Use errors.As to get it from errors returned by Client methods.
+type Error struct {
+	// StatusCode is the HTTP status, or 0 if the error arrived in a
+	// streamed response.
+	StatusCode    int                      `json:"-"`
+	Type          string                   `json:"@type"`
+	ErrorCode     int                      `json:"error_code"`
+	Message       string                   `json:"message"`
+	StatementText string                   `json:"statementText,omitempty"`
+	Entities      []map[string]interface{} `json:"entities,omitempty"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if e.StatementText != "" {
+		msg += " (statement: " + e.StatementText + ")"
+	}
+	if e.ErrorCode != 0 {
+		return fmt.Sprintf("ksqldb error %d: %s", e.ErrorCode, msg)
+	}
+	return fmt.Sprintf("ksqldb status %d: %s", e.StatusCode, msg)
+}
+
+// newError parses an error response body. Bodies that are not ksqlDB error
+// JSON, e.g. from a proxy in front of ksqlDB, become the message.
+func newError(statusCode int, body []byte) *Error {
+	e := &Error{StatusCode: statusCode}
+	if err := json.Unmarshal(body, e); err != nil || (e.ErrorCode == 0 && e.Message == "") {
+		e = &Error{StatusCode: statusCode, Message: strings.TrimSpace(string(body))}
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(statusCode)
+	}
+	return e
+}
+
+func asError(err error) (*Error, bool) {
+	var e *Error
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
+// IsNotFound reports whether err says a stream, table, query or other
+// entity does not exist. ksqlDB reports unknown sources in statements as bad
+// statements, so the message is checked too.
+func IsNotFound(err error) bool {
+	e, ok := asError(err)
+	if !ok {
+		return false
+	}
+	if e.ErrorCode == ErrorCodeNotFound || e.StatusCode == http.StatusNotFound {
+		return true
+	}
+	msg := strings.ToLower(e.Message)
+	return e.ErrorCode == ErrorCodeBadStatement &&
+		(strings.Contains(msg, "does not exist") || strings.Contains(msg, "not found"))
+}
+
+// IsSyntaxError reports whether err is a statement ksqlDB could not parse.
+func IsSyntaxError(err error) bool {
+	e, ok := asError(err)
+	if !ok || (e.ErrorCode != ErrorCodeBadStatement && e.ErrorCode != ErrorCodeBadRequest) {
+		return false
+	}
+	msg := strings.ToLower(e.Message)
+	for _, s := range []string{"syntax error", "mismatched input", "extraneous input", "no viable alternative"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRetryable reports whether err is a temporary condition, such as
+// overload, rate limiting or a server that is starting or shutting down,
+// after which the same request may succeed.
+func IsRetryable(err error) bool {
+	e, ok := asError(err)
+	if !ok {
+		return false
+	}
+	switch e.ErrorCode / 100 {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return e.ErrorCode == ErrorCodeMaxPushQueries
+}
@@ -0,0 +1,100 @@
+package ksqldb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestNewError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   Error
+		msg    string
+	}{
+		{
+			name:   "statement error",
+			status: http.StatusBadRequest,
+			body:   `{"@type":"statement_error","error_code":40001,"message":"ORDERS does not exist.","statementText":"SELECT * FROM ORDERS;","entities":[]}`,
+			want:   Error{StatusCode: 400, Type: "statement_error", ErrorCode: 40001, Message: "ORDERS does not exist.", StatementText: "SELECT * FROM ORDERS;", Entities: []map[string]interface{}{}},
+			msg:    "ksqldb error 40001: ORDERS does not exist. (statement: SELECT * FROM ORDERS;)",
+		},
+		{
+			name:   "generic error",
+			status: http.StatusServiceUnavailable,
+			body:   `{"@type":"generic_error","error_code":50300,"message":"Server is not ready"}`,
+			want:   Error{StatusCode: 503, Type: "generic_error", ErrorCode: 50300, Message: "Server is not ready"},
+			msg:    "ksqldb error 50300: Server is not ready",
+		},
+		{
+			name:   "proxy text",
+			status: http.StatusBadGateway,
+			body:   "upstream connect error\n",
+			want:   Error{StatusCode: 502, Message: "upstream connect error"},
+			msg:    "ksqldb status 502: upstream connect error",
+		},
+		{
+			name:   "foreign JSON",
+			status: http.StatusUnauthorized,
+			body:   `{"detail":"expired"}`,
+			want:   Error{StatusCode: 401, Message: `{"detail":"expired"}`},
+			msg:    `ksqldb status 401: {"detail":"expired"}`,
+		},
+		{
+			name:   "empty body",
+			status: http.StatusNotFound,
+			want:   Error{StatusCode: 404, Message: "Not Found"},
+			msg:    "ksqldb status 404: Not Found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newError(tt.status, []byte(tt.body))
+			if fmt.Sprintf("%+v", *got) != fmt.Sprintf("%+v", tt.want) {
+				t.Errorf("newError = %+v, want %+v", *got, tt.want)
+			}
+			if got.Error() != tt.msg {
+				t.Errorf("Error() = %q, want %q", got.Error(), tt.msg)
+			}
+		})
+	}
+}
+
+func TestErrorPredicates(t *testing.T) {
+	wrap := func(e *Error) error { return fmt.Errorf("query failed: %w", e) }
+	tests := []struct {
+		name                        string
+		err                         error
+		notFound, syntax, retryable bool
+	}{
+		{"not found code", wrap(&Error{ErrorCode: ErrorCodeNotFound, Message: "Query not found"}), true, false, false},
+		{"not found status", wrap(&Error{StatusCode: http.StatusNotFound, Message: "Not Found"}), true, false, false},
+		{"unknown source", wrap(&Error{ErrorCode: ErrorCodeBadStatement, Message: "ORDERS does not exist."}), true, false, false},
+		{"syntax error", wrap(&Error{ErrorCode: ErrorCodeBadStatement, Message: "line 1:8: Syntax Error"}), false, true, false},
+		{"mismatched input", wrap(&Error{ErrorCode: ErrorCodeBadRequest, Message: "line 1:1: mismatched input 'SELEC'"}), false, true, false},
+		{"other bad statement", wrap(&Error{ErrorCode: ErrorCodeBadStatement, Message: "Invalid value"}), false, false, false},
+		{"too many requests", wrap(&Error{ErrorCode: ErrorCodeTooManyRequests}), false, false, true},
+		{"unavailable code", wrap(&Error{ErrorCode: 50300}), false, false, true},
+		{"gateway timeout status", wrap(&Error{StatusCode: http.StatusGatewayTimeout}), false, false, true},
+		{"max push queries", wrap(&Error{ErrorCode: ErrorCodeMaxPushQueries}), false, false, true},
+		{"server error", wrap(&Error{ErrorCode: ErrorCodeServerError}), false, false, false},
+		{"not a ksqlDB error", errors.New("does not exist: syntax error"), false, false, false},
+		{"nil", nil, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsNotFound(tt.err); got != tt.notFound {
+				t.Errorf("IsNotFound = %v, want %v", got, tt.notFound)
+			}
+			if got := IsSyntaxError(tt.err); got != tt.syntax {
+				t.Errorf("IsSyntaxError = %v, want %v", got, tt.syntax)
+			}
+			if got := IsRetryable(tt.err); got != tt.retryable {
+				t.Errorf("IsRetryable = %v, want %v", got, tt.retryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+// Package ksqldbtest provides a fake ksqlDB server for tests. It answers
+// queries with scripted results and records the requests it receives.
+package ksqldbtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Result is the scripted answer to a query.
+type Result struct {
+	// Schema is the schema of the /query header, e.g.
+	// "`ID` STRING KEY, `TOTAL` DOUBLE". ColumnNames and ColumnTypes make
+	// up the /query-stream header instead.
+	Schema      string
+	ColumnNames []string
+	ColumnTypes []string
+	Rows        [][]interface{}
+	// Tokens are the continuation tokens of a push query; Tokens[i]
+	// follows Rows[i].
+	Tokens []string
+	// Error, if set, follows the rows as an errorMessage, or as an error
+	// line on /query-stream.
+	Error *Error
+	// FinalMessage, if set, ends the rows, e.g. "Limit Reached". A push
+	// query response ending without one looks like a broken connection.
+	FinalMessage string
+	// Status, if set, fails the request with that status and Error as the
+	// body instead.
+	Status int
+	// Open keeps the response open after the rows until the client goes
+	// away or, for push queries, /close-query or TERMINATE closes it, like
+	// a query still producing rows.
+	Open bool
+}
+
+// Error is a ksqlDB error body.
+type Error struct {
+	Type      string `json:"@type,omitempty"`
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// Request is a request the server received.
+type Request struct {
+	Path string
+	Body map[string]interface{}
+}
+
+// Server is a fake ksqlDB server.
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	nextID     int
+	results    map[string][]Result
+	served     map[string]int
+	requests   []Request
+	running    map[string]*pushQuery
+	persistent map[string]string // statements by query ID
+}
+
+// pushQuery is a push query whose response is still open.
+type pushQuery struct {
+	statement string
+	closed    chan struct{}
+}
+
+// NewServer starts a fake server with no statements scripted.
+func NewServer() *Server {
+	s := &Server{
+		results:    make(map[string][]Result),
+		served:     make(map[string]int),
+		running:    make(map[string]*pushQuery),
+		persistent: make(map[string]string),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Handle scripts the results of a statement. The n-th request for it gets
+// the n-th result and later requests the last one, so reconnects can see
+// different results.
+func (s *Server) Handle(statement string, results ...Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[statement] = results
+	s.served[statement] = 0
+}
+
+// AddQuery adds a persistent query, such as the one behind a CREATE TABLE
+// AS SELECT, for SHOW QUERIES and TERMINATE.
+func (s *Server) AddQuery(id, statement string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.persistent[id] = statement
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// result returns the next result of statement and a new query ID.
+func (s *Server) result(statement string) (Result, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := s.results[statement]
+	if len(results) == 0 {
+		return Result{}, "", false
+	}
+	n := min(s.served[statement], len(results)-1)
+	s.served[statement]++
+	s.nextID++
+	return results[n], fmt.Sprintf("query_%d", s.nextID), true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, Error{Type: "generic_error", ErrorCode: 40000, Message: fmt.Sprintf("invalid JSON: %v", err)})
+		return
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Path: r.URL.Path, Body: body})
+	s.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/query":
+		statement, _ := body["ksql"].(string)
+		s.query(w, r, statement)
+	case "/query-stream":
+		statement, _ := body["sql"].(string)
+		s.queryStream(w, r, statement)
+	case "/close-query":
+		id, _ := body["queryId"].(string)
+		if !s.closeQuery(id) {
+			writeJSON(w, http.StatusBadRequest, Error{Type: "generic_error", ErrorCode: 40000, Message: fmt.Sprintf("No query with id %s", id)})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case "/ksql":
+		statement, _ := body["ksql"].(string)
+		s.statement(w, statement)
+	default:
+		writeJSON(w, http.StatusNotFound, Error{Type: "generic_error", ErrorCode: 40400, Message: "HTTP 404 Not Found"})
+	}
+}
+
+// query answers a pull query on /query with a JSON array streamed item by
+// item.
+func (s *Server) query(w http.ResponseWriter, r *http.Request, statement string) {
+	result, id, ok := s.result(statement)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, Error{Type: "statement_error", ErrorCode: 40001, Message: fmt.Sprintf("unexpected statement %q", statement)})
+		return
+	}
+	if result.Status != 0 {
+		writeJSON(w, result.Status, result.Error)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	flusher, _ := w.(http.Flusher)
+	sep := "["
+	write := func(item interface{}) {
+		data, _ := json.Marshal(item)
+		fmt.Fprintf(w, "%s%s", sep, data)
+		sep = ",\n"
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	write(map[string]interface{}{"header": map[string]string{"queryId": id, "schema": result.Schema}})
+	for _, row := range result.Rows {
+		write(map[string]interface{}{"row": map[string]interface{}{"columns": row}})
+	}
+	if result.Error != nil {
+		write(map[string]interface{}{"errorMessage": result.Error})
+	}
+	if result.FinalMessage != "" {
+		write(map[string]interface{}{"finalMessage": result.FinalMessage})
+	}
+	if result.Open {
+		<-r.Context().Done()
+		return
+	}
+	fmt.Fprint(w, "]")
+}
+
+// queryStream answers a push query on /query-stream in the delimited
+// format: a header line, then a line per row, token, error or final
+// message.
+func (s *Server) queryStream(w http.ResponseWriter, r *http.Request, statement string) {
+	result, id, ok := s.result(statement)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, Error{Type: "statement_error", ErrorCode: 40001, Message: fmt.Sprintf("unexpected statement %q", statement)})
+		return
+	}
+	if result.Status != 0 {
+		writeJSON(w, result.Status, result.Error)
+		return
+	}
+	closed := make(chan struct{})
+	s.mu.Lock()
+	s.running[id] = &pushQuery{statement: statement, closed: closed}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, id)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/vnd.ksqlapi.delimited.v1")
+	flusher, _ := w.(http.Flusher)
+	write := func(line interface{}) {
+		data, _ := json.Marshal(line)
+		fmt.Fprintf(w, "%s\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	write(map[string]interface{}{"queryId": id, "columnNames": result.ColumnNames, "columnTypes": result.ColumnTypes})
+	for i, row := range result.Rows {
+		write(row)
+		if i < len(result.Tokens) {
+			write(map[string]string{"continuationToken": result.Tokens[i]})
+		}
+	}
+	if result.Error != nil {
+		write(result.Error)
+	}
+	if result.FinalMessage != "" {
+		write(map[string]string{"finalMessage": result.FinalMessage})
+	}
+	if result.Open {
+		select {
+		case <-r.Context().Done():
+		case <-closed:
+		}
+	}
+}
+
+// closeQuery ends the response of a running push query.
+func (s *Server) closeQuery(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.running[id]
+	if ok {
+		delete(s.running, id)
+		close(q.closed)
+	}
+	return ok
+}
+
+// statement answers the SHOW QUERIES and TERMINATE statements on /ksql.
+func (s *Server) statement(w http.ResponseWriter, statement string) {
+	if statement == "SHOW QUERIES;" {
+		s.mu.Lock()
+		queries := []map[string]interface{}{}
+		for id, q := range s.persistent {
+			queries = append(queries, map[string]interface{}{"id": id, "queryType": "PERSISTENT", "queryString": q, "state": "RUNNING"})
+		}
+		for id, q := range s.running {
+			queries = append(queries, map[string]interface{}{"id": id, "queryType": "PUSH", "queryString": q.statement, "state": "RUNNING"})
+		}
+		s.mu.Unlock()
+		sort.Slice(queries, func(i, j int) bool {
+			return queries[i]["id"].(string) < queries[j]["id"].(string)
+		})
+		writeJSON(w, http.StatusOK, []map[string]interface{}{{"@type": "queries", "statementText": statement, "queries": queries}})
+		return
+	}
+	if id, ok := strings.CutPrefix(statement, "TERMINATE "); ok {
+		id = strings.TrimSuffix(id, ";")
+		s.mu.Lock()
+		_, persistent := s.persistent[id]
+		delete(s.persistent, id)
+		s.mu.Unlock()
+		if persistent || s.closeQuery(id) {
+			writeJSON(w, http.StatusOK, []map[string]interface{}{{"@type": "currentStatus", "statementText": statement, "commandStatus": map[string]string{"status": "SUCCESS", "message": "Query terminated."}}})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, Error{Type: "statement_error", ErrorCode: 40001, Message: fmt.Sprintf("Unknown queryId: %s", id)})
+		return
+	}
+	writeJSON(w, http.StatusBadRequest, Error{Type: "statement_error", ErrorCode: 40001, Message: fmt.Sprintf("unexpected statement %q", statement)})
+}
@@ -0,0 +1,218 @@
+package ksqldb
+
+import (
+	"context"
+	"crypto/tls"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// DefaultTimeout bounds pull queries, statements and other requests that
+// are expected to complete. Push queries are only bounded by their context.
+const DefaultTimeout = 30 * time.Second
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithTimeout sets the timeout of requests other than push queries
+// (0 disables it). Deadlines on the context passed to a method also apply.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithHTTPClient uses hc for all requests. Its Timeout should be zero, or
+// it also cuts off push queries.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithTransport sends requests through rt, e.g. for instrumentation.
+// It takes precedence over WithTLSConfig and WithHTTP2.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = rt
+	}
+}
+
+// WithTLSConfig sets the TLS configuration for https:// servers, e.g. a
+// private CA or client certificates for mTLS.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithHTTP2 speaks HTTP/2 to the server: negotiated via ALPN for https://,
+// and with prior knowledge (h2c) for http://, which ksqlDB's /query-stream
+// endpoint supports.
+func WithHTTP2() Option {
+	return func(c *Client) {
+		c.http2 = true
+	}
+}
+
+// WithBasicAuth authenticates with a username and password, e.g. a
+// Confluent Cloud API key and secret.
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) {
+		c.username, c.password = username, password
+		c.token = ""
+		c.header.Del("Authorization")
+	}
+}
+
+// WithBearerToken sends "Authorization: Bearer <token>".
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+		c.username, c.password = "", ""
+		c.header.Del("Authorization")
+	}
+}
+
+// WithHeader sets a header on every request, replacing an earlier value.
+// An Authorization header replaces earlier auth options.
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Set(key, value)
+	}
+}
+
+// QueryOption configures a single query.
+type QueryOption func(*queryOptions)
+
+type queryOptions struct {
+	limit             int
+	properties        map[string]interface{}
+	reconnect         bool
+	backoff           Backoff
+	continuation      bool
+	continuationToken string
+}
+
+func newQueryOptions(opts []QueryOption) queryOptions {
+	var o queryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithLimit stops reading a query after n rows and ends it (0 means no
+// limit). Unlike a LIMIT clause, it needs no change to the statement.
+func WithLimit(n int) QueryOption {
+	return func(o *queryOptions) {
+		o.limit = n
+	}
+}
+
+// Values of the auto.offset.reset property.
+const (
+	OffsetResetEarliest = "earliest"
+	OffsetResetLatest   = "latest"
+)
+
+// WithProperty sets a streams property of the query, such as
+// "ksql.streams.num.stream.threads".
+func WithProperty(key string, value interface{}) QueryOption {
+	return func(o *queryOptions) {
+		if o.properties == nil {
+			o.properties = make(map[string]interface{})
+		}
+		o.properties[key] = value
+	}
+}
+
+// WithOffsetReset sets where a push query starts reading when it has no
+// position to resume from: OffsetResetEarliest or OffsetResetLatest. The
+// default is earliest, or latest with WithContinuation, which does not
+// support earliest.
+func WithOffsetReset(reset string) QueryOption {
+	return WithProperty("auto.offset.reset", reset)
+}
+
+// Backoff is the reconnect policy of push queries. The delay before the
+// n-th consecutive attempt is Initial doubled n-1 times, capped at Max,
+// with up to half of it taken off at random so clients don't reconnect in
+// lockstep.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	// MaxAttempts is the number of consecutive failed attempts after which
+	// the query gives up (0 means never).
+	MaxAttempts int
+}
+
+// DefaultBackoff is the reconnect policy of WithReconnect with a zero
+// Backoff.
+var DefaultBackoff = Backoff{Initial: 500 * time.Millisecond, Max: 30 * time.Second}
+
+func (b Backoff) delay(attempt int) time.Duration {
+	d := b.Initial
+	for i := 1; i < attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d - rand.N(d/2+1)
+}
+
+// WithReconnect makes a push query reconnect after network errors and
+// transient ksqlDB errors (see IsRetryable) instead of ending. A zero
+// Backoff means DefaultBackoff.
+func WithReconnect(b Backoff) QueryOption {
+	return func(o *queryOptions) {
+		if b == (Backoff{}) {
+			b = DefaultBackoff
+		}
+		o.reconnect, o.backoff = true, b
+	}
+}
+
+// WithContinuation runs the push query as a scalable push query with
+// continuation tokens, which requires ksql.query.push.v2.enabled and
+// ksql.query.push.v2.registry.installed on the server. On reconnect the
+// query resumes after the last delivered row. A non-empty token, from
+// PushQuerySubscription.ContinuationToken of an earlier run, resumes
+// from there instead of the offset reset policy, which must be latest.
+func WithContinuation(token string) QueryOption {
+	return func(o *queryOptions) {
+		o.continuation, o.continuationToken = true, token
+	}
+}
+
+// newTransport returns the transport for the TLS and HTTP/2 options, or nil
+// to keep the HTTP client's own.
+func (c *Client) newTransport(scheme string) http.RoundTripper {
+	if c.transport != nil {
+		return c.transport
+	}
+	if c.http2 && scheme == "http" {
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	if c.tlsConfig == nil && !c.http2 {
+		return nil
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = c.tlsConfig
+	t.ForceAttemptHTTP2 = true
+	return t
+}
@@ -0,0 +1,130 @@
+package ksqldb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// requestInfo is what the echo server saw of a request.
+type requestInfo struct {
+	proto         int
+	authorization string
+	headers       http.Header
+}
+
+// newEchoServer answers /info with {} and records each request.
+func newEchoServer(t *testing.T, requests chan<- requestInfo) http.Handler {
+	t.Helper()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- requestInfo{proto: r.ProtoMajor, authorization: r.Header.Get("Authorization"), headers: r.Header.Clone()}
+		w.Write([]byte("{}"))
+	})
+}
+
+func TestAuthOptions(t *testing.T) {
+	requests := make(chan requestInfo, 1)
+	ts := httptest.NewServer(newEchoServer(t, requests))
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"none", nil, ""},
+		{"basic", []Option{WithBasicAuth("key", "secret")}, "Basic a2V5OnNlY3JldA=="},
+		{"bearer", []Option{WithBearerToken("tok")}, "Bearer tok"},
+		{"bearer replaces basic", []Option{WithBasicAuth("key", "secret"), WithBearerToken("tok")}, "Bearer tok"},
+		{"basic replaces bearer", []Option{WithBearerToken("tok"), WithBasicAuth("key", "secret")}, "Basic a2V5OnNlY3JldA=="},
+		{"header replaces basic", []Option{WithBasicAuth("key", "secret"), WithHeader("Authorization", "Custom x")}, "Custom x"},
+		{"header replaces bearer", []Option{WithBearerToken("tok"), WithHeader("authorization", "Custom x")}, "Custom x"},
+		{"basic replaces header", []Option{WithHeader("Authorization", "Custom x"), WithBasicAuth("key", "secret")}, "Basic a2V5OnNlY3JldA=="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append(tt.opts, WithHeader("X-Tenant", "a"), WithHeader("X-Tenant", "b"))
+			if _, err := NewClient(ts.URL, opts...).GetServerInfo(); err != nil {
+				t.Fatalf("GetServerInfo: %v", err)
+			}
+			got := <-requests
+			if got.authorization != tt.want {
+				t.Errorf("Authorization = %q, want %q", got.authorization, tt.want)
+			}
+			if tenant := got.headers.Values("X-Tenant"); len(tenant) != 1 || tenant[0] != "b" {
+				t.Errorf("X-Tenant = %v, want [b]", tenant)
+			}
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	start := time.Now()
+	err := NewClient(ts.URL, WithTimeout(50*time.Millisecond)).ExecuteStatement("SHOW STREAMS;")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ExecuteStatement = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timeout took %v", elapsed)
+	}
+
+	// A shorter context deadline applies as well.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := NewClient(ts.URL, WithTimeout(time.Hour)).ExecuteStatementContext(ctx, "SHOW STREAMS;"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ExecuteStatementContext = %v, want deadline exceeded", err)
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	requests := make(chan requestInfo, 1)
+
+	h2cServer := httptest.NewServer(h2c.NewHandler(newEchoServer(t, requests), &http2.Server{}))
+	defer h2cServer.Close()
+
+	tlsServer := httptest.NewUnstartedServer(newEchoServer(t, requests))
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	tlsConfig := tlsServer.Client().Transport.(*http.Transport).TLSClientConfig
+
+	tests := []struct {
+		name  string
+		url   string
+		opts  []Option
+		proto int
+	}{
+		{"plaintext", h2cServer.URL, nil, 1},
+		{"h2c", h2cServer.URL, []Option{WithHTTP2()}, 2},
+		{"TLS", tlsServer.URL, []Option{WithTLSConfig(tlsConfig)}, 2},
+		{"TLS with HTTP/2", tlsServer.URL, []Option{WithTLSConfig(tlsConfig), WithHTTP2()}, 2},
+		{"custom transport", h2cServer.URL, []Option{WithHTTP2(), WithTransport(http.DefaultTransport)}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClient(tt.url, tt.opts...).GetServerInfo(); err != nil {
+				t.Fatalf("GetServerInfo: %v", err)
+			}
+			if got := <-requests; got.proto != tt.proto {
+				t.Errorf("HTTP/%d, want HTTP/%d", got.proto, tt.proto)
+			}
+		})
+	}
+}
@@ -0,0 +1,431 @@
+package ksqldb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Streams and request properties of scalable push queries.
+const (
+	propertyPushV2Enabled       = "ksql.query.push.v2.enabled"
+	propertyContinuationEnabled = "ksql.query.push.v2.continuation.tokens.enabled"
+	requestContinuationToken    = "request.ksql.query.push.continuation.token"
+)
+
+// pushQueryRequest is the body of a /query-stream request.
+type pushQueryRequest struct {
+	SQL               string                 `json:"sql"`
+	Properties        map[string]interface{} `json:"properties,omitempty"`
+	RequestProperties map[string]interface{} `json:"requestProperties,omitempty"`
+}
+
+// pushMessage is an object line of a /query-stream response: the header,
+// a continuation token, the final message, or an error in place of any.
+type pushMessage struct {
+	QueryID           string   `json:"queryId"`
+	ColumnNames       []string `json:"columnNames"`
+	ColumnTypes       []string `json:"columnTypes"`
+	ContinuationToken string   `json:"continuationToken"`
+	FinalMessage      string   `json:"finalMessage"`
+	Error
+}
+
+// columns returns the columns described by the header. Key columns are not
+// marked, as /query-stream does not report them.
+func (m *pushMessage) columns() ([]Column, error) {
+	if len(m.ColumnTypes) != len(m.ColumnNames) {
+		return nil, fmt.Errorf("%d column names but %d types", len(m.ColumnNames), len(m.ColumnTypes))
+	}
+	columns := make([]Column, len(m.ColumnNames))
+	for i, name := range m.ColumnNames {
+		t, err := ParseType(m.ColumnTypes[i])
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", name, err)
+		}
+		columns[i] = Column{Name: name, Type: t}
+	}
+	return columns, nil
+}
+
+// PushQuerySubscription is a running push query. With WithReconnect it
+// survives broken connections by reconnecting with backoff and, with
+// WithContinuation, resumes after the last row it delivered.
+type PushQuerySubscription struct {
+	c      *Client
+	ctx    context.Context
+	query  string
+	opts   queryOptions
+	closed chan struct{}
+
+	// reader, count and final are only used by the goroutine iterating
+	// Rows. final is set once ksqlDB has sent its final message.
+	reader *bufio.Reader
+	count  int
+	final  bool
+
+	// mu guards the fields below, which Close and the accessors may use
+	// while another goroutine iterates Rows.
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	body    io.ReadCloser
+	queryID string
+	columns []Column
+	token   string
+	done    bool
+}
+
+// errClosed ends a reconnect interrupted by Close.
+var errClosed = errors.New("push query closed")
+
+// Subscribe starts a push query and returns once ksqlDB has accepted it.
+// Rows are then read by iterating Rows until ctx is done, the query ends,
+// or the connection breaks and reconnecting is disabled or gives up.
+//
+// The query reads from the earliest offset unless WithOffsetReset says
+// otherwise; with WithContinuation it reads from the latest, as scalable
+// push queries do not support earliest. Without continuation tokens, a
+// reconnected query starts over according to that policy, so rows may be
+// delivered again (earliest) or missed (latest).
+func (c *Client) Subscribe(ctx context.Context, query string, opts ...QueryOption) (*PushQuerySubscription, error) {
+	s := &PushQuerySubscription{
+		c:      c,
+		ctx:    ctx,
+		query:  query,
+		opts:   newQueryOptions(opts),
+		closed: make(chan struct{}),
+	}
+	if s.opts.continuation && s.opts.properties["auto.offset.reset"] == OffsetResetEarliest {
+		return nil, errors.New("continuation tokens need offset reset latest, not earliest")
+	}
+	s.token = s.opts.continuationToken
+	if err := s.connect(); err != nil {
+		if err := s.reconnect(err); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// connect sends the query, resuming from the continuation token if there
+// is one, and reads the header.
+func (s *PushQuerySubscription) connect() error {
+	reset := OffsetResetEarliest
+	if s.opts.continuation {
+		reset = OffsetResetLatest
+	}
+	properties := map[string]interface{}{"auto.offset.reset": reset}
+	for k, v := range s.opts.properties {
+		properties[k] = v
+	}
+	req := pushQueryRequest{SQL: s.query, Properties: properties}
+	if s.opts.continuation {
+		properties[propertyPushV2Enabled] = true
+		properties[propertyContinuationEnabled] = true
+		if s.token != "" {
+			req.RequestProperties = map[string]interface{}{requestContinuationToken: s.token}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	resp, err := s.c.post(ctx, "/query-stream", req, "application/vnd.ksqlapi.delimited.v1")
+	if err != nil {
+		cancel()
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		cancel()
+		return fmt.Errorf("query failed: %w", newError(resp.StatusCode, body))
+	}
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		cancel()
+		resp.Body.Close()
+		return errClosed
+	}
+	s.cancel, s.body = cancel, resp.Body
+	s.mu.Unlock()
+	s.reader = bufio.NewReader(resp.Body)
+
+	line, err := s.readLine()
+	if err == nil && !strings.HasPrefix(line, "{") {
+		err = fmt.Errorf("expected header, got %.40q", line)
+	}
+	if err != nil {
+		s.closeConn()
+		return s.readError(err)
+	}
+	var header pushMessage
+	if err := json.Unmarshal([]byte(line), &header); err != nil {
+		s.closeConn()
+		return fmt.Errorf("failed to parse header: %w", err)
+	}
+	if strings.HasSuffix(header.Type, "error") {
+		s.closeConn()
+		return fmt.Errorf("query failed: %w", &header.Error)
+	}
+	columns, err := header.columns()
+	if err != nil {
+		s.closeConn()
+		return fmt.Errorf("failed to parse header: %w", err)
+	}
+	s.mu.Lock()
+	s.queryID, s.columns = header.QueryID, columns
+	s.mu.Unlock()
+	return nil
+}
+
+// readLine returns the next non-empty line of the response.
+func (s *PushQuerySubscription) readLine() (string, error) {
+	for {
+		line, err := s.reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line != "" {
+			// A last line without newline is complete if it parses.
+			if err == nil || json.Valid([]byte(line)) {
+				return line, nil
+			}
+			if errors.Is(err, io.EOF) {
+				return "", io.ErrUnexpectedEOF
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func (s *PushQuerySubscription) readError(err error) error {
+	if ctxErr := s.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("read error: %w", err)
+}
+
+// closeConn drops the current connection, if any.
+func (s *PushQuerySubscription) closeConn() {
+	s.mu.Lock()
+	cancel, body := s.cancel, s.body
+	s.cancel, s.body = nil, nil
+	s.mu.Unlock()
+	if body != nil {
+		cancel()
+		body.Close()
+	}
+}
+
+func (s *PushQuerySubscription) isDone() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// end marks a query that ksqlDB or an error has already ended as done,
+// without closing it on the server.
+func (s *PushQuerySubscription) end() {
+	s.mu.Lock()
+	done := s.done
+	s.done = true
+	s.mu.Unlock()
+	if !done {
+		close(s.closed)
+	}
+	s.closeConn()
+}
+
+// reconnect connects again after err broke the previous connection, with
+// backoff between attempts. It returns err, or the last error, if
+// reconnecting is disabled, the error is not transient, ctx is done or the
+// attempts are used up.
+func (s *PushQuerySubscription) reconnect(err error) error {
+	s.closeConn()
+	for attempt := 1; ; attempt++ {
+		if !s.opts.reconnect || !retryable(err) {
+			return err
+		}
+		if max := s.opts.backoff.MaxAttempts; max > 0 && attempt > max {
+			return fmt.Errorf("push query failed after %d reconnect attempts: %w", max, err)
+		}
+		timer := time.NewTimer(s.opts.backoff.delay(attempt))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return s.ctx.Err()
+		case <-s.closed:
+			timer.Stop()
+			return errClosed
+		case <-timer.C:
+		}
+		if err = s.connect(); err == nil {
+			return nil
+		}
+	}
+}
+
+// retryable reports whether a push query that failed with err may succeed
+// when sent again: after network errors and transient ksqlDB errors.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if _, ok := asError(err); ok {
+		return IsRetryable(err)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// next returns the next row, or false when the query or the limit ends.
+func (s *PushQuerySubscription) next() (Row, bool, error) {
+	for {
+		if s.isDone() {
+			return Row{}, false, nil
+		}
+		if s.opts.limit > 0 && s.count >= s.opts.limit {
+			return Row{}, false, s.Close()
+		}
+		line, err := s.readLine()
+		switch {
+		case s.isDone():
+			// Closed while reading.
+			return Row{}, false, nil
+		case s.ctx.Err() != nil:
+			s.Close()
+			return Row{}, false, s.ctx.Err()
+		case errors.Is(err, io.EOF) && s.final:
+			// The query ended, e.g. after its LIMIT.
+			s.end()
+			return Row{}, false, nil
+		case err != nil:
+			if err := s.reconnect(s.readError(err)); err != nil {
+				return Row{}, false, s.fail(err)
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "{"):
+			var msg pushMessage
+			if err := json.Unmarshal([]byte(line), &msg); err != nil {
+				continue
+			}
+			if strings.HasSuffix(msg.Type, "error") {
+				if err := s.reconnect(fmt.Errorf("query failed: %w", &msg.Error)); err != nil {
+					return Row{}, false, s.fail(err)
+				}
+				continue
+			}
+			if msg.FinalMessage != "" {
+				s.final = true
+			}
+			if msg.ContinuationToken != "" {
+				s.mu.Lock()
+				s.token = msg.ContinuationToken
+				s.mu.Unlock()
+			}
+		case strings.HasPrefix(line, "["):
+			var values []json.RawMessage
+			if err := json.Unmarshal([]byte(line), &values); err != nil {
+				continue
+			}
+			s.count++
+			return Row{Columns: s.Columns(), Values: values}, true, nil
+		}
+	}
+}
+
+// fail ends the query after reconnecting failed with err, which is
+// returned unless Close interrupted the reconnect.
+func (s *PushQuerySubscription) fail(err error) error {
+	s.end()
+	if errors.Is(err, errClosed) {
+		return nil
+	}
+	return err
+}
+
+// Rows returns an iterator over the rows of the query. An error ending the
+// query is yielded last. A response that ends without ksqlDB's final
+// message counts as a broken connection, so WithReconnect reconnects. The
+// subscription is closed when the iteration ends, including when the loop
+// breaks early.
+func (s *PushQuerySubscription) Rows() iter.Seq2[Row, error] {
+	return func(yield func(Row, error) bool) {
+		defer s.Close()
+		for {
+			row, ok, err := s.next()
+			if err != nil {
+				yield(Row{}, err)
+				return
+			}
+			if !ok || !yield(row, nil) {
+				return
+			}
+		}
+	}
+}
+
+// ID returns the ID ksqlDB assigned to the query, e.g. for ListQueries.
+// A reconnected query gets a new ID.
+func (s *PushQuerySubscription) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queryID
+}
+
+// Columns returns the columns of the rows.
+func (s *PushQuerySubscription) Columns() []Column {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.columns
+}
+
+// ContinuationToken returns the latest continuation token of a scalable
+// push query started with WithContinuation. It encodes the per-partition
+// offsets of the rows delivered so far; pass it to WithContinuation to
+// resume a later subscription from there. The token for a row arrives
+// after it, so a resumed query may deliver the last row again.
+func (s *PushQuerySubscription) ContinuationToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+// Close stops the query on the server with /close-query and drops the
+// connection, ending an iteration of Rows in another goroutine. Breaking
+// out of Rows and cancelling the context passed to Subscribe close the
+// query too. It is safe to call more than once.
+func (s *PushQuerySubscription) Close() error {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return nil
+	}
+	s.done = true
+	id, open := s.queryID, s.body != nil
+	s.mu.Unlock()
+	close(s.closed)
+
+	var err error
+	if open {
+		// Close after cancellation too, so the server frees the query.
+		err = s.c.CloseQuery(context.WithoutCancel(s.ctx), id)
+	}
+	s.closeConn()
+	return err
+}
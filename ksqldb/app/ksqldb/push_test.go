@@ -0,0 +1,265 @@
+package ksqldb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/ksqldb-demo/ksqldb/ksqldbtest"
+)
+
+const ordersQuery = "SELECT * FROM HIGH_VALUE_ORDERS EMIT CHANGES;"
+
+// fastReconnect reconnects without waiting, up to three times in a row.
+var fastReconnect = WithReconnect(Backoff{Initial: time.Millisecond, Max: time.Millisecond, MaxAttempts: 3})
+
+// pushResult returns a push query result with an ORDER_ID column.
+func pushResult(ids ...string) ksqldbtest.Result {
+	r := ksqldbtest.Result{ColumnNames: []string{"ORDER_ID"}, ColumnTypes: []string{"STRING"}}
+	for _, id := range ids {
+		r.Rows = append(r.Rows, []interface{}{id})
+	}
+	return r
+}
+
+func final(r ksqldbtest.Result) ksqldbtest.Result {
+	r.FinalMessage = "Limit Reached"
+	return r
+}
+
+func open(r ksqldbtest.Result) ksqldbtest.Result {
+	r.Open = true
+	return r
+}
+
+// collectPush iterates the rows of s, returning the ORDER_ID of each and
+// the error that ended the iteration.
+func collectPush(t *testing.T, s *PushQuerySubscription) ([]string, error) {
+	t.Helper()
+	var ids []string
+	for row, err := range s.Rows() {
+		if err != nil {
+			return ids, err
+		}
+		var v struct{ OrderID string }
+		if err := row.Decode(&v); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		ids = append(ids, v.OrderID)
+	}
+	return ids, nil
+}
+
+// pushRequests returns the bodies of the /query-stream requests of ts.
+func pushRequests(ts *ksqldbtest.Server) []map[string]interface{} {
+	var bodies []map[string]interface{}
+	for _, r := range ts.Requests() {
+		if r.Path == "/query-stream" {
+			bodies = append(bodies, r.Body)
+		}
+	}
+	return bodies
+}
+
+func TestSubscribeOffsetReset(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []QueryOption
+		want string
+		err  string
+	}{
+		{"default", nil, OffsetResetEarliest, ""},
+		{"latest", []QueryOption{WithOffsetReset(OffsetResetLatest)}, OffsetResetLatest, ""},
+		{"continuation", []QueryOption{WithContinuation("")}, OffsetResetLatest, ""},
+		{"continuation with latest", []QueryOption{WithContinuation(""), WithOffsetReset(OffsetResetLatest)}, OffsetResetLatest, ""},
+		{"continuation with earliest", []QueryOption{WithContinuation(""), WithOffsetReset(OffsetResetEarliest)}, "", "continuation tokens need offset reset latest"},
+		{"continuation with earliest property", []QueryOption{WithProperty("auto.offset.reset", "earliest"), WithContinuation("")}, "", "continuation tokens need offset reset latest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := ksqldbtest.NewServer()
+			defer ts.Close()
+			ts.Handle(ordersQuery, final(pushResult()))
+
+			s, err := NewClient(ts.URL).Subscribe(context.Background(), ordersQuery, tt.opts...)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Subscribe error = %v, want %q", err, tt.err)
+				}
+				if n := len(pushRequests(ts)); n != 0 {
+					t.Errorf("sent %d requests, want none", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Subscribe: %v", err)
+			}
+			defer s.Close()
+			props := pushRequests(ts)[0]["properties"].(map[string]interface{})
+			if got := props["auto.offset.reset"]; got != tt.want {
+				t.Errorf("auto.offset.reset = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	retryable := &ksqldbtest.Error{Type: "generic_error", ErrorCode: 50300, Message: "Server is not ready"}
+	broken := func(r ksqldbtest.Result) ksqldbtest.Result {
+		r.Error = retryable
+		return r
+	}
+	tests := []struct {
+		name     string
+		results  []ksqldbtest.Result
+		opts     []QueryOption
+		want     string // ORDER_IDs, joined by commas
+		requests int
+		err      string
+	}{
+		{
+			name:     "final message ends the query",
+			results:  []ksqldbtest.Result{final(pushResult("o1", "o2"))},
+			opts:     []QueryOption{fastReconnect},
+			want:     "o1,o2",
+			requests: 1,
+		},
+		{
+			name:     "EOF without final message reconnects",
+			results:  []ksqldbtest.Result{pushResult("o1"), final(pushResult("o2"))},
+			opts:     []QueryOption{fastReconnect},
+			want:     "o1,o2",
+			requests: 2,
+		},
+		{
+			name:     "EOF without reconnect",
+			results:  []ksqldbtest.Result{pushResult("o1"), final(pushResult("o2"))},
+			want:     "o1",
+			requests: 1,
+			err:      "read error: unexpected EOF",
+		},
+		{
+			name:     "retryable error reconnects",
+			results:  []ksqldbtest.Result{broken(pushResult("o1")), final(pushResult("o2"))},
+			opts:     []QueryOption{fastReconnect},
+			want:     "o1,o2",
+			requests: 2,
+		},
+		{
+			name:     "unavailable at start",
+			results:  []ksqldbtest.Result{{Status: 503, Error: retryable}, final(pushResult("o1"))},
+			opts:     []QueryOption{fastReconnect},
+			want:     "o1",
+			requests: 2,
+		},
+		{
+			name:     "non-retryable error",
+			results:  []ksqldbtest.Result{pushResult("o1"), {Status: 400, Error: &ksqldbtest.Error{Type: "statement_error", ErrorCode: ErrorCodeBadStatement, Message: "HIGH_VALUE_ORDERS does not exist."}}},
+			opts:     []QueryOption{fastReconnect},
+			want:     "o1",
+			requests: 2,
+			err:      "HIGH_VALUE_ORDERS does not exist.",
+		},
+		{
+			name:     "attempts used up",
+			results:  []ksqldbtest.Result{pushResult("o1"), {Status: 503, Error: retryable}},
+			opts:     []QueryOption{fastReconnect},
+			want:     "o1",
+			requests: 4,
+			err:      "push query failed after 3 reconnect attempts",
+		},
+		{
+			name:     "limit",
+			results:  []ksqldbtest.Result{pushResult("o1"), open(pushResult("o2", "o3"))},
+			opts:     []QueryOption{fastReconnect, WithLimit(2)},
+			want:     "o1,o2",
+			requests: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := ksqldbtest.NewServer()
+			defer ts.Close()
+			ts.Handle(ordersQuery, tt.results...)
+
+			s, err := NewClient(ts.URL).Subscribe(context.Background(), ordersQuery, tt.opts...)
+			if err != nil {
+				t.Fatalf("Subscribe: %v", err)
+			}
+			ids, err := collectPush(t, s)
+			if got := strings.Join(ids, ","); got != tt.want {
+				t.Errorf("rows = %s, want %s", got, tt.want)
+			}
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+			if n := len(pushRequests(ts)); n != tt.requests {
+				t.Errorf("sent %d queries, want %d", n, tt.requests)
+			}
+		})
+	}
+}
+
+func TestSubscribeContinuation(t *testing.T) {
+	ts := ksqldbtest.NewServer()
+	defer ts.Close()
+	first := pushResult("o1", "o2")
+	first.Tokens = []string{"t1", "t2"}
+	second := final(pushResult("o3"))
+	second.Tokens = []string{"t3"}
+	ts.Handle(ordersQuery, first, second)
+
+	s, err := NewClient(ts.URL).Subscribe(context.Background(), ordersQuery, fastReconnect, WithContinuation("t0"))
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	ids, err := collectPush(t, s)
+	if got := strings.Join(ids, ","); got != "o1,o2,o3" || err != nil {
+		t.Fatalf("rows = %s, error %v, want o1,o2,o3", got, err)
+	}
+	if got := s.ContinuationToken(); got != "t3" {
+		t.Errorf("ContinuationToken = %q, want t3", got)
+	}
+
+	// The first request resumes from the given token, the reconnect from
+	// the last one received.
+	requests := pushRequests(ts)
+	if len(requests) != 2 {
+		t.Fatalf("sent %d queries, want 2", len(requests))
+	}
+	for i, want := range []string{"t0", "t2"} {
+		props := requests[i]["properties"].(map[string]interface{})
+		if props[propertyPushV2Enabled] != true || props[propertyContinuationEnabled] != true {
+			t.Errorf("request %d properties = %v, want scalable push query with tokens", i, props)
+		}
+		reqProps, _ := requests[i]["requestProperties"].(map[string]interface{})
+		if got := reqProps[requestContinuationToken]; got != want {
+			t.Errorf("request %d token = %v, want %s", i, got, want)
+		}
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := b.delay(tt.attempt); d < tt.max/2 || d > tt.max {
+				t.Errorf("delay(%d) = %v, want between %v and %v", tt.attempt, d, tt.max/2, tt.max)
+			}
+		}
+	}
+	if d := (Backoff{}).delay(1); d != 0 {
+		t.Errorf("zero Backoff delay = %v, want 0", d)
+	}
+}
@@ -0,0 +1,75 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+)
+
+// Query types reported by ListQueries.
+const (
+	QueryTypePersistent = "PERSISTENT"
+	QueryTypePush       = "PUSH"
+)
+
+// QueryInfo is a running query as listed by SHOW QUERIES.
+type QueryInfo struct {
+	ID              string   `json:"id"`
+	QueryType       string   `json:"queryType"`
+	QueryString     string   `json:"queryString"`
+	Sinks           []string `json:"sinks"`
+	SinkKafkaTopics []string `json:"sinkKafkaTopics"`
+	// State is the state of the query, e.g. RUNNING or ERROR, and
+	// StatusCount the number of servers in each state.
+	State       string         `json:"state"`
+	StatusCount map[string]int `json:"statusCount"`
+}
+
+// ListQueries returns the persistent queries and push queries running on
+// the cluster.
+func (c *Client) ListQueries(ctx context.Context) ([]QueryInfo, error) {
+	var resp []struct {
+		Queries []QueryInfo `json:"queries"`
+	}
+	if err := c.statement(ctx, "SHOW QUERIES;", &resp); err != nil {
+		return nil, err
+	}
+	queries := []QueryInfo{}
+	for _, r := range resp {
+		queries = append(queries, r.Queries...)
+	}
+	return queries, nil
+}
+
+// queryIDPattern matches query IDs, e.g. CTAS_ORDER_TOTALS_3 or
+// transient_HIGH_VALUE_ORDERS_123, which TERMINATE takes unquoted.
+var queryIDPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// TerminateQuery terminates a persistent query, such as the one behind a
+// CREATE TABLE AS SELECT, or a push query running on the server.
+func (c *Client) TerminateQuery(ctx context.Context, id string) error {
+	if !queryIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid query ID %q", id)
+	}
+	return c.statement(ctx, "TERMINATE "+id+";", nil)
+}
+
+// CloseQuery stops a push query started on /query-stream, like
+// PushQuerySubscription.Close.
+func (c *Client) CloseQuery(ctx context.Context, id string) error {
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+	resp, err := c.post(ctx, "/close-query", map[string]string{"queryId": id}, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("close query failed: %w", newError(resp.StatusCode, body))
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package ksqldb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/ksqldb-demo/ksqldb/ksqldbtest"
+)
+
+// closedQueries returns the query IDs sent to /close-query on ts.
+func closedQueries(ts *ksqldbtest.Server) []string {
+	var ids []string
+	for _, r := range ts.Requests() {
+		if r.Path == "/close-query" {
+			ids = append(ids, r.Body["queryId"].(string))
+		}
+	}
+	return ids
+}
+
+// runningQueries returns the IDs ListQueries reports.
+func runningQueries(t *testing.T, c *Client) []string {
+	t.Helper()
+	queries, err := c.ListQueries(context.Background())
+	if err != nil {
+		t.Fatalf("ListQueries: %v", err)
+	}
+	var ids []string
+	for _, q := range queries {
+		ids = append(ids, q.ID)
+	}
+	return ids
+}
+
+func TestPushQueryClose(t *testing.T) {
+	tests := []struct {
+		name   string
+		result ksqldbtest.Result
+		end    func(t *testing.T, s *PushQuerySubscription, cancel context.CancelFunc)
+		closed bool // whether /close-query is expected
+	}{
+		{
+			name:   "Close",
+			result: open(pushResult("o1")),
+			end:    func(t *testing.T, s *PushQuerySubscription, _ context.CancelFunc) { s.Close() },
+			closed: true,
+		},
+		{
+			name:   "break",
+			result: open(pushResult("o1", "o2")),
+			end: func(t *testing.T, s *PushQuerySubscription, _ context.CancelFunc) {
+				for range s.Rows() {
+					break
+				}
+			},
+			closed: true,
+		},
+		{
+			name:   "Close while iterating",
+			result: open(pushResult("o1")),
+			end: func(t *testing.T, s *PushQuerySubscription, _ context.CancelFunc) {
+				first := make(chan struct{})
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					for range s.Rows() {
+						close(first)
+					}
+				}()
+				<-first
+				s.Close()
+				select {
+				case <-done:
+				case <-time.After(5 * time.Second):
+					t.Fatal("Rows did not end after Close")
+				}
+			},
+			closed: true,
+		},
+		{
+			name:   "context cancelled",
+			result: open(pushResult("o1")),
+			end: func(t *testing.T, s *PushQuerySubscription, cancel context.CancelFunc) {
+				cancel()
+				for _, err := range s.Rows() {
+					if err != nil && !errors.Is(err, context.Canceled) {
+						t.Errorf("Rows error = %v, want context.Canceled", err)
+					}
+				}
+			},
+			closed: true,
+		},
+		{
+			name:   "ended by ksqlDB",
+			result: final(pushResult("o1")),
+			end: func(t *testing.T, s *PushQuerySubscription, _ context.CancelFunc) {
+				for range s.Rows() {
+				}
+			},
+			closed: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := ksqldbtest.NewServer()
+			defer ts.Close()
+			ts.Handle(ordersQuery, tt.result)
+			c := NewClient(ts.URL)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			s, err := c.Subscribe(ctx, ordersQuery)
+			if err != nil {
+				t.Fatalf("Subscribe: %v", err)
+			}
+			id := s.ID()
+			if tt.closed {
+				if got := runningQueries(t, c); len(got) != 1 || got[0] != id {
+					t.Fatalf("running queries = %v, want [%s]", got, id)
+				}
+			}
+
+			tt.end(t, s, cancel)
+			if err := s.Close(); err != nil {
+				t.Errorf("second Close: %v", err)
+			}
+
+			closed := closedQueries(ts)
+			if tt.closed && (len(closed) != 1 || closed[0] != id) {
+				t.Errorf("closed queries = %v, want [%s]", closed, id)
+			}
+			if !tt.closed && len(closed) != 0 {
+				t.Errorf("closed queries = %v, want none", closed)
+			}
+			if got := runningQueries(t, c); len(got) != 0 {
+				t.Errorf("running queries after close = %v", got)
+			}
+		})
+	}
+}
+
+func TestListQueries(t *testing.T) {
+	ts := ksqldbtest.NewServer()
+	defer ts.Close()
+	ts.AddQuery("CTAS_ORDER_TOTALS_3", "CREATE TABLE ORDER_TOTALS AS SELECT ...;")
+	ts.Handle(ordersQuery, open(pushResult()))
+	c := NewClient(ts.URL)
+
+	s, err := c.Subscribe(context.Background(), ordersQuery)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer s.Close()
+
+	queries, err := c.ListQueries(context.Background())
+	if err != nil {
+		t.Fatalf("ListQueries: %v", err)
+	}
+	want := map[string]QueryInfo{
+		"CTAS_ORDER_TOTALS_3": {QueryType: QueryTypePersistent, QueryString: "CREATE TABLE ORDER_TOTALS AS SELECT ...;"},
+		s.ID():                {QueryType: QueryTypePush, QueryString: ordersQuery},
+	}
+	if len(queries) != len(want) {
+		t.Fatalf("ListQueries = %+v, want %d queries", queries, len(want))
+	}
+	for _, q := range queries {
+		w, ok := want[q.ID]
+		if !ok || q.QueryType != w.QueryType || q.QueryString != w.QueryString || q.State != "RUNNING" {
+			t.Errorf("query %+v, want %+v", q, w)
+		}
+	}
+}
+
+func TestTerminateQuery(t *testing.T) {
+	ts := ksqldbtest.NewServer()
+	defer ts.Close()
+	ts.AddQuery("CTAS_ORDER_TOTALS_3", "CREATE TABLE ORDER_TOTALS AS SELECT ...;")
+	ts.Handle(ordersQuery, open(pushResult()))
+	c := NewClient(ts.URL)
+
+	s, err := c.Subscribe(context.Background(), ordersQuery)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		id      string
+		ok      bool
+		request bool // whether a statement reaches the server
+	}{
+		{"CTAS_ORDER_TOTALS_3", true, true},
+		{s.ID(), true, true},
+		{"CTAS_ORDER_TOTALS_3", false, true},
+		{"CTAS_X; DROP TABLE ORDERS", false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		before := len(ts.Requests())
+		err := c.TerminateQuery(context.Background(), tt.id)
+		if (err == nil) != tt.ok {
+			t.Errorf("TerminateQuery(%q) = %v, want ok %v", tt.id, err, tt.ok)
+		}
+		if sent := len(ts.Requests()) > before; sent != tt.request {
+			t.Errorf("TerminateQuery(%q) sent a request: %v, want %v", tt.id, sent, tt.request)
+		}
+	}
+	if got := runningQueries(t, c); len(got) != 0 {
+		t.Errorf("running queries after TERMINATE = %v", got)
+	}
+}
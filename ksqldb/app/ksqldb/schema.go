@@ -0,0 +1,437 @@
+package ksqldb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Base types of ksqlDB SQL types.
+const (
+	TypeBoolean   = "BOOLEAN"
+	TypeInteger   = "INTEGER"
+	TypeBigint    = "BIGINT"
+	TypeDouble    = "DOUBLE"
+	TypeDecimal   = "DECIMAL"
+	TypeString    = "STRING"
+	TypeBytes     = "BYTES"
+	TypeTimestamp = "TIMESTAMP"
+	TypeDate      = "DATE"
+	TypeTime      = "TIME"
+	TypeArray     = "ARRAY"
+	TypeMap       = "MAP"
+	TypeStruct    = "STRUCT"
+)
+
+// typeAliases maps alternative spellings to base types.
+var typeAliases = map[string]string{
+	"BOOLEAN":   TypeBoolean,
+	"INT":       TypeInteger,
+	"INTEGER":   TypeInteger,
+	"BIGINT":    TypeBigint,
+	"DOUBLE":    TypeDouble,
+	"DECIMAL":   TypeDecimal,
+	"STRING":    TypeString,
+	"VARCHAR":   TypeString,
+	"BYTES":     TypeBytes,
+	"TIMESTAMP": TypeTimestamp,
+	"DATE":      TypeDate,
+	"TIME":      TypeTime,
+	"ARRAY":     TypeArray,
+	"MAP":       TypeMap,
+	"STRUCT":    TypeStruct,
+}
+
+// Type describes a ksqlDB SQL type, e.g. DECIMAL(10, 2) or
+// ARRAY<STRUCT<`CITY` STRING, `ZIP` STRING>>.
+type Type struct {
+	// Base is one of the Type* constants.
+	Base string
+	// Precision and Scale are set for DECIMAL.
+	Precision int
+	Scale     int
+	// Key is the key type of a MAP.
+	Key *Type
+	// Elem is the element type of an ARRAY or the value type of a MAP.
+	Elem *Type
+	// Fields are the fields of a STRUCT.
+	Fields []Column
+}
+
+// String returns the type as ksqlDB writes it.
+func (t *Type) String() string {
+	switch t.Base {
+	case TypeDecimal:
+		return fmt.Sprintf("DECIMAL(%d, %d)", t.Precision, t.Scale)
+	case TypeArray:
+		return "ARRAY<" + t.Elem.String() + ">"
+	case TypeMap:
+		return "MAP<" + t.Key.String() + ", " + t.Elem.String() + ">"
+	case TypeStruct:
+		fields := make([]string, len(t.Fields))
+		for i, f := range t.Fields {
+			fields[i] = f.String()
+		}
+		return "STRUCT<" + strings.Join(fields, ", ") + ">"
+	}
+	return t.Base
+}
+
+// field returns the type of the STRUCT field name, or nil.
+func (t *Type) field(name string) *Type {
+	if t == nil {
+		return nil
+	}
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f.Type
+		}
+	}
+	return nil
+}
+
+// Column is a column of a query result or a field of a STRUCT.
+type Column struct {
+	Name string
+	Type *Type
+	// Key is set for KEY and PRIMARY KEY columns.
+	Key bool
+	// Headers is set for columns holding Kafka record headers: all of them
+	// (HEADERS), or the one named HeaderKey (HEADER('key')).
+	Headers   bool
+	HeaderKey string
+}
+
+// String returns the column as ksqlDB writes it in a schema.
+func (c Column) String() string {
+	s := quoteIdentifier(c.Name) + " " + c.Type.String()
+	switch {
+	case c.Key:
+		s += " KEY"
+	case c.Headers && c.HeaderKey != "":
+		s += " HEADER('" + strings.ReplaceAll(c.HeaderKey, "'", "''") + "')"
+	case c.Headers:
+		s += " HEADERS"
+	}
+	return s
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// ParseSchema parses the schema of a /query response header, e.g.
+//
+//	`ORDER_ID` STRING KEY, `ADDR` STRUCT<`CITY` STRING, `ZIP` STRING>, `PRICE` DECIMAL(10, 2)
+func ParseSchema(schema string) ([]Column, error) {
+	p, err := newSchemaParser(schema)
+	if err != nil {
+		return nil, err
+	}
+	var columns []Column
+	if p.peek().kind == tokenEOF {
+		return columns, nil
+	}
+	for {
+		col, err := p.column(true)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+		if !p.punct(",") {
+			break
+		}
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// ParseType parses a single type, such as an element of the columnTypes
+// of a /query-stream header.
+func ParseType(s string) (*Type, error) {
+	p, err := newSchemaParser(s)
+	if err != nil {
+		return nil, err
+	}
+	t, err := p.typ()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF        tokenKind = iota
+	tokenIdentifier           // `QUOTED`
+	tokenWord                 // unquoted word: a type name, keyword or identifier
+	tokenNumber
+	tokenString // 'literal'
+	tokenPunct  // < > ( ) ,
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// tokenize splits a schema into tokens.
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '`' || c == '\'':
+			// Quoted identifier or string literal; a doubled quote escapes it.
+			var b strings.Builder
+			start := i
+			i++
+			for {
+				if i >= len(s) {
+					return nil, fmt.Errorf("unterminated %c at offset %d", c, start)
+				}
+				if s[i] == c {
+					if i+1 < len(s) && s[i+1] == c {
+						b.WriteByte(c)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(s[i])
+				i++
+			}
+			kind := tokenIdentifier
+			if c == '\'' {
+				kind = tokenString
+			}
+			tokens = append(tokens, token{kind, b.String(), start})
+		case strings.IndexByte("<>(),", c) >= 0:
+			tokens = append(tokens, token{tokenPunct, string(c), i})
+			i++
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, s[start:i], start})
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(s) && (s[i] == '_' || s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z' || s[i] >= '0' && s[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, s[start:i], start})
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(s)}), nil
+}
+
+// schemaParser is a recursive descent parser over the tokens of a schema.
+type schemaParser struct {
+	input  string
+	tokens []token
+	pos    int
+}
+
+func newSchemaParser(s string) (*schemaParser, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %q: %w", s, err)
+	}
+	return &schemaParser{input: s, tokens: tokens}, nil
+}
+
+func (p *schemaParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *schemaParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *schemaParser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("invalid schema %q at offset %d: %s", p.input, t.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *schemaParser) expect(punct string) error {
+	if !p.punct(punct) {
+		return p.errorf(p.peek(), "expected %q, found %s", punct, describe(p.peek()))
+	}
+	return nil
+}
+
+func (p *schemaParser) expectEOF() error {
+	if t := p.peek(); t.kind != tokenEOF {
+		return p.errorf(t, "unexpected %s", describe(t))
+	}
+	return nil
+}
+
+// punct consumes the next token if it is punct.
+func (p *schemaParser) punct(punct string) bool {
+	if t := p.peek(); t.kind == tokenPunct && t.text == punct {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *schemaParser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokenWord && strings.EqualFold(t.text, word) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func describe(t token) string {
+	if t.kind == tokenEOF {
+		return "end of input"
+	}
+	return strconv.Quote(t.text)
+}
+
+// column parses "name type [constraint]". Constraints are only allowed on
+// top-level columns, not STRUCT fields.
+func (p *schemaParser) column(constraints bool) (Column, error) {
+	t := p.next()
+	if t.kind != tokenIdentifier && t.kind != tokenWord {
+		return Column{}, p.errorf(t, "expected column name, found %s", describe(t))
+	}
+	col := Column{Name: t.text}
+	if t.kind == tokenWord {
+		// Unquoted identifiers are case-insensitive and stored upper case.
+		col.Name = strings.ToUpper(t.text)
+	}
+	typ, err := p.typ()
+	if err != nil {
+		return Column{}, err
+	}
+	col.Type = typ
+	if !constraints {
+		return col, nil
+	}
+	switch {
+	case p.keyword("KEY"):
+		col.Key = true
+	case p.keyword("PRIMARY"):
+		if !p.keyword("KEY") {
+			return Column{}, p.errorf(p.peek(), "expected KEY after PRIMARY, found %s", describe(p.peek()))
+		}
+		col.Key = true
+	case p.keyword("HEADERS"):
+		col.Headers = true
+	case p.keyword("HEADER"):
+		if err := p.expect("("); err != nil {
+			return Column{}, err
+		}
+		key := p.next()
+		if key.kind != tokenString {
+			return Column{}, p.errorf(key, "expected header key, found %s", describe(key))
+		}
+		if err := p.expect(")"); err != nil {
+			return Column{}, err
+		}
+		col.Headers, col.HeaderKey = true, key.text
+	}
+	return col, nil
+}
+
+func (p *schemaParser) typ() (*Type, error) {
+	t := p.next()
+	base, ok := typeAliases[strings.ToUpper(t.text)]
+	if t.kind != tokenWord || !ok {
+		return nil, p.errorf(t, "expected type, found %s", describe(t))
+	}
+	typ := &Type{Base: base}
+	var err error
+	switch base {
+	case TypeDecimal:
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		if typ.Precision, err = p.number(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if typ.Scale, err = p.number(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	case TypeArray:
+		if err := p.expect("<"); err != nil {
+			return nil, err
+		}
+		if typ.Elem, err = p.typ(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(">"); err != nil {
+			return nil, err
+		}
+	case TypeMap:
+		if err := p.expect("<"); err != nil {
+			return nil, err
+		}
+		if typ.Key, err = p.typ(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if typ.Elem, err = p.typ(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(">"); err != nil {
+			return nil, err
+		}
+	case TypeStruct:
+		if err := p.expect("<"); err != nil {
+			return nil, err
+		}
+		if p.punct(">") {
+			return typ, nil
+		}
+		for {
+			field, err := p.column(false)
+			if err != nil {
+				return nil, err
+			}
+			typ.Fields = append(typ.Fields, field)
+			if !p.punct(",") {
+				break
+			}
+		}
+		if err := p.expect(">"); err != nil {
+			return nil, err
+		}
+	}
+	return typ, nil
+}
+
+func (p *schemaParser) number() (int, error) {
+	t := p.next()
+	if t.kind != tokenNumber {
+		return 0, p.errorf(t, "expected number, found %s", describe(t))
+	}
+	return strconv.Atoi(t.text)
+}
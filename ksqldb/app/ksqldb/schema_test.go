@@ -0,0 +1,150 @@
+package ksqldb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   []Column
+	}{
+		{
+			name:   "empty",
+			schema: "  ",
+			want:   nil,
+		},
+		{
+			name:   "nested struct",
+			schema: "`ORDER_ID` STRING KEY, `ADDR` STRUCT<`CITY` STRING, `ZIP` STRING>, `PRICE` DECIMAL(10, 2)",
+			want: []Column{
+				{Name: "ORDER_ID", Type: &Type{Base: TypeString}, Key: true},
+				{Name: "ADDR", Type: &Type{Base: TypeStruct, Fields: []Column{
+					{Name: "CITY", Type: &Type{Base: TypeString}},
+					{Name: "ZIP", Type: &Type{Base: TypeString}},
+				}}},
+				{Name: "PRICE", Type: &Type{Base: TypeDecimal, Precision: 10, Scale: 2}},
+			},
+		},
+		{
+			name:   "deeply nested",
+			schema: "`ITEMS` ARRAY<STRUCT<`SKU` STRING, `TAGS` MAP<STRING, ARRAY<INT>>>>",
+			want: []Column{
+				{Name: "ITEMS", Type: &Type{Base: TypeArray, Elem: &Type{Base: TypeStruct, Fields: []Column{
+					{Name: "SKU", Type: &Type{Base: TypeString}},
+					{Name: "TAGS", Type: &Type{Base: TypeMap, Key: &Type{Base: TypeString}, Elem: &Type{Base: TypeArray, Elem: &Type{Base: TypeInteger}}}},
+				}}}},
+			},
+		},
+		{
+			name:   "primary key",
+			schema: "`CUSTOMER_ID` BIGINT PRIMARY KEY, `TOTAL` DOUBLE",
+			want: []Column{
+				{Name: "CUSTOMER_ID", Type: &Type{Base: TypeBigint}, Key: true},
+				{Name: "TOTAL", Type: &Type{Base: TypeDouble}},
+			},
+		},
+		{
+			name:   "headers",
+			schema: "`ALL` ARRAY<STRUCT<`KEY` STRING, `VALUE` BYTES>> HEADERS, `TRACE` BYTES HEADER('trace''id')",
+			want: []Column{
+				{Name: "ALL", Type: &Type{Base: TypeArray, Elem: &Type{Base: TypeStruct, Fields: []Column{
+					{Name: "KEY", Type: &Type{Base: TypeString}},
+					{Name: "VALUE", Type: &Type{Base: TypeBytes}},
+				}}}, Headers: true},
+				{Name: "TRACE", Type: &Type{Base: TypeBytes}, Headers: true, HeaderKey: "trace'id"},
+			},
+		},
+		{
+			name:   "aliases and identifiers",
+			schema: "id varchar key, `Mixed``Case` Int, ts TIMESTAMP, d DATE, t TIME, ok BOOLEAN, s STRUCT<>",
+			want: []Column{
+				{Name: "ID", Type: &Type{Base: TypeString}, Key: true},
+				{Name: "Mixed`Case", Type: &Type{Base: TypeInteger}},
+				{Name: "TS", Type: &Type{Base: TypeTimestamp}},
+				{Name: "D", Type: &Type{Base: TypeDate}},
+				{Name: "T", Type: &Type{Base: TypeTime}},
+				{Name: "OK", Type: &Type{Base: TypeBoolean}},
+				{Name: "S", Type: &Type{Base: TypeStruct}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSchema(tt.schema)
+			if err != nil {
+				t.Fatalf("ParseSchema: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ParseSchema =\n%v\nwant\n%v", got, tt.want)
+			}
+			// Column.String writes a schema that parses to the same columns.
+			var parts []string
+			for _, c := range got {
+				parts = append(parts, c.String())
+			}
+			again, err := ParseSchema(strings.Join(parts, ", "))
+			if err != nil || !reflect.DeepEqual(again, tt.want) {
+				t.Errorf("round trip of %q = %v, %v", strings.Join(parts, ", "), again, err)
+			}
+		})
+	}
+}
+
+func TestParseType(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"INTEGER", "INTEGER"},
+		{"int", "INTEGER"},
+		{"VARCHAR", "STRING"},
+		{"DECIMAL(4,1)", "DECIMAL(4, 1)"},
+		{"ARRAY<BIGINT>", "ARRAY<BIGINT>"},
+		{"MAP<STRING, DOUBLE>", "MAP<STRING, DOUBLE>"},
+		{"STRUCT<city STRING, `zip` STRING>", "STRUCT<`CITY` STRING, `zip` STRING>"},
+	}
+	for _, tt := range tests {
+		typ, err := ParseType(tt.in)
+		if err != nil {
+			t.Errorf("ParseType(%q): %v", tt.in, err)
+			continue
+		}
+		if got := typ.String(); got != tt.want {
+			t.Errorf("ParseType(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	tests := []struct {
+		schema string
+		want   string
+	}{
+		{"`ID` STRING,", "offset 12: expected column name, found end of input"},
+		{"`ID` STRANG", "offset 5: expected type, found \"STRANG\""},
+		{"`ID` STRING KEY KEY", "offset 16: unexpected \"KEY\""},
+		{"`ID` STRING PRIMARY", "offset 19: expected KEY after PRIMARY, found end of input"},
+		{"`ID` BYTES HEADER(trace)", "offset 18: expected header key, found \"trace\""},
+		{"`ID` BYTES HEADER('trace'", "offset 25: expected \")\", found end of input"},
+		{"`ID` DECIMAL(10 2)", "offset 16: expected \",\", found \"2\""},
+		{"`ID` MAP<STRING>", "offset 15: expected \",\", found \">\""},
+		{"`A` STRUCT<`B` STRING KEY>", "offset 22: expected \">\", found \"KEY\""},
+		{"`ID` ARRAY<STRING", "offset 17: expected \">\", found end of input"},
+		{"`ID STRING", "unterminated ` at offset 0"},
+		{"`ID` STRING; DROP", "unexpected ';' at offset 11"},
+	}
+	for _, tt := range tests {
+		_, err := ParseSchema(tt.schema)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseSchema(%q) error = %v, want %q", tt.schema, err, tt.want)
+		}
+	}
+
+	if _, err := ParseType("INT INT"); err == nil || !strings.Contains(err.Error(), "offset 4") {
+		t.Errorf("ParseType trailing input error = %v", err)
+	}
+}
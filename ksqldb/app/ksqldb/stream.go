@@ -0,0 +1,229 @@
+package ksqldb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// Row is a row of a query result, decoded on demand.
+type Row struct {
+	// Columns describes the values; it is shared by all rows of a query.
+	Columns []Column
+	Values  []json.RawMessage
+}
+
+// Map decodes the row into a map keyed by column name, as PullQuery does.
+func (r Row) Map() (map[string]interface{}, error) {
+	return rowToMap(r.Columns, r.Values)
+}
+
+// Decode decodes the row into the value dst points to, as PullQueryInto
+// does.
+func (r Row) Decode(dst interface{}) error {
+	if v := reflect.ValueOf(dst); v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("cannot decode row into non-pointer %T", dst)
+	}
+	return decodeRow(r.Columns, r.Values, dst)
+}
+
+// PullQueryStream is a pull query whose rows are read from the connection
+// as they are iterated, so large results need not fit in memory.
+type PullQueryStream struct {
+	cancel context.CancelFunc
+	ctx    context.Context
+	body   io.ReadCloser
+	dec    *json.Decoder
+
+	queryID      string
+	columns      []Column
+	finalMessage string
+	limit        int
+	count        int
+
+	// mu guards done, which Close may set while another goroutine
+	// iterates Rows.
+	mu   sync.Mutex
+	done bool
+}
+
+// StreamPullQuery executes a pull query and returns once the result header
+// has arrived. Rows are then read by iterating Rows; the client timeout
+// covers the whole stream. Stop iterating or call Close to end the query
+// early; WithLimit does so after a number of rows.
+func (c *Client) StreamPullQuery(ctx context.Context, query string, opts ...QueryOption) (*PullQueryStream, error) {
+	o := newQueryOptions(opts)
+	ctx, cancel := c.requestContext(ctx)
+	resp, err := c.post(ctx, "/query", queryRequest{KSQL: query, StreamsProperties: o.properties}, "")
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("query failed: %w", newError(resp.StatusCode, body))
+	}
+
+	s := &PullQueryStream{
+		cancel: cancel,
+		ctx:    ctx,
+		body:   resp.Body,
+		dec:    json.NewDecoder(resp.Body),
+		limit:  o.limit,
+	}
+	if err := s.readHeader(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// readHeader reads the opening of the response array up to the header.
+func (s *PullQueryStream) readHeader() error {
+	if tok, err := s.dec.Token(); err != nil {
+		return s.readError(err)
+	} else if tok != json.Delim('[') {
+		return fmt.Errorf("failed to parse response: unexpected %v", tok)
+	}
+	for {
+		item, ok, err := s.nextItem()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// Ended without a header, e.g. with only a final message.
+			s.columns = []Column{}
+			return nil
+		}
+		if item.Header != nil {
+			s.queryID = item.Header.QueryID
+			columns, err := ParseSchema(item.Header.Schema)
+			if err != nil {
+				return fmt.Errorf("failed to parse header: %w", err)
+			}
+			// An empty schema still ends the header, with no columns.
+			s.columns = append([]Column{}, columns...)
+			return nil
+		}
+	}
+}
+
+// nextItem reads the next element of the response array. It returns false
+// at the end of the array.
+func (s *PullQueryStream) nextItem() (queryItem, bool, error) {
+	if s.finished() {
+		return queryItem{}, false, nil
+	}
+	if !s.dec.More() {
+		s.finish()
+		if _, err := s.dec.Token(); err != nil {
+			return queryItem{}, false, s.readError(err)
+		}
+		return queryItem{}, false, nil
+	}
+	var item queryItem
+	if err := s.dec.Decode(&item); err != nil {
+		s.finish()
+		return queryItem{}, false, s.readError(err)
+	}
+	switch {
+	case item.ErrorMessage != nil:
+		s.finish()
+		return queryItem{}, false, fmt.Errorf("query failed: %w", item.ErrorMessage)
+	case item.FinalMessage != "":
+		s.finalMessage = item.FinalMessage
+	}
+	return item, true, nil
+}
+
+func (s *PullQueryStream) finished() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+func (s *PullQueryStream) finish() {
+	s.mu.Lock()
+	s.done = true
+	s.mu.Unlock()
+}
+
+func (s *PullQueryStream) readError(err error) error {
+	if ctxErr := s.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("failed to parse response: %w", err)
+}
+
+// next returns the next row, or false when the result or the limit is
+// reached.
+func (s *PullQueryStream) next() (Row, bool, error) {
+	for {
+		if s.limit > 0 && s.count >= s.limit {
+			s.finish()
+			return Row{}, false, nil
+		}
+		item, ok, err := s.nextItem()
+		if err != nil || !ok {
+			return Row{}, false, err
+		}
+		if item.Row != nil {
+			s.count++
+			return Row{Columns: s.columns, Values: item.Row.Columns}, true, nil
+		}
+	}
+}
+
+// Rows returns an iterator over the remaining rows. A read or query error
+// is yielded last. The stream is closed when the iteration ends, including
+// when the loop breaks early.
+func (s *PullQueryStream) Rows() iter.Seq2[Row, error] {
+	return func(yield func(Row, error) bool) {
+		defer s.Close()
+		for {
+			row, ok, err := s.next()
+			if err != nil {
+				yield(Row{}, err)
+				return
+			}
+			if !ok || !yield(row, nil) {
+				return
+			}
+		}
+	}
+}
+
+// QueryID returns the ID ksqlDB assigned to the query.
+func (s *PullQueryStream) QueryID() string {
+	return s.queryID
+}
+
+// Columns returns the columns of the result.
+func (s *PullQueryStream) Columns() []Column {
+	return s.columns
+}
+
+// FinalMessage returns the message ksqlDB ended the result with, such as
+// "Limit Reached", once the rows have been read; it is empty otherwise.
+func (s *PullQueryStream) FinalMessage() string {
+	return s.finalMessage
+}
+
+// Close ends the query and releases the connection. It is safe to call
+// more than once, also from another goroutine while Rows is iterated.
+func (s *PullQueryStream) Close() error {
+	s.finish()
+	s.cancel()
+	return s.body.Close()
+}
@@ -0,0 +1,185 @@
+package ksqldb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/ksqldb-demo/ksqldb/ksqldbtest"
+)
+
+const totalsQuery = "SELECT * FROM ORDER_TOTALS;"
+
+var totalsRows = [][]interface{}{{"c1", 10}, {"c2", 20}, {"c3", 30}}
+
+// collect iterates the rows of s, returning the CUSTOMER_ID of each and the
+// error that ended the iteration.
+func collect(t *testing.T, s *PullQueryStream) ([]string, error) {
+	t.Helper()
+	var ids []string
+	for row, err := range s.Rows() {
+		if err != nil {
+			return ids, err
+		}
+		m, err := row.Map()
+		if err != nil {
+			t.Fatalf("Map: %v", err)
+		}
+		id, _ := m["CUSTOMER_ID"].(string)
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func TestStreamPullQuery(t *testing.T) {
+	schema := "`CUSTOMER_ID` STRING KEY, `TOTAL` BIGINT"
+	tests := []struct {
+		name    string
+		result  ksqldbtest.Result
+		opts    []QueryOption
+		columns int
+		want    string // CUSTOMER_IDs, joined by commas
+		final   string
+		err     string
+	}{
+		{
+			name:    "all rows",
+			result:  ksqldbtest.Result{Schema: schema, Rows: totalsRows},
+			columns: 2,
+			want:    "c1,c2,c3",
+		},
+		{
+			name:    "final message",
+			result:  ksqldbtest.Result{Schema: schema, Rows: totalsRows[:1], FinalMessage: "Limit Reached"},
+			columns: 2,
+			want:    "c1",
+			final:   "Limit Reached",
+		},
+		{
+			name:    "limit",
+			result:  ksqldbtest.Result{Schema: schema, Rows: totalsRows, Open: true},
+			opts:    []QueryOption{WithLimit(2)},
+			columns: 2,
+			want:    "c1,c2",
+		},
+		{
+			name:    "error after rows",
+			result:  ksqldbtest.Result{Schema: schema, Rows: totalsRows[:2], Error: &ksqldbtest.Error{ErrorCode: 50000, Message: "store unavailable"}},
+			columns: 2,
+			want:    "c1,c2",
+			err:     "query failed: ksqldb error 50000: store unavailable",
+		},
+		{
+			name:   "empty schema",
+			result: ksqldbtest.Result{Rows: [][]interface{}{{}, {}}, FinalMessage: "Query Completed"},
+			want:   ",",
+			final:  "Query Completed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := ksqldbtest.NewServer()
+			defer ts.Close()
+			ts.Handle(totalsQuery, tt.result)
+
+			s, err := NewClient(ts.URL).StreamPullQuery(context.Background(), totalsQuery, tt.opts...)
+			if err != nil {
+				t.Fatalf("StreamPullQuery: %v", err)
+			}
+			if s.QueryID() == "" {
+				t.Error("QueryID is empty")
+			}
+			if got := s.Columns(); got == nil || len(got) != tt.columns {
+				t.Errorf("Columns = %v, want %d columns", got, tt.columns)
+			}
+			ids, err := collect(t, s)
+			if got := strings.Join(ids, ","); got != tt.want {
+				t.Errorf("rows = %s, want %s", got, tt.want)
+			}
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+			if got := s.FinalMessage(); got != tt.final {
+				t.Errorf("FinalMessage = %q, want %q", got, tt.final)
+			}
+		})
+	}
+}
+
+func TestStreamPullQueryStatus(t *testing.T) {
+	ts := ksqldbtest.NewServer()
+	defer ts.Close()
+	ts.Handle(totalsQuery, ksqldbtest.Result{Status: 400, Error: &ksqldbtest.Error{Type: "statement_error", ErrorCode: ErrorCodeBadStatement, Message: "ORDER_TOTALS does not exist."}})
+
+	_, err := NewClient(ts.URL).StreamPullQuery(context.Background(), totalsQuery)
+	if !IsNotFound(err) {
+		t.Errorf("StreamPullQuery = %v, want a not found error", err)
+	}
+}
+
+func TestStreamPullQueryBreak(t *testing.T) {
+	ts := ksqldbtest.NewServer()
+	defer ts.Close()
+	ts.Handle(totalsQuery, ksqldbtest.Result{Schema: "`CUSTOMER_ID` STRING KEY", Rows: totalsRows, Open: true})
+
+	s, err := NewClient(ts.URL).StreamPullQuery(context.Background(), totalsQuery)
+	if err != nil {
+		t.Fatalf("StreamPullQuery: %v", err)
+	}
+	n := 0
+	for _, err := range s.Rows() {
+		if err != nil {
+			t.Fatalf("row: %v", err)
+		}
+		if n++; n == 2 {
+			break
+		}
+	}
+	// The stream is closed, so iterating again yields nothing.
+	if ids, err := collect(t, s); len(ids) != 0 || err != nil {
+		t.Errorf("after break: rows %v, error %v", ids, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+// TestStreamPullQueryClose closes a stream while another goroutine waits
+// for rows; run with -race.
+func TestStreamPullQueryClose(t *testing.T) {
+	ts := ksqldbtest.NewServer()
+	defer ts.Close()
+	ts.Handle(totalsQuery, ksqldbtest.Result{Schema: "`CUSTOMER_ID` STRING KEY", Rows: totalsRows[:1], Open: true})
+
+	s, err := NewClient(ts.URL).StreamPullQuery(context.Background(), totalsQuery)
+	if err != nil {
+		t.Fatalf("StreamPullQuery: %v", err)
+	}
+	first := make(chan struct{})
+	done := make(chan []string)
+	go func() {
+		var ids []string
+		for row, err := range s.Rows() {
+			if err != nil {
+				break
+			}
+			ids = append(ids, string(row.Values[0]))
+			if len(ids) == 1 {
+				close(first)
+			}
+		}
+		done <- ids
+	}()
+
+	<-first
+	s.Close()
+	select {
+	case ids := <-done:
+		if len(ids) != 1 {
+			t.Errorf("rows = %v, want one", ids)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Rows did not end after Close")
+	}
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -57,6 +59,23 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// newKsqlClient configures credentials and the request timeout from
+// KSQLDB_USERNAME / KSQLDB_PASSWORD and KSQLDB_TIMEOUT.
+func newKsqlClient(url string) *ksqldb.Client {
+	var opts []ksqldb.Option
+	if user := getEnv("KSQLDB_USERNAME", ""); user != "" {
+		opts = append(opts, ksqldb.WithBasicAuth(user, getEnv("KSQLDB_PASSWORD", "")))
+	}
+	if timeout := getEnv("KSQLDB_TIMEOUT", ""); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatalf("Invalid KSQLDB_TIMEOUT %q: %v", timeout, err)
+		}
+		opts = append(opts, ksqldb.WithTimeout(d))
+	}
+	return ksqldb.NewClient(url, opts...)
+}
+
 func runProducer(broker string) {
 	producer, err := kafka.NewProducer(broker, "orders")
 	if err != nil {
@@ -113,11 +132,30 @@ func runConsumer(broker string) {
 	}
 }
 
+// orderTotal is a row of the ORDER_TOTALS table.
+type orderTotal struct {
+	CustomerID  string      `ksql:"CUSTOMER_ID"`
+	OrderCount  int64       `ksql:"ORDER_COUNT"`
+	TotalAmount json.Number `ksql:"TOTAL_AMOUNT"`
+}
+
+// highValueOrder is a row of the HIGH_VALUE_ORDERS stream.
+type highValueOrder struct {
+	OrderID    string      `ksql:"ORDER_ID"`
+	CustomerID string      `ksql:"CUSTOMER_ID"`
+	Product    string      `ksql:"PRODUCT"`
+	Quantity   int32       `ksql:"QUANTITY"`
+	Price      json.Number `ksql:"PRICE"`
+}
+
 func runQuery(ksqldbURL string) {
-	client := ksqldb.NewClient(ksqldbURL)
+	client := newKsqlClient(ksqldbURL)
 
 	log.Println("Querying ORDER_TOTALS from ksqlDB...")
-	results, err := client.PullQuery("SELECT * FROM ORDER_TOTALS;")
+	results, err := ksqldb.PullQueryInto[orderTotal](context.Background(), client, "SELECT * FROM ORDER_TOTALS;")
+	if ksqldb.IsNotFound(err) {
+		log.Fatalf("ORDER_TOTALS does not exist; create it with `make sample`: %v", err)
+	}
 	if err != nil {
 		log.Fatalf("Query failed: %v", err)
 	}
@@ -126,14 +164,14 @@ func runQuery(ksqldbURL string) {
 	fmt.Println("Customer Order Totals:")
 	fmt.Println("─────────────────────────────────────")
 	for _, row := range results {
-		fmt.Printf("  Customer: %-6s | Orders: %v | Total: $%v\n",
-			row["CUSTOMER_ID"], row["ORDER_COUNT"], row["TOTAL_AMOUNT"])
+		fmt.Printf("  Customer: %-6s | Orders: %d | Total: $%s\n",
+			row.CustomerID, row.OrderCount, row.TotalAmount)
 	}
 	fmt.Println("─────────────────────────────────────")
 }
 
 func runStreamQuery(ksqldbURL string) {
-	client := ksqldb.NewClient(ksqldbURL)
+	client := newKsqlClient(ksqldbURL)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -146,14 +184,48 @@ func runStreamQuery(ksqldbURL string) {
 		cancel()
 	}()
 
+	// KSQLDB_CONTINUATION_FILE keeps the position across restarts, which
+	// needs scalable push queries enabled on the server. Without
+	// KSQLDB_OFFSET_RESET the query reads from earliest, or from latest
+	// with continuation tokens.
+	opts := []ksqldb.QueryOption{ksqldb.WithReconnect(ksqldb.Backoff{})}
+	if reset := getEnv("KSQLDB_OFFSET_RESET", ""); reset != "" {
+		opts = append(opts, ksqldb.WithOffsetReset(reset))
+	}
+	tokenFile := getEnv("KSQLDB_CONTINUATION_FILE", "")
+	if tokenFile != "" {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatalf("Failed to read %s: %v", tokenFile, err)
+		}
+		opts = append(opts, ksqldb.WithContinuation(strings.TrimSpace(string(token))))
+	}
+
 	log.Println("Subscribing to HIGH_VALUE_ORDERS stream (Ctrl+C to stop)...")
-	err := client.PushQuery(ctx, "SELECT * FROM HIGH_VALUE_ORDERS EMIT CHANGES;", func(row map[string]interface{}) {
-		log.Printf("High-value order: %s - %s (Customer: %s, Qty: %v, Price: $%v)",
-			row["ORDER_ID"], row["PRODUCT"], row["CUSTOMER_ID"],
-			row["QUANTITY"], row["PRICE"])
-	})
+	sub, err := client.Subscribe(ctx, "SELECT * FROM HIGH_VALUE_ORDERS EMIT CHANGES;", opts...)
 	if err != nil {
 		log.Printf("Stream ended: %v", err)
+		return
+	}
+	// Ctrl+C cancels ctx, which also closes the query on the server.
+	log.Printf("Subscribed as query %s", sub.ID())
+	for row, err := range sub.Rows() {
+		if err != nil {
+			log.Printf("Stream ended: %v", err)
+			break
+		}
+		var order highValueOrder
+		if err := row.Decode(&order); err != nil {
+			log.Printf("Skipping row: %v", err)
+			continue
+		}
+		log.Printf("High-value order: %s - %s (Customer: %s, Qty: %d, Price: $%s)",
+			order.OrderID, order.Product, order.CustomerID, order.Quantity, order.Price)
+		if token := sub.ContinuationToken(); tokenFile != "" && token != "" {
+			if err := os.WriteFile(tokenFile, []byte(token), 0o644); err != nil {
+				log.Printf("Failed to save continuation token: %v", err)
+			}
+		}
 	}
 }
 